@@ -22,6 +22,27 @@ func WriteError(respWriter http.ResponseWriter, status int, code, desc string) {
 		Desc:       desc,
 	}
 
+	writeErrorValue(respWriter, status, errVal)
+}
+
+// WriteValidationError writes a 422 error listing every violation found in the request.
+func WriteValidationError(respWriter http.ResponseWriter, code, desc string, violations interface{}) {
+	errVal := &struct {
+		HTTPStatus int         `json:"http_status"`
+		Code       string      `json:"code"`
+		Desc       string      `json:"desc"`
+		Violations interface{} `json:"violations"`
+	}{
+		HTTPStatus: http.StatusUnprocessableEntity,
+		Code:       code,
+		Desc:       desc,
+		Violations: violations,
+	}
+
+	writeErrorValue(respWriter, http.StatusUnprocessableEntity, errVal)
+}
+
+func writeErrorValue(respWriter http.ResponseWriter, status int, errVal interface{}) {
 	errValBytes, err := json.Marshal(errVal)
 	if err != nil {
 		log.Printf("marshal error: %v", err)
@@ -10,6 +10,160 @@ func (e AudienceError) Error() string {
 	return fmt.Sprintf("incorrect audience, audience found: %v", string(e))
 }
 
+type AlgorithmError struct {
+	Expected string
+	Found    string
+}
+
+func (e AlgorithmError) Error() string {
+	return fmt.Sprintf("unexpected signing algorithm, expected: %v, found: %v", e.Expected, e.Found)
+}
+
+type ClaimError struct {
+	Claim  string
+	Reason string
+}
+
+func (e ClaimError) Error() string {
+	return fmt.Sprintf("invalid %v claim: %v", e.Claim, e.Reason)
+}
+
+type KeyNotFoundError string
+
+func (e KeyNotFoundError) Error() string {
+	return fmt.Sprintf("signing key not found, kid: %q", string(e))
+}
+
+type IssuerError string
+
+func (e IssuerError) Error() string {
+	return fmt.Sprintf("incorrect issuer, issuer found: %v", string(e))
+}
+
+type InvalidGrantError string
+
+func (e InvalidGrantError) Error() string {
+	return fmt.Sprintf("invalid grant: %v", string(e))
+}
+
+type DecryptionError string
+
+func (e DecryptionError) Error() string {
+	return fmt.Sprintf("token decryption error: %v", string(e))
+}
+
+type TokenRevokedError string
+
+func (e TokenRevokedError) Error() string {
+	return fmt.Sprintf("token revoked, jti: %v", string(e))
+}
+
+type InvalidClientError string
+
+func (e InvalidClientError) Error() string {
+	return fmt.Sprintf("invalid client: %q", string(e))
+}
+
+type InvalidCredentialsError string
+
+func (e InvalidCredentialsError) Error() string {
+	return fmt.Sprintf("invalid credentials for user: %q", string(e))
+}
+
+type AccountDisabledError string
+
+func (e AccountDisabledError) Error() string {
+	return fmt.Sprintf("account disabled: %q", string(e))
+}
+
+type UserExistsError string
+
+func (e UserExistsError) Error() string {
+	return fmt.Sprintf("user already exists: %q", string(e))
+}
+
+type InvalidUsernameError string
+
+func (e InvalidUsernameError) Error() string {
+	return string(e)
+}
+
+type UserNotFoundError string
+
+func (e UserNotFoundError) Error() string {
+	return fmt.Sprintf("user not found: %q", string(e))
+}
+
+type PasswordPolicyError string
+
+func (e PasswordPolicyError) Error() string {
+	return string(e)
+}
+
+type InvalidAPIKeyError string
+
+func (e InvalidAPIKeyError) Error() string {
+	return fmt.Sprintf("invalid api key: %q", string(e))
+}
+
+type APIKeyNotFoundError string
+
+func (e APIKeyNotFoundError) Error() string {
+	return fmt.Sprintf("api key not found: %q", string(e))
+}
+
+// CertificateMismatchError is a token bound to a client certificate that is presented without it.
+type CertificateMismatchError string
+
+func (e CertificateMismatchError) Error() string {
+	return fmt.Sprintf("token: %q is bound to another client certificate", string(e))
+}
+
+type InvalidMFACodeError string
+
+func (e InvalidMFACodeError) Error() string {
+	return fmt.Sprintf("invalid mfa code for user: %q", string(e))
+}
+
+// MFARequiredError is a login of a user with a second factor that did not send a code.
+type MFARequiredError string
+
+func (e MFARequiredError) Error() string {
+	return fmt.Sprintf("mfa code required for user: %q", string(e))
+}
+
+type MFAEnabledError string
+
+func (e MFAEnabledError) Error() string {
+	return fmt.Sprintf("mfa already enabled for user: %q", string(e))
+}
+
+type MFANotEnrolledError string
+
+func (e MFANotEnrolledError) Error() string {
+	return fmt.Sprintf("no pending mfa enrolment for user: %q", string(e))
+}
+
+// AuthorizationPendingError, SlowDownError and ExpiredTokenError are the RFC 8628 states of a
+// device code that is polled before it can be redeemed.
+type AuthorizationPendingError string
+
+func (e AuthorizationPendingError) Error() string {
+	return fmt.Sprintf("authorization pending for device code of client: %q", string(e))
+}
+
+type SlowDownError string
+
+func (e SlowDownError) Error() string {
+	return fmt.Sprintf("device code of client: %q polled too fast", string(e))
+}
+
+type ExpiredTokenError string
+
+func (e ExpiredTokenError) Error() string {
+	return fmt.Sprintf("device code of client: %q expired", string(e))
+}
+
 type TypeAssertError struct {
 	Srv   string
 	Value string
@@ -26,3 +180,86 @@ type CtxValueKeyMissingError struct {
 func (e CtxValueKeyMissingError) Error() string {
 	return fmt.Sprintf("ctx value key missing service: %v", e.CtxKey)
 }
+
+type JSONPointerError struct {
+	Pointer string
+	Reason  string
+}
+
+func (e JSONPointerError) Error() string {
+	return fmt.Sprintf("json pointer error on pointer: %q, reason: %v", e.Pointer, e.Reason)
+}
+
+type ArrayIndexError struct {
+	Token  string
+	Length int
+}
+
+func (e ArrayIndexError) Error() string {
+	return fmt.Sprintf("invalid array index: %q for array of length: %v", e.Token, e.Length)
+}
+
+type SchemaError struct {
+	Location string
+	Reason   string
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("invalid schema at: %q, reason: %v", e.Location, e.Reason)
+}
+
+type SchemaNotFoundError string
+
+func (e SchemaNotFoundError) Error() string {
+	return fmt.Sprintf("schema not found: %v", string(e))
+}
+
+type ExpressionError struct {
+	Expression string
+	Reason     string
+}
+
+func (e ExpressionError) Error() string {
+	return fmt.Sprintf("expression error in: %q, reason: %v", e.Expression, e.Reason)
+}
+
+type PipelineError struct {
+	Step   int
+	Reason string
+}
+
+func (e PipelineError) Error() string {
+	return fmt.Sprintf("pipeline error at step: %v, reason: %v", e.Step, e.Reason)
+}
+
+type EvaluationLimitError int
+
+func (e EvaluationLimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the limit of %v steps", int(e))
+}
+
+type PatchError struct {
+	Operation int
+	Reason    string
+}
+
+func (e PatchError) Error() string {
+	return fmt.Sprintf("patch error at operation: %v, reason: %v", e.Operation, e.Reason)
+}
+
+// InvalidPatchError is a JSON Patch operation that is malformed, as opposed to PatchError for one
+// that cannot be applied to the document.
+type InvalidPatchError struct {
+	Operation int
+	Reason    string
+}
+
+func (e InvalidPatchError) Error() string {
+	return fmt.Sprintf("invalid patch operation: %v, reason: %v", e.Operation, e.Reason)
+}
+
+type DocumentNotFoundError string
+
+func (e DocumentNotFoundError) Error() string {
+	return fmt.Sprintf("document not found: %v", string(e))
+}
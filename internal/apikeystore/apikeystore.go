@@ -0,0 +1,142 @@
+package apikeystore
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+// Key is an API key of a subject, only the hash of its secret is kept.
+type Key struct {
+	ID         string
+	Subject    string
+	Name       string
+	Scopes     []string
+	SecretHash string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	// TokenVersion is the token version of the subject when the key was created, a password change
+	// invalidates the keys just like the tokens of the subject
+	TokenVersion int
+}
+
+// Service stores API keys by their id, the public part of the key.
+type Service interface {
+	Save(key Key) error
+	// Authenticate returns the key of id when secret matches and it has not expired, and records
+	// that it was used. Unknown, revoked and expired keys and wrong secrets return InvalidAPIKeyError.
+	Authenticate(id, secret string) (Key, error)
+	// List returns the keys of subject, oldest first.
+	List(subject string) []Key
+	// Revoke removes key id of subject, keys of other subjects return APIKeyNotFoundError.
+	Revoke(subject, id string) error
+}
+
+// apiKeyStoreImpl keeps keys in memory, they are lost on restart which means creating new ones.
+type apiKeyStoreImpl struct {
+	mu   *sync.Mutex
+	keys map[string]Key
+	now  func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*apiKeyStoreImpl)(nil)
+
+func New() apiKeyStoreImpl {
+	return apiKeyStoreImpl{
+		mu:   &sync.Mutex{},
+		keys: map[string]Key{},
+		now:  time.Now,
+	}
+}
+
+// WithClock returns a copy of the store that reads the time from now.
+func (c apiKeyStoreImpl) WithClock(now func() time.Time) Service {
+	c.now = now
+
+	return c
+}
+
+// HashSecret hashes the secret of a key with SHA-256, the secrets are random with 256 bits of
+// entropy so unlike passwords they do not need a slow hash.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Save stores key and drops expired keys so the map does not grow without bound.
+func (c apiKeyStoreImpl) Save(key Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for id, stored := range c.keys {
+		if now.After(stored.ExpiresAt) {
+			delete(c.keys, id)
+		}
+	}
+
+	c.keys[key.ID] = key
+
+	return nil
+}
+
+func (c apiKeyStoreImpl) Authenticate(id, secret string) (Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(HashSecret(secret))) != 1 {
+		return Key{}, common.InvalidAPIKeyError(id)
+	}
+
+	now := c.now()
+
+	if now.After(key.ExpiresAt) {
+		return Key{}, common.InvalidAPIKeyError(id)
+	}
+
+	key.LastUsedAt = now
+	c.keys[id] = key
+
+	return key, nil
+}
+
+func (c apiKeyStoreImpl) List(subject string) []Key {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := []Key{}
+
+	for _, key := range c.keys {
+		if key.Subject == subject {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	return keys
+}
+
+func (c apiKeyStoreImpl) Revoke(subject, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[id]
+	if !ok || key.Subject != subject {
+		return common.APIKeyNotFoundError(id)
+	}
+
+	delete(c.keys, id)
+
+	return nil
+}
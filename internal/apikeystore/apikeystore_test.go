@@ -0,0 +1,70 @@
+package apikeystore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+func Test_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	apiKeyStoreSrv := apiKeyStoreImpl{
+		mu:   &sync.Mutex{},
+		keys: map[string]Key{},
+		now:  func() time.Time { return now },
+	}
+
+	for _, key := range []Key{
+		{ID: "ci", Subject: "alice", SecretHash: HashSecret("ci secret"), CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "short", Subject: "alice", SecretHash: HashSecret("short secret"), CreatedAt: now.Add(time.Second), ExpiresAt: now.Add(time.Minute)},
+		{ID: "bob", Subject: "bob", SecretHash: HashSecret("bob secret"), CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := apiKeyStoreSrv.Save(key); err != nil {
+			t.Fatalf("apiKeyStoreImpl.Save() error = %v", err)
+		}
+	}
+
+	now = now.Add(30 * time.Second)
+
+	key, err := apiKeyStoreSrv.Authenticate("ci", "ci secret")
+	if err != nil || key.Subject != "alice" || !key.LastUsedAt.Equal(now) {
+		t.Fatalf("apiKeyStoreImpl.Authenticate() = %v, %v, want the key of alice used now", key, err)
+	}
+
+	if keys := apiKeyStoreSrv.List("alice"); len(keys) != 2 || keys[0].ID != "ci" || !keys[0].LastUsedAt.Equal(now) {
+		t.Fatalf("apiKeyStoreImpl.List() = %v, want ci then short with the last use of ci", keys)
+	}
+
+	if err := apiKeyStoreSrv.Revoke("alice", "bob"); !errors.As(err, new(common.APIKeyNotFoundError)) {
+		t.Fatalf("apiKeyStoreImpl.Revoke() of a key of bob error = %v, want APIKeyNotFoundError", err)
+	}
+
+	if err := apiKeyStoreSrv.Revoke("bob", "bob"); err != nil {
+		t.Fatalf("apiKeyStoreImpl.Revoke() error = %v", err)
+	}
+
+	now = now.Add(time.Minute)
+
+	tests := []struct {
+		name   string
+		id     string
+		secret string
+	}{
+		{name: "authenticate-wrongSecret", id: "ci", secret: "short secret"},
+		{name: "authenticate-expired", id: "short", secret: "short secret"},
+		{name: "authenticate-revoked", id: "bob", secret: "bob secret"},
+		{name: "authenticate-unknown", id: "unknown", secret: "ci secret"},
+	}
+
+	for _, tt := range tests {
+		if _, err := apiKeyStoreSrv.Authenticate(tt.id, tt.secret); !errors.As(err, new(common.InvalidAPIKeyError)) {
+			t.Fatalf("%v: apiKeyStoreImpl.Authenticate() error = %v, want InvalidAPIKeyError", tt.name, err)
+		}
+	}
+}
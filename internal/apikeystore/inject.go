@@ -0,0 +1,46 @@
+package apikeystore
+
+import (
+	"context"
+	"net/http"
+
+	"go-wai-wong/common"
+)
+
+func Inject(as Service) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithAPIKeyStore(r.Context(), as)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+const ctxKey = "41f65ba3-6860-4fcd-8cb8-378352aab202"
+
+func WithAPIKeyStore(ctx context.Context, service Service) context.Context {
+	return context.WithValue(ctx, ctxKey, service)
+}
+
+func FromContextAs(ctx context.Context, out interface{}) error {
+	ctxValueKey := ctx.Value(ctxKey)
+
+	if ctxValueKey == nil {
+		return common.CtxValueKeyMissingError{CtxKey: ctxKey}
+	}
+
+	srv, ok := ctxValueKey.(Service)
+	if !ok {
+		return common.TypeAssertError{Srv: "apikeystore", Value: "ctxValueKey"}
+	}
+
+	outTypeAssert, outOk := out.(*Service)
+
+	if !outOk {
+		return common.TypeAssertError{Srv: "apikeystore", Value: "out"}
+	}
+
+	*outTypeAssert = srv
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package apikeystore
+
+type APIKeyStoreClientImplMock struct {
+	SaveFn         func(key Key) error
+	AuthenticateFn func(id, secret string) (Key, error)
+	ListFn         func(subject string) []Key
+	RevokeFn       func(subject, id string) error
+}
+
+func (c *APIKeyStoreClientImplMock) Save(key Key) error {
+	if c != nil && c.SaveFn != nil {
+		return c.SaveFn(key)
+	}
+
+	apiKeyStoreSrv := New()
+
+	return apiKeyStoreSrv.Save(key)
+}
+
+func (c *APIKeyStoreClientImplMock) Authenticate(id, secret string) (Key, error) {
+	if c != nil && c.AuthenticateFn != nil {
+		return c.AuthenticateFn(id, secret)
+	}
+
+	apiKeyStoreSrv := New()
+
+	return apiKeyStoreSrv.Authenticate(id, secret)
+}
+
+func (c *APIKeyStoreClientImplMock) List(subject string) []Key {
+	if c != nil && c.ListFn != nil {
+		return c.ListFn(subject)
+	}
+
+	apiKeyStoreSrv := New()
+
+	return apiKeyStoreSrv.List(subject)
+}
+
+func (c *APIKeyStoreClientImplMock) Revoke(subject, id string) error {
+	if c != nil && c.RevokeFn != nil {
+		return c.RevokeFn(subject, id)
+	}
+
+	apiKeyStoreSrv := New()
+
+	return apiKeyStoreSrv.Revoke(subject, id)
+}
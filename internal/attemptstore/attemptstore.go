@@ -0,0 +1,153 @@
+package attemptstore
+
+import (
+	"sync"
+	"time"
+
+	"go-wai-wong/internal/constant"
+
+	"github.com/spf13/viper"
+)
+
+// Service tracks failed login attempts by key, such as a username or a client IP, and decides how
+// long a key has to wait before its next attempt.
+type Service interface {
+	// Wait returns how long key has to wait before its next attempt, zero when it may try now.
+	Wait(key string) time.Duration
+	// Fail records a failed attempt of key and returns how long it has to wait before the next one,
+	// locked is true when this failure reached maxFailures and locked the key out.
+	Fail(key string, maxFailures int) (wait time.Duration, locked bool)
+	// Reset forgets the failures of key after a successful attempt.
+	Reset(key string)
+}
+
+// attempts are the failures of a key within the window and when it may try again.
+type attempts struct {
+	failures    []time.Time
+	nextAttempt time.Time
+}
+
+// attemptStoreImpl keeps failures in memory with a sliding window, persistent or shared backends
+// implement Service.
+type attemptStoreImpl struct {
+	mu          *sync.Mutex
+	attempts    map[string]*attempts
+	window      time.Duration
+	backoffBase time.Duration
+	lockout     time.Duration
+	now         func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*attemptStoreImpl)(nil)
+
+func New() attemptStoreImpl {
+	return newAttemptStore(
+		viper.GetDuration(constant.AuthFailureWindow),
+		viper.GetDuration(constant.AuthBackoffBase),
+		viper.GetDuration(constant.AuthLockoutDuration),
+	)
+}
+
+// WithClock returns a copy of the store that reads the time from now.
+func (c attemptStoreImpl) WithClock(now func() time.Time) Service {
+	c.now = now
+
+	return c
+}
+
+func newAttemptStore(window, backoffBase, lockout time.Duration) attemptStoreImpl {
+	return attemptStoreImpl{
+		mu:          &sync.Mutex{},
+		attempts:    map[string]*attempts{},
+		window:      window,
+		backoffBase: backoffBase,
+		lockout:     lockout,
+		now:         time.Now,
+	}
+}
+
+func (c attemptStoreImpl) Wait(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keyAttempts, ok := c.attempts[key]
+	if !ok {
+		return 0
+	}
+
+	if wait := keyAttempts.nextAttempt.Sub(c.now()); wait > 0 {
+		return wait
+	}
+
+	return 0
+}
+
+// Fail lets the first failure through so a typo costs nothing, every later failure within the
+// window doubles the wait starting at backoffBase, up to the lockout. Reaching maxFailures locks
+// the key out for the lockout and starts the count over.
+func (c attemptStoreImpl) Fail(key string, maxFailures int) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	c.dropExpired(now)
+
+	keyAttempts, ok := c.attempts[key]
+	if !ok {
+		keyAttempts = &attempts{}
+		c.attempts[key] = keyAttempts
+	}
+
+	keyAttempts.failures = append(keyAttempts.failures, now)
+
+	failures := len(keyAttempts.failures)
+
+	if failures >= maxFailures {
+		keyAttempts.failures = nil
+		keyAttempts.nextAttempt = now.Add(c.lockout)
+
+		return c.lockout, true
+	}
+
+	wait := time.Duration(0)
+
+	if failures > 1 {
+		wait = c.backoffBase << (failures - 2)
+		if wait > c.lockout || wait <= 0 {
+			wait = c.lockout
+		}
+	}
+
+	keyAttempts.nextAttempt = now.Add(wait)
+
+	return wait, false
+}
+
+func (c attemptStoreImpl) Reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.attempts, key)
+}
+
+// dropExpired slides the window, failures older than the window no longer count and keys without
+// failures that may try again are removed. The caller holds the lock.
+func (c attemptStoreImpl) dropExpired(now time.Time) {
+	for key, keyAttempts := range c.attempts {
+		recent := keyAttempts.failures[:0]
+
+		for _, failedAt := range keyAttempts.failures {
+			if now.Sub(failedAt) < c.window {
+				recent = append(recent, failedAt)
+			}
+		}
+
+		keyAttempts.failures = recent
+
+		if len(recent) == 0 && !now.Before(keyAttempts.nextAttempt) {
+			delete(c.attempts, key)
+		}
+	}
+}
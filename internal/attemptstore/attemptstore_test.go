@@ -0,0 +1,62 @@
+package attemptstore
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Fail(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	attemptStoreSrv := newAttemptStore(15*time.Minute, time.Second, 10*time.Minute)
+	attemptStoreSrv.now = func() time.Time { return now }
+
+	tests := []struct {
+		name       string
+		after      time.Duration
+		wantWait   time.Duration
+		wantLocked bool
+	}{
+		{name: "fail-firstFailureIsFree", wantWait: 0},
+		{name: "fail-backoffStarts", wantWait: time.Second},
+		{name: "fail-backoffDoubles", after: time.Second, wantWait: 2 * time.Second},
+		{name: "fail-backoffDoublesAgain", after: 2 * time.Second, wantWait: 4 * time.Second},
+		{name: "fail-locked", after: 4 * time.Second, wantWait: 10 * time.Minute, wantLocked: true},
+		{name: "fail-countStartsOverAfterLockout", after: 10 * time.Minute, wantWait: 0},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+
+		wait, locked := attemptStoreSrv.Fail("alice", 5)
+		if wait != tt.wantWait || locked != tt.wantLocked {
+			t.Fatalf("%v: attemptStoreImpl.Fail() = %v, %v, want %v, %v", tt.name, wait, locked, tt.wantWait, tt.wantLocked)
+		}
+
+		if got := attemptStoreSrv.Wait("alice"); got != tt.wantWait {
+			t.Fatalf("%v: attemptStoreImpl.Wait() = %v, want %v", tt.name, got, tt.wantWait)
+		}
+	}
+
+	if got := attemptStoreSrv.Wait("bob"); got != 0 {
+		t.Fatalf("attemptStoreImpl.Wait() of an unknown key = %v, want 0", got)
+	}
+
+	// failures older than the window no longer count
+	now = now.Add(time.Second)
+	attemptStoreSrv.Fail("alice", 5)
+
+	now = now.Add(15 * time.Minute)
+
+	if wait, _ := attemptStoreSrv.Fail("alice", 5); wait != 0 {
+		t.Fatalf("attemptStoreImpl.Fail() after the window = %v, want 0", wait)
+	}
+
+	attemptStoreSrv.Reset("alice")
+
+	if _, ok := attemptStoreSrv.attempts["alice"]; ok {
+		t.Fatalf("attemptStoreImpl.Reset() kept the failures of alice")
+	}
+}
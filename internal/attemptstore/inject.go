@@ -0,0 +1,46 @@
+package attemptstore
+
+import (
+	"context"
+	"net/http"
+
+	"go-wai-wong/common"
+)
+
+func Inject(as Service) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithAttemptStore(r.Context(), as)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+const ctxKey = "35f80552-6357-4028-b534-409e7bbee190"
+
+func WithAttemptStore(ctx context.Context, service Service) context.Context {
+	return context.WithValue(ctx, ctxKey, service)
+}
+
+func FromContextAs(ctx context.Context, out interface{}) error {
+	ctxValueKey := ctx.Value(ctxKey)
+
+	if ctxValueKey == nil {
+		return common.CtxValueKeyMissingError{CtxKey: ctxKey}
+	}
+
+	srv, ok := ctxValueKey.(Service)
+	if !ok {
+		return common.TypeAssertError{Srv: "attemptstore", Value: "ctxValueKey"}
+	}
+
+	outTypeAssert, outOk := out.(*Service)
+
+	if !outOk {
+		return common.TypeAssertError{Srv: "attemptstore", Value: "out"}
+	}
+
+	*outTypeAssert = srv
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package attemptstore
+
+import "time"
+
+type AttemptStoreClientImplMock struct {
+	WaitFn  func(key string) time.Duration
+	FailFn  func(key string, maxFailures int) (time.Duration, bool)
+	ResetFn func(key string)
+}
+
+func (c *AttemptStoreClientImplMock) Wait(key string) time.Duration {
+	if c != nil && c.WaitFn != nil {
+		return c.WaitFn(key)
+	}
+
+	attemptStoreSrv := New()
+
+	return attemptStoreSrv.Wait(key)
+}
+
+func (c *AttemptStoreClientImplMock) Fail(key string, maxFailures int) (time.Duration, bool) {
+	if c != nil && c.FailFn != nil {
+		return c.FailFn(key, maxFailures)
+	}
+
+	attemptStoreSrv := New()
+
+	return attemptStoreSrv.Fail(key, maxFailures)
+}
+
+func (c *AttemptStoreClientImplMock) Reset(key string) {
+	if c != nil && c.ResetFn != nil {
+		c.ResetFn(key)
+
+		return
+	}
+
+	attemptStoreSrv := New()
+
+	attemptStoreSrv.Reset(key)
+}
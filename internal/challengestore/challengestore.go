@@ -0,0 +1,94 @@
+package challengestore
+
+import (
+	"sync"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+// Challenge is a login that passed the password check and still has to pass the second factor.
+type Challenge struct {
+	Subject   string
+	ExpiresAt time.Time
+}
+
+// Service stores MFA challenges by the hash of the challenge token. A wrong code does not use up
+// the challenge, the attempt store limits how often a code can be guessed.
+type Service interface {
+	Save(challengeHash string, challenge Challenge) error
+	// Get returns the challenge, an unknown or expired challenge returns InvalidGrantError.
+	Get(challengeHash string) (Challenge, error)
+	// Delete removes the challenge once its second factor passed so it cannot be used again.
+	Delete(challengeHash string) error
+}
+
+// challengeStoreImpl keeps challenges in memory, they only live for a few minutes.
+type challengeStoreImpl struct {
+	mu         *sync.Mutex
+	challenges map[string]Challenge
+	now        func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*challengeStoreImpl)(nil)
+
+func New() challengeStoreImpl {
+	return challengeStoreImpl{
+		mu:         &sync.Mutex{},
+		challenges: map[string]Challenge{},
+		now:        time.Now,
+	}
+}
+
+// WithClock returns a copy of the store that reads the time from now.
+func (c challengeStoreImpl) WithClock(now func() time.Time) Service {
+	c.now = now
+
+	return c
+}
+
+// Save stores challenge and drops expired challenges so the map does not grow without bound.
+func (c challengeStoreImpl) Save(challengeHash string, challenge Challenge) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for hash, stored := range c.challenges {
+		if now.After(stored.ExpiresAt) {
+			delete(c.challenges, hash)
+		}
+	}
+
+	c.challenges[challengeHash] = challenge
+
+	return nil
+}
+
+func (c challengeStoreImpl) Get(challengeHash string) (Challenge, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	challenge, ok := c.challenges[challengeHash]
+	if !ok {
+		return Challenge{}, common.InvalidGrantError("mfa challenge not found")
+	}
+
+	if c.now().After(challenge.ExpiresAt) {
+		delete(c.challenges, challengeHash)
+
+		return Challenge{}, common.InvalidGrantError("mfa challenge expired")
+	}
+
+	return challenge, nil
+}
+
+func (c challengeStoreImpl) Delete(challengeHash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.challenges, challengeHash)
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package challengestore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+func Test_Get(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	challengeStoreSrv := challengeStoreImpl{
+		mu:         &sync.Mutex{},
+		challenges: map[string]Challenge{},
+		now:        func() time.Time { return now },
+	}
+
+	if err := challengeStoreSrv.Save("challenge", Challenge{Subject: "alice", ExpiresAt: now.Add(5 * time.Minute)}); err != nil {
+		t.Fatalf("challengeStoreImpl.Save() error = %v", err)
+	}
+
+	if err := challengeStoreSrv.Save("expired", Challenge{Subject: "alice", ExpiresAt: now.Add(time.Second)}); err != nil {
+		t.Fatalf("challengeStoreImpl.Save() error = %v", err)
+	}
+
+	// a wrong code does not use up the challenge so it can be read again
+	for i := 0; i < 2; i++ {
+		if challenge, err := challengeStoreSrv.Get("challenge"); err != nil || challenge.Subject != "alice" {
+			t.Fatalf("challengeStoreImpl.Get() = %v, %v, want the challenge of alice", challenge, err)
+		}
+	}
+
+	if err := challengeStoreSrv.Delete("challenge"); err != nil {
+		t.Fatalf("challengeStoreImpl.Delete() error = %v", err)
+	}
+
+	if _, err := challengeStoreSrv.Get("challenge"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("challengeStoreImpl.Get() error = %v, want InvalidGrantError for a deleted challenge", err)
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, err := challengeStoreSrv.Get("expired"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("challengeStoreImpl.Get() error = %v, want InvalidGrantError for an expired challenge", err)
+	}
+}
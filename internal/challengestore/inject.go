@@ -0,0 +1,46 @@
+package challengestore
+
+import (
+	"context"
+	"net/http"
+
+	"go-wai-wong/common"
+)
+
+func Inject(as Service) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithChallengeStore(r.Context(), as)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+const ctxKey = "7f4978e5-9fde-43cc-8621-171343bdf9d9"
+
+func WithChallengeStore(ctx context.Context, service Service) context.Context {
+	return context.WithValue(ctx, ctxKey, service)
+}
+
+func FromContextAs(ctx context.Context, out interface{}) error {
+	ctxValueKey := ctx.Value(ctxKey)
+
+	if ctxValueKey == nil {
+		return common.CtxValueKeyMissingError{CtxKey: ctxKey}
+	}
+
+	srv, ok := ctxValueKey.(Service)
+	if !ok {
+		return common.TypeAssertError{Srv: "challengestore", Value: "ctxValueKey"}
+	}
+
+	outTypeAssert, outOk := out.(*Service)
+
+	if !outOk {
+		return common.TypeAssertError{Srv: "challengestore", Value: "out"}
+	}
+
+	*outTypeAssert = srv
+
+	return nil
+}
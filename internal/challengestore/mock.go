@@ -0,0 +1,37 @@
+package challengestore
+
+type ChallengeStoreClientImplMock struct {
+	SaveFn   func(challengeHash string, challenge Challenge) error
+	GetFn    func(challengeHash string) (Challenge, error)
+	DeleteFn func(challengeHash string) error
+}
+
+func (c *ChallengeStoreClientImplMock) Save(challengeHash string, challenge Challenge) error {
+	if c != nil && c.SaveFn != nil {
+		return c.SaveFn(challengeHash, challenge)
+	}
+
+	challengeStoreSrv := New()
+
+	return challengeStoreSrv.Save(challengeHash, challenge)
+}
+
+func (c *ChallengeStoreClientImplMock) Get(challengeHash string) (Challenge, error) {
+	if c != nil && c.GetFn != nil {
+		return c.GetFn(challengeHash)
+	}
+
+	challengeStoreSrv := New()
+
+	return challengeStoreSrv.Get(challengeHash)
+}
+
+func (c *ChallengeStoreClientImplMock) Delete(challengeHash string) error {
+	if c != nil && c.DeleteFn != nil {
+		return c.DeleteFn(challengeHash)
+	}
+
+	challengeStoreSrv := New()
+
+	return challengeStoreSrv.Delete(challengeHash)
+}
@@ -0,0 +1,115 @@
+package clientstore
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+
+	"github.com/spf13/viper"
+)
+
+// Client is a registered OAuth client, only the hex SHA-256 hash of its secret is kept. GrantTypes,
+// Scopes and Audiences limit the tokens the client can get from the token endpoint. Public clients,
+// such as browser apps and CLI tools, have no secret and can only use the authorization code grant
+// with PKCE or the device code grant.
+type Client struct {
+	ID           string   `mapstructure:"id"`
+	SecretHash   string   `mapstructure:"secret_sha256"`
+	Public       bool     `mapstructure:"public"`
+	GrantTypes   []string `mapstructure:"grant_types"`
+	Scopes       []string `mapstructure:"scopes"`
+	Audiences    []string `mapstructure:"audiences"`
+	RedirectURIs []string `mapstructure:"redirect_uris"`
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c Client) AllowsGrant(grantType string) bool {
+	return contains(c.GrantTypes, grantType)
+}
+
+func (c Client) AllowsScope(scope string) bool {
+	return contains(c.Scopes, scope)
+}
+
+func (c Client) AllowsAudience(audience string) bool {
+	return contains(c.Audiences, audience)
+}
+
+// AllowsRedirectURI only matches registered redirect URIs exactly.
+func (c Client) AllowsRedirectURI(redirectURI string) bool {
+	return contains(c.RedirectURIs, redirectURI)
+}
+
+type Service interface {
+	Get(id string) (Client, error)
+	Authenticate(id, secret string) (Client, error)
+}
+
+// clientStoreImpl holds the clients from the oauth.clients config.
+type clientStoreImpl struct {
+	clients map[string]Client
+}
+
+// verify interface compliance
+var _ Service = (*clientStoreImpl)(nil)
+
+// New loads the clients of oauth.clients, a config that cannot be read is an error so the server
+// does not start without its clients.
+func New() (clientStoreImpl, error) {
+	var clients []Client
+
+	if err := viper.UnmarshalKey(constant.OAuthClients, &clients); err != nil {
+		return clientStoreImpl{}, fmt.Errorf("failed to read %v: %w", constant.OAuthClients, err)
+	}
+
+	return newClientStore(clients...), nil
+}
+
+func newClientStore(clients ...Client) clientStoreImpl {
+	clientStore := clientStoreImpl{clients: map[string]Client{}}
+
+	for _, client := range clients {
+		clientStore.clients[client.ID] = client
+	}
+
+	return clientStore
+}
+
+func (c clientStoreImpl) Get(id string) (Client, error) {
+	client, ok := c.clients[id]
+	if !ok {
+		return Client{}, common.InvalidClientError(id)
+	}
+
+	return client, nil
+}
+
+// Authenticate compares the hash of secret with the stored hash in constant time.
+func (c clientStoreImpl) Authenticate(id, secret string) (Client, error) {
+	client, err := c.Get(id)
+	if err != nil {
+		return Client{}, err
+	}
+
+	secretHash := sha256.Sum256([]byte(secret))
+
+	storedHash, err := hex.DecodeString(client.SecretHash)
+	if err != nil || subtle.ConstantTimeCompare(secretHash[:], storedHash) != 1 {
+		return Client{}, common.InvalidClientError(id)
+	}
+
+	return client, nil
+}
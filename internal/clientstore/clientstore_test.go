@@ -0,0 +1,54 @@
+package clientstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"go-wai-wong/common"
+)
+
+func Test_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	secretHash := sha256.Sum256([]byte("gateway secret"))
+
+	clientStoreSrv := newClientStore(
+		Client{ID: "gateway", SecretHash: hex.EncodeToString(secretHash[:])},
+		Client{ID: "badHash", SecretHash: "not hex"},
+	)
+
+	tests := []struct {
+		name    string
+		id      string
+		secret  string
+		wantErr bool
+	}{
+		{name: "authenticate-validSecret", id: "gateway", secret: "gateway secret"},
+		{name: "authenticate-wrongSecret", id: "gateway", secret: "wrong", wantErr: true},
+		{name: "authenticate-unknownClient", id: "unknown", secret: "gateway secret", wantErr: true},
+		{name: "authenticate-badStoredHash", id: "badHash", secret: "gateway secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := clientStoreSrv.Authenticate(tt.id, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientStoreImpl.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.As(err, new(common.InvalidClientError)) {
+				t.Fatalf("clientStoreImpl.Authenticate() error = %v, want InvalidClientError", err)
+			}
+
+			if !tt.wantErr && client.ID != tt.id {
+				t.Fatalf("clientStoreImpl.Authenticate() = %v, want %v", client.ID, tt.id)
+			}
+		})
+	}
+}
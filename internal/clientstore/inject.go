@@ -0,0 +1,46 @@
+package clientstore
+
+import (
+	"context"
+	"net/http"
+
+	"go-wai-wong/common"
+)
+
+func Inject(as Service) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithClientStore(r.Context(), as)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+const ctxKey = "f46c200e-86b1-497c-bddc-e1a100cb9419"
+
+func WithClientStore(ctx context.Context, service Service) context.Context {
+	return context.WithValue(ctx, ctxKey, service)
+}
+
+func FromContextAs(ctx context.Context, out interface{}) error {
+	ctxValueKey := ctx.Value(ctxKey)
+
+	if ctxValueKey == nil {
+		return common.CtxValueKeyMissingError{CtxKey: ctxKey}
+	}
+
+	srv, ok := ctxValueKey.(Service)
+	if !ok {
+		return common.TypeAssertError{Srv: "clientstore", Value: "ctxValueKey"}
+	}
+
+	outTypeAssert, outOk := out.(*Service)
+
+	if !outOk {
+		return common.TypeAssertError{Srv: "clientstore", Value: "out"}
+	}
+
+	*outTypeAssert = srv
+
+	return nil
+}
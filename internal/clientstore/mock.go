@@ -0,0 +1,32 @@
+package clientstore
+
+type ClientStoreClientImplMock struct {
+	GetFn          func(id string) (Client, error)
+	AuthenticateFn func(id, secret string) (Client, error)
+}
+
+func (c *ClientStoreClientImplMock) Get(id string) (Client, error) {
+	if c != nil && c.GetFn != nil {
+		return c.GetFn(id)
+	}
+
+	clientStoreSrv, err := New()
+	if err != nil {
+		return Client{}, err
+	}
+
+	return clientStoreSrv.Get(id)
+}
+
+func (c *ClientStoreClientImplMock) Authenticate(id, secret string) (Client, error) {
+	if c != nil && c.AuthenticateFn != nil {
+		return c.AuthenticateFn(id, secret)
+	}
+
+	clientStoreSrv, err := New()
+	if err != nil {
+		return Client{}, err
+	}
+
+	return clientStoreSrv.Authenticate(id, secret)
+}
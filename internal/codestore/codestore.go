@@ -0,0 +1,92 @@
+package codestore
+
+import (
+	"sync"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+// Grant is what an authorization code was issued for, it is redeemed at the token endpoint. AMR are
+// the methods of the login.
+type Grant struct {
+	ClientID            string
+	RedirectURI         string
+	Subject             string
+	Scope               []string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	AMR                 []string
+	ExpiresAt           time.Time
+}
+
+// Service stores authorization codes by the hash of the code, a code can only be redeemed once.
+type Service interface {
+	Save(codeHash string, grant Grant) error
+	// Redeem removes the code and returns its grant, redeeming an unknown, redeemed or expired
+	// code returns InvalidGrantError.
+	Redeem(codeHash string) (Grant, error)
+}
+
+// codeStoreImpl keeps codes in memory, they only live for a minute or so anyway.
+type codeStoreImpl struct {
+	mu    *sync.Mutex
+	codes map[string]Grant
+	now   func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*codeStoreImpl)(nil)
+
+func New() codeStoreImpl {
+	return codeStoreImpl{
+		mu:    &sync.Mutex{},
+		codes: map[string]Grant{},
+		now:   time.Now,
+	}
+}
+
+// WithClock returns a copy of the store that reads the time from now.
+func (c codeStoreImpl) WithClock(now func() time.Time) Service {
+	c.now = now
+
+	return c
+}
+
+// Save stores grant and drops expired codes so the map does not grow without bound.
+func (c codeStoreImpl) Save(codeHash string, grant Grant) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for hash, stored := range c.codes {
+		if now.After(stored.ExpiresAt) {
+			delete(c.codes, hash)
+		}
+	}
+
+	c.codes[codeHash] = grant
+
+	return nil
+}
+
+func (c codeStoreImpl) Redeem(codeHash string) (Grant, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	grant, ok := c.codes[codeHash]
+	if !ok {
+		return Grant{}, common.InvalidGrantError("authorization code not found")
+	}
+
+	delete(c.codes, codeHash)
+
+	if c.now().After(grant.ExpiresAt) {
+		return Grant{}, common.InvalidGrantError("authorization code expired")
+	}
+
+	return grant, nil
+}
@@ -0,0 +1,45 @@
+package codestore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+func Test_Redeem(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	codeStoreSrv := New().WithClock(func() time.Time { return now })
+
+	if err := codeStoreSrv.Save("code", Grant{Subject: "alice", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("codeStoreImpl.Save() error = %v", err)
+	}
+
+	if err := codeStoreSrv.Save("expired", Grant{Subject: "alice", ExpiresAt: now.Add(time.Second)}); err != nil {
+		t.Fatalf("codeStoreImpl.Save() error = %v", err)
+	}
+
+	grant, err := codeStoreSrv.Redeem("code")
+	if err != nil || grant.Subject != "alice" {
+		t.Fatalf("codeStoreImpl.Redeem() = %v, %v, want the grant of alice", grant, err)
+	}
+
+	// codes are single use
+	if _, err := codeStoreSrv.Redeem("code"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("codeStoreImpl.Redeem() error = %v, want InvalidGrantError for a redeemed code", err)
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, err := codeStoreSrv.Redeem("expired"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("codeStoreImpl.Redeem() error = %v, want InvalidGrantError for an expired code", err)
+	}
+
+	if _, err := codeStoreSrv.Redeem("unknown"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("codeStoreImpl.Redeem() error = %v, want InvalidGrantError for an unknown code", err)
+	}
+}
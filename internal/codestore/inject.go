@@ -0,0 +1,46 @@
+package codestore
+
+import (
+	"context"
+	"net/http"
+
+	"go-wai-wong/common"
+)
+
+func Inject(as Service) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithCodeStore(r.Context(), as)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+const ctxKey = "1bfbda85-a284-4526-9a97-bde979b8f191"
+
+func WithCodeStore(ctx context.Context, service Service) context.Context {
+	return context.WithValue(ctx, ctxKey, service)
+}
+
+func FromContextAs(ctx context.Context, out interface{}) error {
+	ctxValueKey := ctx.Value(ctxKey)
+
+	if ctxValueKey == nil {
+		return common.CtxValueKeyMissingError{CtxKey: ctxKey}
+	}
+
+	srv, ok := ctxValueKey.(Service)
+	if !ok {
+		return common.TypeAssertError{Srv: "codestore", Value: "ctxValueKey"}
+	}
+
+	outTypeAssert, outOk := out.(*Service)
+
+	if !outOk {
+		return common.TypeAssertError{Srv: "codestore", Value: "out"}
+	}
+
+	*outTypeAssert = srv
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package codestore
+
+type CodeStoreClientImplMock struct {
+	SaveFn   func(codeHash string, grant Grant) error
+	RedeemFn func(codeHash string) (Grant, error)
+}
+
+func (c *CodeStoreClientImplMock) Save(codeHash string, grant Grant) error {
+	if c != nil && c.SaveFn != nil {
+		return c.SaveFn(codeHash, grant)
+	}
+
+	codeStoreSrv := New()
+
+	return codeStoreSrv.Save(codeHash, grant)
+}
+
+func (c *CodeStoreClientImplMock) Redeem(codeHash string) (Grant, error) {
+	if c != nil && c.RedeemFn != nil {
+		return c.RedeemFn(codeHash)
+	}
+
+	codeStoreSrv := New()
+
+	return codeStoreSrv.Redeem(codeHash)
+}
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"go-wai-wong/internal/constant"
@@ -8,9 +12,72 @@ import (
 	"github.com/spf13/viper"
 )
 
-// load config, avoid using init()
+var loadOnce sync.Once
+
+// load config, avoid using init(), only the first call does the work so parallel tests can all call it
 func LoadConfig() {
+	loadOnce.Do(loadConfig)
+}
+
+func loadConfig() {
 	viper.SetDefault(constant.TokenSecret, "NXY4eS9CP0UoSCtLYlBlU2hWbVlxM3Q2dzl6JEMmRik=")
 	viper.SetDefault(constant.TokenAudience, "local")
+	viper.SetDefault(constant.TokenAudiences, []string{})
+	viper.SetDefault(constant.TokenClockSkew, 30*time.Second)
 	viper.SetDefault(constant.TokenExpiresIn, constant.ExpiresInMinutes*time.Minute)
+	viper.SetDefault(constant.TokenRefreshExpiresIn, constant.RefreshExpiresInHours*time.Hour)
+	viper.SetDefault(constant.TokenIssuer, "http://localhost:8080")
+	viper.SetDefault(constant.TokenAlgorithm, "HS256")
+	viper.SetDefault(constant.TokenPrivateKey, "")
+	viper.SetDefault(constant.TokenPublicKey, "")
+	viper.SetDefault(constant.TokenKeyDirectory, "")
+	viper.SetDefault(constant.TokenKeyRotation, time.Duration(0))
+	viper.SetDefault(constant.TokenKeyOverlap, constant.ExpiresInMinutes*time.Minute)
+	viper.SetDefault(constant.AuthMaxFailures, 5)
+	viper.SetDefault(constant.AuthMaxIPFailures, 20)
+	viper.SetDefault(constant.AuthFailureWindow, 15*time.Minute)
+	viper.SetDefault(constant.AuthLockoutDuration, 15*time.Minute)
+	viper.SetDefault(constant.AuthBackoffBase, time.Second)
+	viper.SetDefault(constant.MFAIssuer, "sumapi")
+	viper.SetDefault(constant.MFAChallengeExpiresIn, 5*time.Minute)
+	viper.SetDefault(constant.APIKeysMaxExpiresIn, 90*24*time.Hour)
+	viper.SetDefault(constant.TLSCertFile, "")
+	viper.SetDefault(constant.TLSKeyFile, "")
+	viper.SetDefault(constant.TLSClientCAFile, "")
+	viper.SetDefault(constant.TLSRequireClientCert, false)
+	viper.SetDefault(constant.TLSCertificateUsers, []interface{}{})
+	viper.SetDefault(constant.AuthzRoles, map[string][]string{
+		"user":  {"sum:write", "documents:read", "documents:write"},
+		"admin": {"admin"},
+	})
+	viper.SetDefault(constant.AuthzDefaultRoles, []string{"user"})
+	viper.SetDefault(constant.SumSchema, "")
+	viper.SetDefault(constant.SumSchemaFile, "")
+	viper.SetDefault(constant.OIDCGrantTypes, []string{
+		"authorization_code",
+		"client_credentials",
+		"urn:ietf:params:oauth:grant-type:device_code",
+		"urn:ietf:params:oauth:grant-type:token-exchange",
+	})
+	viper.SetDefault(constant.UsersFile, "")
+	viper.SetDefault(constant.UsersHashAlgorithm, "argon2id")
+	viper.SetDefault(constant.UsersPasswordMinLength, 8)
+	viper.SetDefault(constant.UsersPasswordClasses, 1)
+	viper.SetDefault(constant.UsersBreachedPasswordsFile, "")
+	viper.SetDefault(constant.OAuthClients, []interface{}{})
+	viper.SetDefault(constant.OAuthCodeExpiresIn, time.Minute)
+	viper.SetDefault(constant.OAuthDeviceCodeExpiresIn, 10*time.Minute)
+	viper.SetDefault(constant.OAuthDevicePollInterval, 5*time.Second)
+	viper.SetDefault(constant.OIDCClaims, []string{"sub", "aud", "exp", "iss", "iat", "auth_time", "nonce", "azp", "scope", "roles", "act", "name", "email", "tenant", "amr"})
+
+	// optional config.(yaml|json|toml) in the working directory, env vars such as SUM_SCHEMA override it
+	viper.SetConfigName("config")
+	viper.AddConfigPath(".")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	var notFoundErr viper.ConfigFileNotFoundError
+	if err := viper.ReadInConfig(); err != nil && !errors.As(err, &notFoundErr) {
+		log.Printf("failed to read config file: %v", err)
+	}
 }
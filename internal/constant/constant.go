@@ -1,8 +1,51 @@
 package constant
 
 const (
-	TokenSecret      = "token.secret"
-	TokenAudience    = "token.audience"
-	TokenExpiresIn   = "token.expiresin"
-	ExpiresInMinutes = 60
+	TokenSecret                = "token.secret"
+	TokenAudience              = "token.audience"
+	TokenAudiences             = "token.audiences"
+	TokenClockSkew             = "token.clockskew"
+	TokenExpiresIn             = "token.expiresin"
+	TokenIssuer                = "token.issuer"
+	TokenRefreshExpiresIn      = "token.refreshexpiresin"
+	TokenAlgorithm             = "token.algorithm"
+	TokenPrivateKey            = "token.privatekeyfile"
+	TokenPublicKey             = "token.publickeyfile"
+	TokenKeyDirectory          = "token.keydirectory"
+	TokenKeyRotation           = "token.keyrotation"
+	TokenKeyOverlap            = "token.keyoverlap"
+	TokenEncryption            = "token.encryption"
+	TokenEncryptionKey         = "token.encryptionkey"
+	TokenEncryptionPublicKey   = "token.encryptionpublickeyfile"
+	TokenEncryptionPrivateKey  = "token.encryptionprivatekeyfile"
+	ExpiresInMinutes           = 60
+	RefreshExpiresInHours      = 30 * 24
+	AuthMaxFailures            = "auth.maxfailures"
+	AuthMaxIPFailures          = "auth.maxipfailures"
+	AuthFailureWindow          = "auth.failurewindow"
+	AuthLockoutDuration        = "auth.lockoutduration"
+	AuthBackoffBase            = "auth.backoffbase"
+	MFAIssuer                  = "mfa.issuer"
+	MFAChallengeExpiresIn      = "mfa.challengeexpiresin"
+	APIKeysMaxExpiresIn        = "apikeys.maxexpiresin"
+	TLSCertFile                = "tls.certfile"
+	TLSKeyFile                 = "tls.keyfile"
+	TLSClientCAFile            = "tls.clientcafile"
+	TLSRequireClientCert       = "tls.requireclientcert"
+	TLSCertificateUsers        = "tls.certificateusers"
+	AuthzRoles                 = "authz.roles"
+	AuthzDefaultRoles          = "authz.defaultroles"
+	SumSchema                  = "sum.schema"
+	SumSchemaFile              = "sum.schemafile"
+	OIDCGrantTypes             = "oidc.granttypes"
+	OIDCClaims                 = "oidc.claims"
+	OAuthClients               = "oauth.clients"
+	OAuthCodeExpiresIn         = "oauth.codeexpiresin"
+	OAuthDeviceCodeExpiresIn   = "oauth.devicecodeexpiresin"
+	OAuthDevicePollInterval    = "oauth.devicepollinterval"
+	UsersFile                  = "users.file"
+	UsersHashAlgorithm         = "users.hashalgorithm"
+	UsersPasswordMinLength     = "users.passwordminlength"
+	UsersPasswordClasses       = "users.passwordclasses"
+	UsersBreachedPasswordsFile = "users.breachedpasswordsfile"
 )
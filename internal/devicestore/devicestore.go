@@ -0,0 +1,192 @@
+package devicestore
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+
+	// slowDownStep is how much RFC 8628 says the interval goes up on every slow_down
+	slowDownStep = 5 * time.Second
+)
+
+// Grant is a pending device authorization, Subject and Scope are set once a user approves it.
+type Grant struct {
+	ClientID       string
+	UserCode       string
+	RequestedScope []string
+	Scope          []string
+	Subject        string
+	AMR            []string
+	Status         string
+	ApprovedAt     time.Time
+	Interval       time.Duration
+	LastPolledAt   time.Time
+	ExpiresAt      time.Time
+}
+
+// Service stores device grants by the hash of the device code, users find them by the user code.
+type Service interface {
+	Save(deviceCodeHash string, grant Grant) error
+	// Lookup returns the pending grant of a user code, unknown, approved or expired codes return
+	// InvalidGrantError.
+	Lookup(userCode string) (Grant, error)
+	// Approve grants scope to the device, amr are the methods the approving user logged in with.
+	// Grants that are never approved stay pending until they expire, so no user can end the
+	// pending grant of another.
+	Approve(userCode, subject string, scope, amr []string) error
+	// Poll returns the grant of an approved device code and removes it, otherwise one of the
+	// RFC 8628 errors: AuthorizationPendingError, SlowDownError or ExpiredTokenError.
+	Poll(deviceCodeHash string) (Grant, error)
+}
+
+// deviceStoreImpl keeps device grants in memory, they live for a few minutes.
+type deviceStoreImpl struct {
+	mu        *sync.Mutex
+	grants    map[string]Grant
+	userCodes map[string]string
+	now       func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*deviceStoreImpl)(nil)
+
+func New() deviceStoreImpl {
+	return deviceStoreImpl{
+		mu:        &sync.Mutex{},
+		grants:    map[string]Grant{},
+		userCodes: map[string]string{},
+		now:       time.Now,
+	}
+}
+
+// WithClock returns a copy of the store that reads the time from now.
+func (c deviceStoreImpl) WithClock(now func() time.Time) Service {
+	c.now = now
+
+	return c
+}
+
+// NormalizeUserCode upper cases a user code and drops the dashes and spaces users may type.
+func NormalizeUserCode(userCode string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+}
+
+// Save stores grant and drops expired grants so the maps do not grow without bound.
+func (c deviceStoreImpl) Save(deviceCodeHash string, grant Grant) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for hash, stored := range c.grants {
+		if now.After(stored.ExpiresAt) {
+			delete(c.userCodes, NormalizeUserCode(stored.UserCode))
+			delete(c.grants, hash)
+		}
+	}
+
+	userCode := NormalizeUserCode(grant.UserCode)
+	if _, ok := c.userCodes[userCode]; ok {
+		return common.InvalidGrantError("user code already in use")
+	}
+
+	grant.Status = StatusPending
+	c.grants[deviceCodeHash] = grant
+	c.userCodes[userCode] = deviceCodeHash
+
+	return nil
+}
+
+// pending returns the device code hash and grant of a pending user code, the caller holds the lock.
+func (c deviceStoreImpl) pending(userCode string) (string, Grant, error) {
+	deviceCodeHash, ok := c.userCodes[NormalizeUserCode(userCode)]
+	if !ok {
+		return "", Grant{}, common.InvalidGrantError("user code not found")
+	}
+
+	grant := c.grants[deviceCodeHash]
+	if grant.Status != StatusPending || c.now().After(grant.ExpiresAt) {
+		return "", Grant{}, common.InvalidGrantError("user code is no longer pending")
+	}
+
+	return deviceCodeHash, grant, nil
+}
+
+func (c deviceStoreImpl) Lookup(userCode string) (Grant, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, grant, err := c.pending(userCode)
+
+	return grant, err
+}
+
+func (c deviceStoreImpl) Approve(userCode, subject string, scope, amr []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deviceCodeHash, grant, err := c.pending(userCode)
+	if err != nil {
+		return err
+	}
+
+	grant.Status = StatusApproved
+	grant.Subject = subject
+	grant.Scope = scope
+	grant.AMR = amr
+	grant.ApprovedAt = c.now()
+	c.grants[deviceCodeHash] = grant
+
+	return nil
+}
+
+// Poll answers slow_down, and adds 5 seconds to the interval, when the client polls again before
+// the interval has passed.
+func (c deviceStoreImpl) Poll(deviceCodeHash string) (Grant, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	grant, ok := c.grants[deviceCodeHash]
+	if !ok {
+		return Grant{}, common.InvalidGrantError("device code not found")
+	}
+
+	now := c.now()
+
+	if now.After(grant.ExpiresAt) {
+		c.remove(deviceCodeHash, grant)
+
+		return Grant{}, common.ExpiredTokenError(grant.ClientID)
+	}
+
+	if !grant.LastPolledAt.IsZero() && now.Sub(grant.LastPolledAt) < grant.Interval {
+		grant.LastPolledAt = now
+		grant.Interval += slowDownStep
+		c.grants[deviceCodeHash] = grant
+
+		return Grant{}, common.SlowDownError(grant.ClientID)
+	}
+
+	grant.LastPolledAt = now
+	c.grants[deviceCodeHash] = grant
+
+	if grant.Status == StatusApproved {
+		c.remove(deviceCodeHash, grant)
+
+		return grant, nil
+	}
+
+	return Grant{}, common.AuthorizationPendingError(grant.ClientID)
+}
+
+func (c deviceStoreImpl) remove(deviceCodeHash string, grant Grant) {
+	delete(c.userCodes, NormalizeUserCode(grant.UserCode))
+	delete(c.grants, deviceCodeHash)
+}
@@ -0,0 +1,75 @@
+package devicestore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+func Test_Poll(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deviceStoreSrv := deviceStoreImpl{
+		mu:        &sync.Mutex{},
+		grants:    map[string]Grant{},
+		userCodes: map[string]string{},
+		now:       func() time.Time { return now },
+	}
+
+	for hash, userCode := range map[string]string{"approved": "BCDF-GHJK", "expired": "VWXZ-BCDF"} {
+		if err := deviceStoreSrv.Save(hash, Grant{
+			ClientID:  "cli",
+			UserCode:  userCode,
+			Interval:  5 * time.Second,
+			ExpiresAt: now.Add(10 * time.Minute),
+		}); err != nil {
+			t.Fatalf("deviceStoreImpl.Save() error = %v", err)
+		}
+	}
+
+	if err := deviceStoreSrv.Save("duplicate", Grant{UserCode: "bcdfghjk", ExpiresAt: now.Add(time.Minute)}); err == nil {
+		t.Fatalf("deviceStoreImpl.Save() error = nil, want an error for a user code in use")
+	}
+
+	if _, err := deviceStoreSrv.Poll("approved"); !errors.As(err, new(common.AuthorizationPendingError)) {
+		t.Fatalf("deviceStoreImpl.Poll() error = %v, want AuthorizationPendingError", err)
+	}
+
+	if _, err := deviceStoreSrv.Poll("approved"); !errors.As(err, new(common.SlowDownError)) {
+		t.Fatalf("deviceStoreImpl.Poll() error = %v, want SlowDownError", err)
+	}
+
+	if grant, err := deviceStoreSrv.Lookup("bcdf ghjk"); err != nil || grant.Interval != 10*time.Second {
+		t.Fatalf("deviceStoreImpl.Lookup() = %v, %v, want the grant with a 10s interval", grant, err)
+	}
+
+	if err := deviceStoreSrv.Approve("bcdf-ghjk", "alice", []string{"sum:write"}, []string{"pwd"}); err != nil {
+		t.Fatalf("deviceStoreImpl.Approve() error = %v", err)
+	}
+
+	if err := deviceStoreSrv.Approve("BCDFGHJK", "mallory", nil, nil); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("deviceStoreImpl.Approve() error = %v, want InvalidGrantError for an approved code", err)
+	}
+
+	now = now.Add(10 * time.Second)
+
+	if grant, err := deviceStoreSrv.Poll("approved"); err != nil || grant.Subject != "alice" || len(grant.AMR) != 1 {
+		t.Fatalf("deviceStoreImpl.Poll() = %v, %v, want the grant of alice with its amr", grant, err)
+	}
+
+	// approved device codes are single use
+	if _, err := deviceStoreSrv.Poll("approved"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("deviceStoreImpl.Poll() error = %v, want InvalidGrantError for a redeemed code", err)
+	}
+
+	now = now.Add(10 * time.Minute)
+
+	if _, err := deviceStoreSrv.Poll("expired"); !errors.As(err, new(common.ExpiredTokenError)) {
+		t.Fatalf("deviceStoreImpl.Poll() error = %v, want ExpiredTokenError", err)
+	}
+}
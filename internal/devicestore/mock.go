@@ -0,0 +1,49 @@
+package devicestore
+
+type DeviceStoreClientImplMock struct {
+	SaveFn    func(deviceCodeHash string, grant Grant) error
+	LookupFn  func(userCode string) (Grant, error)
+	ApproveFn func(userCode, subject string, scope, amr []string) error
+
+	PollFn func(deviceCodeHash string) (Grant, error)
+}
+
+func (c *DeviceStoreClientImplMock) Save(deviceCodeHash string, grant Grant) error {
+	if c != nil && c.SaveFn != nil {
+		return c.SaveFn(deviceCodeHash, grant)
+	}
+
+	deviceStoreSrv := New()
+
+	return deviceStoreSrv.Save(deviceCodeHash, grant)
+}
+
+func (c *DeviceStoreClientImplMock) Lookup(userCode string) (Grant, error) {
+	if c != nil && c.LookupFn != nil {
+		return c.LookupFn(userCode)
+	}
+
+	deviceStoreSrv := New()
+
+	return deviceStoreSrv.Lookup(userCode)
+}
+
+func (c *DeviceStoreClientImplMock) Approve(userCode, subject string, scope, amr []string) error {
+	if c != nil && c.ApproveFn != nil {
+		return c.ApproveFn(userCode, subject, scope, amr)
+	}
+
+	deviceStoreSrv := New()
+
+	return deviceStoreSrv.Approve(userCode, subject, scope, amr)
+}
+
+func (c *DeviceStoreClientImplMock) Poll(deviceCodeHash string) (Grant, error) {
+	if c != nil && c.PollFn != nil {
+		return c.PollFn(deviceCodeHash)
+	}
+
+	deviceStoreSrv := New()
+
+	return deviceStoreSrv.Poll(deviceCodeHash)
+}
@@ -0,0 +1,121 @@
+package docstore
+
+import (
+	"sync"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/provider/jsonprovider"
+)
+
+// Document is a stored document with the sum it had when it was stored, Version increases by one
+// on every change.
+type Document struct {
+	ID       string      `json:"id"`
+	Document interface{} `json:"document"`
+	Sum      int         `json:"sum"`
+	Version  int         `json:"version"`
+}
+
+// UpdateFunc returns the new document and sum from the current one, returning an error leaves the
+// stored document unchanged.
+type UpdateFunc func(current Document) (interface{}, int, error)
+
+// Service stores the documents of each owner under their own ids, an owner never sees the
+// documents of another one.
+type Service interface {
+	Get(owner, id string) (Document, error)
+	Put(owner, id string, document interface{}, sum int) Document
+	Update(owner, id string, updateFn UpdateFunc) (Document, error)
+	Delete(owner, id string) error
+}
+
+// documentKey is the id of a document within the documents of its owner.
+type documentKey struct {
+	owner string
+	id    string
+}
+
+// docStoreImpl keeps documents in memory, documents are copied in and out so callers can never
+// change a stored document in place.
+type docStoreImpl struct {
+	mu        *sync.Mutex
+	documents map[documentKey]Document
+}
+
+// verify interface compliance
+var _ Service = (*docStoreImpl)(nil)
+
+func New() docStoreImpl {
+	return docStoreImpl{
+		mu:        &sync.Mutex{},
+		documents: map[documentKey]Document{},
+	}
+}
+
+func (c docStoreImpl) Get(owner, id string) (Document, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stored, ok := c.documents[documentKey{owner: owner, id: id}]
+	if !ok {
+		return Document{}, common.DocumentNotFoundError(id)
+	}
+
+	return copyDocument(stored), nil
+}
+
+func (c docStoreImpl) Put(owner, id string, document interface{}, sum int) Document {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := documentKey{owner: owner, id: id}
+
+	stored := Document{ID: id, Document: jsonprovider.DeepCopy(document), Sum: sum, Version: c.documents[key].Version + 1}
+	c.documents[key] = stored
+
+	return copyDocument(stored)
+}
+
+// Update runs updateFn while holding the lock so concurrent updates of a document never lose a change.
+func (c docStoreImpl) Update(owner, id string, updateFn UpdateFunc) (Document, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := documentKey{owner: owner, id: id}
+
+	current, ok := c.documents[key]
+	if !ok {
+		return Document{}, common.DocumentNotFoundError(id)
+	}
+
+	document, sum, err := updateFn(copyDocument(current))
+	if err != nil {
+		return Document{}, err
+	}
+
+	stored := Document{ID: id, Document: jsonprovider.DeepCopy(document), Sum: sum, Version: current.Version + 1}
+	c.documents[key] = stored
+
+	return copyDocument(stored), nil
+}
+
+func (c docStoreImpl) Delete(owner, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := documentKey{owner: owner, id: id}
+
+	if _, ok := c.documents[key]; !ok {
+		return common.DocumentNotFoundError(id)
+	}
+
+	delete(c.documents, key)
+
+	return nil
+}
+
+func copyDocument(document Document) Document {
+	document.Document = jsonprovider.DeepCopy(document.Document)
+
+	return document
+}
@@ -0,0 +1,104 @@
+package docstore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-wai-wong/common"
+)
+
+func Test_PutGet(t *testing.T) {
+	t.Parallel()
+
+	docStoreSrv := New()
+
+	document := map[string]interface{}{"a": []interface{}{float64(1), float64(2)}}
+
+	stored := docStoreSrv.Put("alice", "doc", document, 3)
+	if stored.ID != "doc" || stored.Sum != 3 || stored.Version != 1 {
+		t.Fatalf("docStoreImpl.Put() = %+v, want doc with sum 3 and version 1", stored)
+	}
+
+	// the stored document is a copy of the one put
+	document["a"] = "changed"
+
+	got, err := docStoreSrv.Get("alice", "doc")
+	if err != nil || !reflect.DeepEqual(got.Document, map[string]interface{}{"a": []interface{}{float64(1), float64(2)}}) {
+		t.Fatalf("docStoreImpl.Get() = %+v, %v, want the document as it was put", got, err)
+	}
+
+	// and so is the one returned
+	got.Document.(map[string]interface{})["a"] = "changed"
+
+	if got, _ := docStoreSrv.Get("alice", "doc"); got.Document.(map[string]interface{})["a"] == "changed" {
+		t.Fatalf("docStoreImpl.Get() = %+v, want the stored document unchanged", got)
+	}
+
+	if stored := docStoreSrv.Put("alice", "doc", document, 0); stored.Version != 2 {
+		t.Fatalf("docStoreImpl.Put() version = %v, want 2", stored.Version)
+	}
+
+	if _, err := docStoreSrv.Get("alice", "unknown"); !errors.As(err, new(common.DocumentNotFoundError)) {
+		t.Fatalf("docStoreImpl.Get() error = %v, want DocumentNotFoundError", err)
+	}
+}
+
+func Test_Owners(t *testing.T) {
+	t.Parallel()
+
+	docStoreSrv := New()
+
+	docStoreSrv.Put("alice", "doc", "alice document", 0)
+	docStoreSrv.Put("bob", "doc", "bob document", 0)
+
+	if got, err := docStoreSrv.Get("alice", "doc"); err != nil || got.Document != "alice document" || got.Version != 1 {
+		t.Fatalf("docStoreImpl.Get() = %+v, %v, want the document of alice", got, err)
+	}
+
+	if _, err := docStoreSrv.Update("mallory", "doc", func(current Document) (interface{}, int, error) {
+		return "mallory document", 0, nil
+	}); !errors.As(err, new(common.DocumentNotFoundError)) {
+		t.Fatalf("docStoreImpl.Update() error = %v, want DocumentNotFoundError for a document of another owner", err)
+	}
+
+	if err := docStoreSrv.Delete("mallory", "doc"); !errors.As(err, new(common.DocumentNotFoundError)) {
+		t.Fatalf("docStoreImpl.Delete() error = %v, want DocumentNotFoundError for a document of another owner", err)
+	}
+
+	if err := docStoreSrv.Delete("bob", "doc"); err != nil {
+		t.Fatalf("docStoreImpl.Delete() error = %v", err)
+	}
+
+	if _, err := docStoreSrv.Get("alice", "doc"); err != nil {
+		t.Fatalf("docStoreImpl.Get() error = %v, want the document of alice to be kept", err)
+	}
+}
+
+func Test_Update(t *testing.T) {
+	t.Parallel()
+
+	docStoreSrv := New()
+
+	docStoreSrv.Put("alice", "doc", float64(1), 1)
+
+	updated, err := docStoreSrv.Update("alice", "doc", func(current Document) (interface{}, int, error) {
+		return current.Document.(float64) + 1, current.Sum + 1, nil
+	})
+	if err != nil || updated.Document != float64(2) || updated.Sum != 2 || updated.Version != 2 {
+		t.Fatalf("docStoreImpl.Update() = %+v, %v, want 2 with version 2", updated, err)
+	}
+
+	updateErr := errors.New("update failed")
+
+	if _, err := docStoreSrv.Update("alice", "doc", func(current Document) (interface{}, int, error) {
+		return nil, 0, updateErr
+	}); !errors.Is(err, updateErr) {
+		t.Fatalf("docStoreImpl.Update() error = %v, want the error of the update", err)
+	}
+
+	// a failed update leaves the document unchanged
+	if got, err := docStoreSrv.Get("alice", "doc"); err != nil || got.Document != float64(2) || got.Version != 2 {
+		t.Fatalf("docStoreImpl.Get() = %+v, %v, want 2 with version 2", got, err)
+	}
+}
@@ -0,0 +1,48 @@
+package docstore
+
+type DocStoreClientImplMock struct {
+	GetFn    func(owner, id string) (Document, error)
+	PutFn    func(owner, id string, document interface{}, sum int) Document
+	UpdateFn func(owner, id string, updateFn UpdateFunc) (Document, error)
+	DeleteFn func(owner, id string) error
+}
+
+func (c *DocStoreClientImplMock) Get(owner, id string) (Document, error) {
+	if c != nil && c.GetFn != nil {
+		return c.GetFn(owner, id)
+	}
+
+	docStoreSrv := New()
+
+	return docStoreSrv.Get(owner, id)
+}
+
+func (c *DocStoreClientImplMock) Put(owner, id string, document interface{}, sum int) Document {
+	if c != nil && c.PutFn != nil {
+		return c.PutFn(owner, id, document, sum)
+	}
+
+	docStoreSrv := New()
+
+	return docStoreSrv.Put(owner, id, document, sum)
+}
+
+func (c *DocStoreClientImplMock) Update(owner, id string, updateFn UpdateFunc) (Document, error) {
+	if c != nil && c.UpdateFn != nil {
+		return c.UpdateFn(owner, id, updateFn)
+	}
+
+	docStoreSrv := New()
+
+	return docStoreSrv.Update(owner, id, updateFn)
+}
+
+func (c *DocStoreClientImplMock) Delete(owner, id string) error {
+	if c != nil && c.DeleteFn != nil {
+		return c.DeleteFn(owner, id)
+	}
+
+	docStoreSrv := New()
+
+	return docStoreSrv.Delete(owner, id)
+}
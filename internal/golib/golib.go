@@ -5,6 +5,8 @@ type Service interface {
 	IOClient
 	JSONClient
 	JwtClient
+	OSClient
+	TimeClient
 }
 
 // verify interface compliance
@@ -7,8 +7,12 @@ type JwtClient interface {
 	StandardClaims(subject string, expiresAt int64, audience string) jwt.StandardClaims
 }
 
+// ParseWithClaims only checks the signature, the registered claims are validated by the caller
+// against the Now of golib, which unlike the jwt package allows a clock skew and a test clock.
 func (c goLibImpl) ParseWithClaims(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
-	return jwt.ParseWithClaims(tokenString, claims, keyFunc)
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	return parser.ParseWithClaims(tokenString, claims, keyFunc)
 }
 
 func (c goLibImpl) StandardClaims(subject string, expiresAt int64, audience string) jwt.StandardClaims {
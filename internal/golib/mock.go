@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 )
@@ -15,6 +17,8 @@ type GoLibImplMock struct {
 	CopyFn                    func(dst io.Writer, src io.Reader) (written int64, err error)
 	UnmarshalFn               func(data []byte, v interface{}) error
 	MarshalFn                 func(v interface{}) ([]byte, error)
+	ReadFileFn                func(name string) ([]byte, error)
+	NowFn                     func() time.Time
 }
 
 func (c *GoLibImplMock) StdEncodingDecodeString(s string) ([]byte, error) {
@@ -30,7 +34,9 @@ func (c *GoLibImplMock) ParseWithClaims(tokenString string, claims jwt.Claims, k
 		return c.ParseWithClaimsFn(tokenString, claims, keyFunc)
 	}
 
-	return jwt.ParseWithClaims(tokenString, claims, keyFunc)
+	goLibSrv := New()
+
+	return goLibSrv.ParseWithClaims(tokenString, claims, keyFunc)
 }
 
 func (c *GoLibImplMock) StandardClaims(subject string, expiresAt int64, audience string) jwt.StandardClaims {
@@ -66,3 +72,19 @@ func (c *GoLibImplMock) Marshal(v interface{}) ([]byte, error) {
 
 	return json.Marshal(v)
 }
+
+func (c *GoLibImplMock) ReadFile(name string) ([]byte, error) {
+	if c != nil && c.ReadFileFn != nil {
+		return c.ReadFileFn(name)
+	}
+
+	return os.ReadFile(name)
+}
+
+func (c *GoLibImplMock) Now() time.Time {
+	if c != nil && c.NowFn != nil {
+		return c.NowFn()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,11 @@
+package golib
+
+import "os"
+
+type OSClient interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+func (c goLibImpl) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
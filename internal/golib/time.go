@@ -0,0 +1,11 @@
+package golib
+
+import "time"
+
+type TimeClient interface {
+	Now() time.Time
+}
+
+func (c goLibImpl) Now() time.Time {
+	return time.Now()
+}
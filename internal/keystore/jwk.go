@@ -0,0 +1,81 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the public half of a signing key as an RFC 7517 JSON Web Key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK converts the public key of key to a JWK.
+func PublicJWK(key Key) (JWK, error) {
+	jwk := JWK{Use: "sig", Alg: key.Algorithm, Kid: key.ID}
+
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64URL(publicKey.N.Bytes())
+		jwk.E = encodeBase64URL(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+
+		jwk.Kty = "EC"
+		jwk.Crv = publicKey.Curve.Params().Name
+		jwk.X = encodeBase64URL(publicKey.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeBase64URL(publicKey.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64URL(publicKey)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type: %T", key.PublicKey)
+	}
+
+	return jwk, nil
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint of the public key of jwk, a kid that stays the
+// same for as long as the key does.
+func Thumbprint(jwk JWK) (string, error) {
+	var members string
+
+	// the required members in lexicographic order, the values are base64url so need no escaping
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.Kty, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	default:
+		return "", fmt.Errorf("unsupported key type: %v", jwk.Kty)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+
+	return encodeBase64URL(sum[:]), nil
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
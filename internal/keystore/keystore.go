@@ -0,0 +1,376 @@
+package keystore
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+const (
+	keyFileExt = ".pem"
+	// rotationCheckInterval is the longest RotateEvery waits between checking if a rotation is due.
+	rotationCheckInterval = time.Minute
+)
+
+// Key is a signing key loaded from the key directory, the newest key is the active one and every
+// older key retires when the key after it is activated.
+type Key struct {
+	ID          string
+	Algorithm   string
+	PrivateKey  crypto.Signer
+	PublicKey   crypto.PublicKey
+	ActivatedAt time.Time
+	// RetiredAt is zero for the active key.
+	RetiredAt time.Time
+}
+
+type Service interface {
+	SigningKey() (Key, error)
+	VerificationKey(kid string) (Key, error)
+	PublicKeys() []Key
+	JWKS() (JWKSet, error)
+	Reload() error
+	Rotate() (Key, error)
+}
+
+// keyStoreImpl keeps the keys of a directory holding one <kid>.pem private key per key, a key is
+// activated at its file modification time. Retired keys are still published and accepted for the
+// overlap window so tokens signed just before a rotation stay valid until they expire.
+type keyStoreImpl struct {
+	directory string
+	algorithm string
+	overlap   time.Duration
+	now       func() time.Time
+	mu        *sync.RWMutex
+	keys      *[]Key
+}
+
+// verify interface compliance
+var _ Service = (*keyStoreImpl)(nil)
+
+func New() keyStoreImpl {
+	return newKeyStore(
+		viper.GetString(constant.TokenKeyDirectory),
+		viper.GetString(constant.TokenAlgorithm),
+		viper.GetDuration(constant.TokenKeyOverlap),
+		time.Now,
+	)
+}
+
+func newKeyStore(directory, algorithm string, overlap time.Duration, now func() time.Time) keyStoreImpl {
+	return keyStoreImpl{
+		directory: directory,
+		algorithm: algorithm,
+		overlap:   overlap,
+		now:       now,
+		mu:        &sync.RWMutex{},
+		keys:      &[]Key{},
+	}
+}
+
+// SigningKey returns the active key.
+func (c keyStoreImpl) SigningKey() (Key, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := *c.keys
+	if len(keys) == 0 {
+		return Key{}, common.KeyNotFoundError("")
+	}
+
+	return keys[len(keys)-1], nil
+}
+
+// VerificationKey returns the active key or a retired key still inside the overlap window.
+func (c keyStoreImpl) VerificationKey(kid string) (Key, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+
+	for _, key := range *c.keys {
+		if key.ID == kid && c.usable(key, now) {
+			return key, nil
+		}
+	}
+
+	return Key{}, common.KeyNotFoundError(kid)
+}
+
+// PublicKeys returns the keys VerificationKey accepts, oldest first.
+func (c keyStoreImpl) PublicKeys() []Key {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	keys := []Key{}
+
+	for _, key := range *c.keys {
+		if c.usable(key, now) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (c keyStoreImpl) JWKS() (JWKSet, error) {
+	jwks := JWKSet{Keys: []JWK{}}
+
+	for _, key := range c.PublicKeys() {
+		jwk, err := PublicJWK(key)
+		if err != nil {
+			return JWKSet{}, err
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks, nil
+}
+
+func (c keyStoreImpl) usable(key Key, now time.Time) bool {
+	return key.RetiredAt.IsZero() || now.Before(key.RetiredAt.Add(c.overlap))
+}
+
+// Reload reads the key directory again, keys past their overlap window are left out.
+func (c keyStoreImpl) Reload() error {
+	keys, err := c.readKeys()
+	if err != nil {
+		return err
+	}
+
+	now := c.now()
+	usable := []Key{}
+
+	for _, key := range keys {
+		if c.usable(key, now) {
+			usable = append(usable, key)
+		}
+	}
+
+	c.mu.Lock()
+	*c.keys = usable
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Rotate writes a new active key to the key directory, removes the files of keys past their
+// overlap window and reloads the directory.
+func (c keyStoreImpl) Rotate() (Key, error) {
+	privateKey, err := GenerateKey(c.algorithm)
+	if err != nil {
+		return Key{}, err
+	}
+
+	pemBytes, err := EncodePrivateKeyPEM(privateKey)
+	if err != nil {
+		return Key{}, err
+	}
+
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return Key{}, fmt.Errorf("failed to generate kid: %w", err)
+	}
+
+	kid := hex.EncodeToString(kidBytes)
+
+	// write to a temporary file first so the watcher never reads a half written key
+	tmpPath := filepath.Join(c.directory, "."+kid+keyFileExt+".tmp")
+	if err := os.WriteFile(tmpPath, pemBytes, 0o600); err != nil {
+		return Key{}, fmt.Errorf("failed to write key: %w", err)
+	}
+
+	activatedAt := c.now()
+	if err := os.Chtimes(tmpPath, activatedAt, activatedAt); err != nil {
+		return Key{}, fmt.Errorf("failed to set key activation time: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(c.directory, kid+keyFileExt)); err != nil {
+		return Key{}, fmt.Errorf("failed to move key into place: %w", err)
+	}
+
+	if err := c.removeExpired(); err != nil {
+		return Key{}, err
+	}
+
+	if err := c.Reload(); err != nil {
+		return Key{}, err
+	}
+
+	return c.VerificationKey(kid)
+}
+
+func (c keyStoreImpl) removeExpired() error {
+	keys, err := c.readKeys()
+	if err != nil {
+		return err
+	}
+
+	now := c.now()
+
+	for _, key := range keys {
+		if c.usable(key, now) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(c.directory, key.ID+keyFileExt)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove retired key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readKeys reads every key in the directory, oldest first, with RetiredAt set from the activation
+// of the next key. Files that are not valid keys are logged and skipped.
+func (c keyStoreImpl) readKeys() ([]Key, error) {
+	entries, err := os.ReadDir(c.directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	keys := []Key{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != keyFileExt {
+			continue
+		}
+
+		key, err := c.readKey(name)
+		if err != nil {
+			log.Printf("skipping key file %v: %v", name, err)
+
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ActivatedAt.Equal(keys[j].ActivatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+
+		return keys[i].ActivatedAt.Before(keys[j].ActivatedAt)
+	})
+
+	for index := 0; index < len(keys)-1; index++ {
+		keys[index].RetiredAt = keys[index+1].ActivatedAt
+	}
+
+	return keys, nil
+}
+
+func (c keyStoreImpl) readKey(name string) (Key, error) {
+	path := filepath.Join(c.directory, name)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	privateKey, err := ParsePrivateKeyPEM(c.algorithm, pemBytes)
+	if err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		ID:          strings.TrimSuffix(name, keyFileExt),
+		Algorithm:   c.algorithm,
+		PrivateKey:  privateKey,
+		PublicKey:   privateKey.Public(),
+		ActivatedAt: info.ModTime(),
+	}, nil
+}
+
+// Watch reloads the keys whenever a key file in the directory changes, until ctx is done.
+func (c keyStoreImpl) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(c.directory); err != nil {
+		return fmt.Errorf("failed to watch key directory: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if filepath.Ext(event.Name) != keyFileExt {
+				continue
+			}
+
+			if err := c.Reload(); err != nil {
+				log.Printf("failed to reload keys: %v", err)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			log.Printf("key directory watcher error: %v", err)
+		}
+	}
+}
+
+// RotateEvery rotates the active key once it is older than interval, until ctx is done.
+func (c keyStoreImpl) RotateEvery(ctx context.Context, interval time.Duration) {
+	checkInterval := interval
+	if checkInterval > rotationCheckInterval {
+		checkInterval = rotationCheckInterval
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if c.rotationDue(interval) {
+			if _, err := c.Rotate(); err != nil {
+				log.Printf("failed to rotate key: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c keyStoreImpl) rotationDue(interval time.Duration) bool {
+	key, err := c.SigningKey()
+
+	return err != nil || c.now().Sub(key.ActivatedAt) >= interval
+}
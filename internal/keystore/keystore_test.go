@@ -0,0 +1,233 @@
+package keystore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func Test_Rotate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		algorithm string
+	}{
+		{name: "rotate-rs256", algorithm: AlgorithmRS256},
+		{name: "rotate-es256", algorithm: AlgorithmES256},
+		{name: "rotate-eddsa", algorithm: AlgorithmEdDSA},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			directory := t.TempDir()
+			keyStoreSrv := newKeyStore(directory, tt.algorithm, 2*time.Hour, clock.Now)
+
+			if _, err := keyStoreSrv.SigningKey(); !errors.As(err, new(common.KeyNotFoundError)) {
+				t.Fatalf("keyStoreImpl.SigningKey() error = %v, want KeyNotFoundError", err)
+			}
+
+			first, err := keyStoreSrv.Rotate()
+			if err != nil {
+				t.Fatalf("keyStoreImpl.Rotate() error = %v", err)
+			}
+
+			clock.now = clock.now.Add(time.Hour)
+
+			second, err := keyStoreSrv.Rotate()
+			if err != nil {
+				t.Fatalf("keyStoreImpl.Rotate() error = %v", err)
+			}
+
+			signingKey, err := keyStoreSrv.SigningKey()
+			if err != nil || signingKey.ID != second.ID {
+				t.Fatalf("keyStoreImpl.SigningKey() = %v, %v, want %v", signingKey.ID, err, second.ID)
+			}
+
+			// the first key retired an hour ago and is still inside the two hour overlap
+			if _, err := keyStoreSrv.VerificationKey(first.ID); err != nil {
+				t.Fatalf("keyStoreImpl.VerificationKey() error = %v, want retired key inside overlap", err)
+			}
+
+			jwks, err := keyStoreSrv.JWKS()
+			if err != nil || len(jwks.Keys) != 2 {
+				t.Fatalf("keyStoreImpl.JWKS() = %v, %v, want 2 keys", jwks, err)
+			}
+
+			clock.now = clock.now.Add(3 * time.Hour)
+
+			if _, err := keyStoreSrv.VerificationKey(first.ID); !errors.As(err, new(common.KeyNotFoundError)) {
+				t.Fatalf("keyStoreImpl.VerificationKey() error = %v, want KeyNotFoundError past overlap", err)
+			}
+
+			if publicKeys := keyStoreSrv.PublicKeys(); len(publicKeys) != 1 || publicKeys[0].ID != second.ID {
+				t.Fatalf("keyStoreImpl.PublicKeys() = %v, want only %v", publicKeys, second.ID)
+			}
+
+			third, err := keyStoreSrv.Rotate()
+			if err != nil {
+				t.Fatalf("keyStoreImpl.Rotate() error = %v", err)
+			}
+
+			// rotating removes the files of keys past their overlap
+			if _, err := os.Stat(filepath.Join(directory, first.ID+keyFileExt)); !os.IsNotExist(err) {
+				t.Fatalf("retired key file %v still exists, err = %v", first.ID, err)
+			}
+
+			for _, kid := range []string{second.ID, third.ID} {
+				if _, err := keyStoreSrv.VerificationKey(kid); err != nil {
+					t.Fatalf("keyStoreImpl.VerificationKey(%v) error = %v", kid, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_Reload(t *testing.T) {
+	t.Parallel()
+
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	directory := t.TempDir()
+	keyStoreSrv := newKeyStore(directory, AlgorithmES256, time.Hour, clock.Now)
+
+	writeKey := func(kid string, algorithm string, activatedAt time.Time) {
+		t.Helper()
+
+		privateKey, err := GenerateKey(algorithm)
+		if err != nil {
+			t.Fatalf("GenerateKey() error = %v", err)
+		}
+
+		pemBytes, err := EncodePrivateKeyPEM(privateKey)
+		if err != nil {
+			t.Fatalf("EncodePrivateKeyPEM() error = %v", err)
+		}
+
+		path := filepath.Join(directory, kid+keyFileExt)
+		if err := os.WriteFile(path, pemBytes, 0o600); err != nil {
+			t.Fatalf("failed to write key: %v", err)
+		}
+
+		if err := os.Chtimes(path, activatedAt, activatedAt); err != nil {
+			t.Fatalf("failed to set key time: %v", err)
+		}
+	}
+
+	writeKey("old", AlgorithmES256, clock.now.Add(-3*time.Hour))
+	writeKey("previous", AlgorithmES256, clock.now.Add(-2*time.Hour))
+	writeKey("active", AlgorithmES256, clock.now.Add(-30*time.Minute))
+	writeKey("wrongAlgorithm", AlgorithmEdDSA, clock.now)
+
+	if err := os.WriteFile(filepath.Join(directory, "notes.txt"), []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := keyStoreSrv.Reload(); err != nil {
+		t.Fatalf("keyStoreImpl.Reload() error = %v", err)
+	}
+
+	signingKey, err := keyStoreSrv.SigningKey()
+	if err != nil || signingKey.ID != "active" {
+		t.Fatalf("keyStoreImpl.SigningKey() = %v, %v, want active", signingKey.ID, err)
+	}
+
+	// previous retired 30 minutes ago, old retired 2 hours ago and is past the 1 hour overlap
+	publicKeys := keyStoreSrv.PublicKeys()
+	if len(publicKeys) != 2 || publicKeys[0].ID != "previous" || publicKeys[1].ID != "active" {
+		t.Fatalf("keyStoreImpl.PublicKeys() = %v, want previous and active", publicKeys)
+	}
+
+	missing := newKeyStore(filepath.Join(directory, "missing"), AlgorithmES256, time.Hour, clock.Now)
+	if err := missing.Reload(); err == nil {
+		t.Fatalf("keyStoreImpl.Reload() error = nil, want error for missing directory")
+	}
+}
+
+func Test_PublicJWK(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		algorithm   string
+		expectedKty string
+		expectedCrv string
+	}{
+		{name: "publicJWK-rs256", algorithm: AlgorithmRS256, expectedKty: "RSA"},
+		{name: "publicJWK-es256", algorithm: AlgorithmES256, expectedKty: "EC", expectedCrv: "P-256"},
+		{name: "publicJWK-eddsa", algorithm: AlgorithmEdDSA, expectedKty: "OKP", expectedCrv: "Ed25519"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			privateKey, err := GenerateKey(tt.algorithm)
+			if err != nil {
+				t.Fatalf("GenerateKey() error = %v", err)
+			}
+
+			jwk, err := PublicJWK(Key{ID: "kid", Algorithm: tt.algorithm, PublicKey: privateKey.Public()})
+			if err != nil {
+				t.Fatalf("PublicJWK() error = %v", err)
+			}
+
+			if jwk.Kty != tt.expectedKty || jwk.Crv != tt.expectedCrv || jwk.Kid != "kid" || jwk.Alg != tt.algorithm {
+				t.Fatalf("PublicJWK() = %+v, want kty %v crv %v", jwk, tt.expectedKty, tt.expectedCrv)
+			}
+
+			if tt.expectedKty == "RSA" && (jwk.N == "" || jwk.E != "AQAB") {
+				t.Fatalf("PublicJWK() = %+v, want n and e", jwk)
+			}
+
+			if tt.expectedKty != "RSA" && jwk.X == "" {
+				t.Fatalf("PublicJWK() = %+v, want x", jwk)
+			}
+		})
+	}
+}
+
+func Test_Thumbprint(t *testing.T) {
+	t.Parallel()
+
+	// the example of RFC 7638 section 3.1
+	jwk := JWK{
+		Kty: "RSA",
+		Kid: "2011-04-29",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1" +
+			"n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E: "AQAB",
+	}
+
+	thumbprint, err := Thumbprint(jwk)
+	if err != nil {
+		t.Fatalf("Thumbprint() error = %v", err)
+	}
+
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("Thumbprint() = %v, want the thumbprint of RFC 7638", thumbprint)
+	}
+
+	if _, err := Thumbprint(JWK{Kty: "oct"}); err == nil {
+		t.Fatalf("Thumbprint() error = nil, want an error for unsupported key types")
+	}
+}
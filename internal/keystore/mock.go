@@ -0,0 +1,70 @@
+package keystore
+
+type KeyStoreClientImplMock struct {
+	SigningKeyFn      func() (Key, error)
+	VerificationKeyFn func(kid string) (Key, error)
+	PublicKeysFn      func() []Key
+	JWKSFn            func() (JWKSet, error)
+	ReloadFn          func() error
+	RotateFn          func() (Key, error)
+}
+
+func (c *KeyStoreClientImplMock) SigningKey() (Key, error) {
+	if c != nil && c.SigningKeyFn != nil {
+		return c.SigningKeyFn()
+	}
+
+	keyStoreSrv := New()
+
+	return keyStoreSrv.SigningKey()
+}
+
+func (c *KeyStoreClientImplMock) VerificationKey(kid string) (Key, error) {
+	if c != nil && c.VerificationKeyFn != nil {
+		return c.VerificationKeyFn(kid)
+	}
+
+	keyStoreSrv := New()
+
+	return keyStoreSrv.VerificationKey(kid)
+}
+
+func (c *KeyStoreClientImplMock) PublicKeys() []Key {
+	if c != nil && c.PublicKeysFn != nil {
+		return c.PublicKeysFn()
+	}
+
+	keyStoreSrv := New()
+
+	return keyStoreSrv.PublicKeys()
+}
+
+func (c *KeyStoreClientImplMock) JWKS() (JWKSet, error) {
+	if c != nil && c.JWKSFn != nil {
+		return c.JWKSFn()
+	}
+
+	keyStoreSrv := New()
+
+	return keyStoreSrv.JWKS()
+}
+
+func (c *KeyStoreClientImplMock) Reload() error {
+	if c != nil && c.ReloadFn != nil {
+		return c.ReloadFn()
+	}
+
+	keyStoreSrv := New()
+
+	return keyStoreSrv.Reload()
+}
+
+func (c *KeyStoreClientImplMock) Rotate() (Key, error) {
+	if c != nil && c.RotateFn != nil {
+		return c.RotateFn()
+	}
+
+	keyStoreSrv := New()
+
+	return keyStoreSrv.Rotate()
+}
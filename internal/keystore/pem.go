@@ -0,0 +1,131 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+)
+
+// SigningMethod returns the jwt signing method for algorithm.
+func SigningMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmHS256:
+		return jwt.SigningMethodHS256, nil
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmES256:
+		return jwt.SigningMethodES256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm: %v", algorithm)
+}
+
+// ParsePrivateKeyPEM parses a PEM private key for one of the asymmetric algorithms, ES256 keys
+// must be on the P-256 curve.
+func ParsePrivateKeyPEM(algorithm string, pemBytes []byte) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+	case AlgorithmES256:
+		privateKey, err := jwt.ParseECPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkCurve(&privateKey.PublicKey); err != nil {
+			return nil, err
+		}
+
+		return privateKey, nil
+	case AlgorithmEdDSA:
+		privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("EdDSA private key is not a signer")
+		}
+
+		return signer, nil
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm: %v", algorithm)
+}
+
+// ParsePublicKeyPEM parses a PEM public key for one of the asymmetric algorithms.
+func ParsePublicKeyPEM(algorithm string, pemBytes []byte) (crypto.PublicKey, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+	case AlgorithmES256:
+		publicKey, err := jwt.ParseECPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkCurve(publicKey); err != nil {
+			return nil, err
+		}
+
+		return publicKey, nil
+	case AlgorithmEdDSA:
+		return jwt.ParseEdPublicKeyFromPEM(pemBytes)
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm: %v", algorithm)
+}
+
+// GenerateKey generates a new private key for one of the asymmetric algorithms.
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+
+		return privateKey, err
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm: %v", algorithm)
+}
+
+// EncodePrivateKeyPEM encodes a private key as a PKCS #8 PEM block.
+func EncodePrivateKeyPEM(privateKey crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func checkCurve(publicKey *ecdsa.PublicKey) error {
+	if publicKey.Curve != elliptic.P256() {
+		return fmt.Errorf("ES256 needs a P-256 key, found: %v", publicKey.Curve.Params().Name)
+	}
+
+	return nil
+}
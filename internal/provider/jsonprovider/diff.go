@@ -0,0 +1,69 @@
+package jsonprovider
+
+const (
+	LeafAdded   = "added"
+	LeafRemoved = "removed"
+	LeafChanged = "changed"
+)
+
+// LeafChange is a numeric leaf that differs between two documents, Before is nil for added leaves
+// and After is nil for removed ones.
+type LeafChange struct {
+	Path   string   `json:"path"`
+	Change string   `json:"change"`
+	Before *float64 `json:"before,omitempty"`
+	After  *float64 `json:"after,omitempty"`
+}
+
+// DiffNumericLeaves compares the numbers of two documents by JSON Pointer, a number replaced by
+// any other type counts as removed. Removed and changed leaves come first in before's walking
+// order, followed by added leaves in after's walking order.
+func (c jsonProviderImpl) DiffNumericLeaves(before, after interface{}) ([]LeafChange, error) {
+	beforePointers, beforeLeaves, err := c.numericLeaves(before)
+	if err != nil {
+		return nil, err
+	}
+
+	afterPointers, afterLeaves, err := c.numericLeaves(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []LeafChange{}
+
+	for _, pointer := range beforePointers {
+		beforeValue := beforeLeaves[pointer]
+
+		afterValue, ok := afterLeaves[pointer]
+		if !ok {
+			changes = append(changes, LeafChange{Path: pointer, Change: LeafRemoved, Before: &beforeValue})
+		} else if afterValue != beforeValue {
+			changes = append(changes, LeafChange{Path: pointer, Change: LeafChanged, Before: &beforeValue, After: &afterValue})
+		}
+	}
+
+	for _, pointer := range afterPointers {
+		if _, ok := beforeLeaves[pointer]; !ok {
+			afterValue := afterLeaves[pointer]
+			changes = append(changes, LeafChange{Path: pointer, Change: LeafAdded, After: &afterValue})
+		}
+	}
+
+	return changes, nil
+}
+
+func (c jsonProviderImpl) numericLeaves(data interface{}) ([]string, map[string]float64, error) {
+	pointers := []string{}
+	leaves := map[string]float64{}
+
+	err := c.Walk(data, func(pointer string, value interface{}) error {
+		if number, ok := value.(float64); ok {
+			pointers = append(pointers, pointer)
+			leaves[pointer] = number
+		}
+
+		return nil
+	})
+
+	return pointers, leaves, err
+}
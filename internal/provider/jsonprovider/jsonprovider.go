@@ -2,6 +2,11 @@ package jsonprovider
 
 type Service interface {
 	JSONMapToFloatSliceAs(data map[string]interface{}, out *[]float64)
+	Walk(data interface{}, walkFn WalkFunc) error
+	MerkleProofAs(data interface{}, pointer string, out *MerkleProof) error
+	ApplyJSONPatch(document interface{}, operations []PatchOperation) (interface{}, error)
+	ApplyMergePatch(document interface{}, patch interface{}) interface{}
+	DiffNumericLeaves(before, after interface{}) ([]LeafChange, error)
 }
 
 type jsonProviderImpl struct{}
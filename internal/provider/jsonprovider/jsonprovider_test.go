@@ -1,6 +1,12 @@
 package jsonprovider
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func Test_JSONMapToFloatSliceAs(t *testing.T) {
 	t.Parallel()
@@ -55,3 +61,252 @@ func Test_JSONMapToFloatSliceAs(t *testing.T) {
 		})
 	}
 }
+
+func Test_Walk(t *testing.T) {
+	t.Parallel()
+
+	data := map[string]interface{}{
+		"b":   []interface{}{float64(1), map[string]interface{}{"c": float64(2)}},
+		"a/~": "x",
+	}
+
+	expectedPointers := []string{"", "/a~1~0", "/b", "/b/0", "/b/1", "/b/1/c"}
+
+	pointers := []string{}
+
+	if err := New().Walk(data, func(pointer string, value interface{}) error {
+		pointers = append(pointers, pointer)
+
+		resolved, err := ResolvePointer(data, pointer)
+		if err != nil {
+			t.Fatalf("resolve pointer: %v failed: %v", pointer, err)
+		}
+
+		if fmt.Sprint(resolved) != fmt.Sprint(value) {
+			t.Fatalf("pointer: %v resolved to: %v, walked value: %v", pointer, resolved, value)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	if strings.Join(pointers, ",") != strings.Join(expectedPointers, ",") {
+		t.Fatalf("expected pointers: %v, got: %v", expectedPointers, pointers)
+	}
+}
+
+func Test_MerkleProofAs(t *testing.T) {
+	t.Parallel()
+
+	data := map[string]interface{}{
+		"data1": []interface{}{float64(1), float64(2), float64(3), float64(4)},
+		"data2": map[string]interface{}{"a": float64(6), "b": float64(4)},
+		"data4": map[string]interface{}{"a": map[string]interface{}{"b": float64(4)}, "c": float64(-2)},
+		"data5": "dark",
+		"total": float64(1),
+	}
+
+	tests := []struct {
+		name             string
+		pointer          string
+		expectedSubtotal float64
+		wantErr          bool
+	}{
+		{name: "merkleProof-root", pointer: "", expectedSubtotal: 23},
+		{name: "merkleProof-array", pointer: "/data1", expectedSubtotal: 10},
+		{name: "merkleProof-nestedObject", pointer: "/data4/a", expectedSubtotal: 4},
+		{name: "merkleProof-scalarErr", pointer: "/data5", wantErr: true},
+		{name: "merkleProof-missingErr", pointer: "/data9", wantErr: true},
+		{name: "merkleProof-badPointerErr", pointer: "data1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var proof MerkleProof
+
+			err := New().MerkleProofAs(data, tt.pointer, &proof)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MerkleProofAs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if proof.Subtotal != tt.expectedSubtotal {
+				t.Fatalf("expected subtotal: %v, got: %v", tt.expectedSubtotal, proof.Subtotal)
+			}
+
+			if !VerifyMerkleProof(proof) {
+				t.Fatalf("proof for pointer: %v did not verify", tt.pointer)
+			}
+
+			proof.Subtotal++
+
+			if VerifyMerkleProof(proof) {
+				t.Fatalf("tampered proof for pointer: %v verified", tt.pointer)
+			}
+		})
+	}
+}
+
+func Test_ApplyJSONPatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		document   string
+		operations string
+		expected   string
+		wantErr    bool
+	}{
+		{
+			name:       "applyJSONPatch-addRemoveReplace",
+			document:   `{"a": [1, 2], "b": {"c": 3}}`,
+			operations: `[{"op": "add", "path": "/a/1", "value": 5}, {"op": "add", "path": "/a/-", "value": 9}, {"op": "remove", "path": "/b/c"}, {"op": "replace", "path": "/b", "value": [7]}]`,
+			expected:   `{"a": [1, 5, 2, 9], "b": [7]}`,
+		},
+		{
+			name:       "applyJSONPatch-moveCopyTest",
+			document:   `{"a": {"x": 1}, "b": []}`,
+			operations: `[{"op": "test", "path": "/a/x", "value": 1}, {"op": "copy", "from": "/a/x", "path": "/b/0"}, {"op": "move", "from": "/a", "path": "/c"}]`,
+			expected:   `{"b": [1], "c": {"x": 1}}`,
+		},
+		{
+			name:       "applyJSONPatch-replaceRoot",
+			document:   `{"a": 1}`,
+			operations: `[{"op": "replace", "path": "", "value": [1, 2]}]`,
+			expected:   `[1, 2]`,
+		},
+		{
+			name:       "applyJSONPatch-nullValue",
+			document:   `{"a": 1}`,
+			operations: `[{"op": "add", "path": "/b", "value": null}, {"op": "replace", "path": "/a", "value": null}]`,
+			expected:   `{"a": null, "b": null}`,
+		},
+		{
+			name:       "applyJSONPatch-missingValueErr",
+			document:   `{"a": 1}`,
+			operations: `[{"op": "replace", "path": "/a"}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "applyJSONPatch-testFailsErr",
+			document:   `{"a": 1}`,
+			operations: `[{"op": "test", "path": "/a", "value": 2}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "applyJSONPatch-missingParentErr",
+			document:   `{"a": 1}`,
+			operations: `[{"op": "add", "path": "/b/c", "value": 2}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "applyJSONPatch-indexOutOfRangeErr",
+			document:   `{"a": [1]}`,
+			operations: `[{"op": "add", "path": "/a/3", "value": 2}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "applyJSONPatch-moveIntoChildErr",
+			document:   `{"a": {"b": 1}}`,
+			operations: `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				document   interface{}
+				operations []PatchOperation
+				expected   interface{}
+			)
+
+			mustUnmarshal(t, tt.document, &document)
+			mustUnmarshal(t, tt.operations, &operations)
+
+			original := fmt.Sprint(document)
+
+			patched, err := New().ApplyJSONPatch(document, operations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyJSONPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if fmt.Sprint(document) != original {
+				t.Fatalf("ApplyJSONPatch() modified the original document: %v", document)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			mustUnmarshal(t, tt.expected, &expected)
+
+			if !reflect.DeepEqual(patched, expected) {
+				t.Fatalf("expected patched document: %v, got: %v", expected, patched)
+			}
+		})
+	}
+}
+
+func Test_ApplyMergePatch(t *testing.T) {
+	t.Parallel()
+
+	var document, patch, expected interface{}
+
+	mustUnmarshal(t, `{"title": "Goodbye!", "author": {"givenName": "John", "familyName": "Doe"}, "tags": ["example", "sample"], "content": "This will be unchanged"}`, &document)
+	mustUnmarshal(t, `{"title": "Hello!", "phoneNumber": "+01-123-456-7890", "author": {"familyName": null}, "tags": ["example"]}`, &patch)
+	mustUnmarshal(t, `{"title": "Hello!", "author": {"givenName": "John"}, "tags": ["example"], "content": "This will be unchanged", "phoneNumber": "+01-123-456-7890"}`, &expected)
+
+	if merged := New().ApplyMergePatch(document, patch); !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("expected merged document: %v, got: %v", expected, merged)
+	}
+}
+
+func mustUnmarshal(t *testing.T, data string, out interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal([]byte(data), out); err != nil {
+		t.Fatalf("could not unmarshal: %v", err)
+	}
+}
+
+func Test_DiffNumericLeaves(t *testing.T) {
+	t.Parallel()
+
+	var before, after interface{}
+
+	mustUnmarshal(t, `{"a": [1, 2, 3], "b": {"c": 4, "d": "x"}, "e": 5}`, &before)
+	mustUnmarshal(t, `{"a": [1, 7], "b": {"c": "4", "d": 6}, "f": 8}`, &after)
+
+	changes, err := New().DiffNumericLeaves(before, after)
+	if err != nil {
+		t.Fatalf("DiffNumericLeaves() error = %v", err)
+	}
+
+	summary := []string{}
+	for _, change := range changes {
+		summary = append(summary, change.Change+" "+change.Path)
+	}
+
+	expected := []string{"changed /a/1", "removed /a/2", "removed /b/c", "removed /e", "added /b/d", "added /f"}
+
+	if strings.Join(summary, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected changes: %v, got: %v", expected, summary)
+	}
+
+	if *changes[0].Before != 2 || *changes[0].After != 7 {
+		t.Fatalf("expected /a/1 to change from 2 to 7, got: %v to %v", *changes[0].Before, *changes[0].After)
+	}
+}
@@ -0,0 +1,228 @@
+package jsonprovider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	"go-wai-wong/common"
+)
+
+const (
+	MerkleKindObject = "object"
+	MerkleKindArray  = "array"
+)
+
+type MerkleChild struct {
+	Token    string  `json:"token"`
+	Hash     string  `json:"hash"`
+	Subtotal float64 `json:"subtotal"`
+}
+
+// MerkleProofStep describes one ancestor of the proven node, Token is the member or index leading
+// back down towards the proven node.
+type MerkleProofStep struct {
+	Kind     string        `json:"kind"`
+	LocalSum float64       `json:"local_sum"`
+	Subtotal float64       `json:"subtotal"`
+	Token    string        `json:"token"`
+	Children []MerkleChild `json:"children"`
+}
+
+type MerkleProof struct {
+	Pointer  string            `json:"pointer"`
+	Kind     string            `json:"kind"`
+	LocalSum float64           `json:"local_sum"`
+	Subtotal float64           `json:"subtotal"`
+	Children []MerkleChild     `json:"children"`
+	NodeHash string            `json:"node_hash"`
+	Steps    []MerkleProofStep `json:"steps"`
+	RootHash string            `json:"root_hash"`
+}
+
+type merkleNode struct {
+	kind     string
+	localSum float64
+	subtotal float64
+	hash     string
+	children []MerkleChild
+}
+
+// MerkleProofAs hashes every object and array node of data and populates out with the root hash
+// and the inclusion proof for the object or array node referenced by pointer.
+func (c jsonProviderImpl) MerkleProofAs(data interface{}, pointer string, out *MerkleProof) error {
+	tokens, err := ParsePointer(pointer)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := c.merkleNodes(data)
+	if err != nil {
+		return err
+	}
+
+	target, ok := nodes[pointer]
+	if !ok {
+		if _, resolveErr := ResolvePointer(data, pointer); resolveErr != nil {
+			return resolveErr
+		}
+
+		return common.JSONPointerError{Pointer: pointer, Reason: "must reference an object or array"}
+	}
+
+	steps := make([]MerkleProofStep, 0, len(tokens))
+
+	for depth := len(tokens) - 1; depth >= 0; depth-- {
+		ancestorPointer := joinTokens(tokens[:depth])
+		ancestor := nodes[ancestorPointer]
+
+		steps = append(steps, MerkleProofStep{
+			Kind:     ancestor.kind,
+			LocalSum: ancestor.localSum,
+			Subtotal: ancestor.subtotal,
+			Token:    tokens[depth],
+			Children: ancestor.children,
+		})
+	}
+
+	*out = MerkleProof{
+		Pointer:  pointer,
+		Kind:     target.kind,
+		LocalSum: target.localSum,
+		Subtotal: target.subtotal,
+		Children: target.children,
+		NodeHash: target.hash,
+		Steps:    steps,
+		RootHash: nodes[""].hash,
+	}
+
+	return nil
+}
+
+// merkleNodes builds on Walk, walking parents before children means iterating the visited nodes
+// backwards always hashes children before their parent.
+func (c jsonProviderImpl) merkleNodes(data interface{}) (map[string]*merkleNode, error) {
+	type visitedNode struct {
+		pointer string
+		value   interface{}
+	}
+
+	visited := []visitedNode{}
+
+	if err := c.Walk(data, func(pointer string, value interface{}) error {
+		visited = append(visited, visitedNode{pointer: pointer, value: value})
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	nodes := map[string]*merkleNode{}
+
+	for i := len(visited) - 1; i >= 0; i-- {
+		node := &merkleNode{children: []MerkleChild{}}
+
+		addChild := func(token string, child interface{}) {
+			childPointer := JoinPointer(visited[i].pointer, token)
+
+			if childNode, ok := nodes[childPointer]; ok {
+				node.children = append(node.children, MerkleChild{Token: token, Hash: childNode.hash, Subtotal: childNode.subtotal})
+			} else if number, isNumber := child.(float64); isNumber {
+				node.localSum += number
+			}
+		}
+
+		switch valueTypeAsserted := visited[i].value.(type) {
+		case map[string]interface{}:
+			node.kind = MerkleKindObject
+
+			for _, key := range SortedKeys(valueTypeAsserted) {
+				addChild(key, valueTypeAsserted[key])
+			}
+		case []interface{}:
+			node.kind = MerkleKindArray
+
+			for index, element := range valueTypeAsserted {
+				addChild(strconv.Itoa(index), element)
+			}
+		default:
+			continue
+		}
+
+		node.subtotal = sumSubtotals(node.localSum, node.children)
+		node.hash = merkleHash(node.kind, node.localSum, node.subtotal, node.children)
+		nodes[visited[i].pointer] = node
+	}
+
+	return nodes, nil
+}
+
+// VerifyMerkleProof recomputes the hashes from the proven node up to the root, checking every
+// subtotal adds up along the way.
+func VerifyMerkleProof(proof MerkleProof) bool {
+	if sumSubtotals(proof.LocalSum, proof.Children) != proof.Subtotal ||
+		merkleHash(proof.Kind, proof.LocalSum, proof.Subtotal, proof.Children) != proof.NodeHash {
+		return false
+	}
+
+	currentHash, currentSubtotal := proof.NodeHash, proof.Subtotal
+
+	for _, step := range proof.Steps {
+		found := false
+
+		for _, child := range step.Children {
+			if child.Token == step.Token {
+				found = child.Hash == currentHash && child.Subtotal == currentSubtotal
+			}
+		}
+
+		if !found || sumSubtotals(step.LocalSum, step.Children) != step.Subtotal {
+			return false
+		}
+
+		currentHash = merkleHash(step.Kind, step.LocalSum, step.Subtotal, step.Children)
+		currentSubtotal = step.Subtotal
+	}
+
+	return currentHash == proof.RootHash
+}
+
+func sumSubtotals(localSum float64, children []MerkleChild) float64 {
+	subtotal := localSum
+	for _, child := range children {
+		subtotal += child.Subtotal
+	}
+
+	return subtotal
+}
+
+func merkleHash(kind string, localSum, subtotal float64, children []MerkleChild) string {
+	buf := &bytes.Buffer{}
+
+	buf.WriteString(kind)
+	buf.WriteByte(0)
+	buf.WriteString(strconv.FormatFloat(localSum, 'g', -1, 64))
+	buf.WriteByte(0)
+	buf.WriteString(strconv.FormatFloat(subtotal, 'g', -1, 64))
+
+	for _, child := range children {
+		buf.WriteByte(0)
+		buf.WriteString(child.Token)
+		buf.WriteByte(0)
+		buf.WriteString(child.Hash)
+	}
+
+	hash := sha256.Sum256(buf.Bytes())
+
+	return hex.EncodeToString(hash[:])
+}
+
+func joinTokens(tokens []string) string {
+	pointer := ""
+	for _, token := range tokens {
+		pointer = JoinPointer(pointer, token)
+	}
+
+	return pointer
+}
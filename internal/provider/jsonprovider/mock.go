@@ -2,6 +2,11 @@ package jsonprovider
 
 type JSONProviderClientImplMock struct {
 	JSONMapToFloatSliceAsFn func(data map[string]interface{}, out *[]float64)
+	WalkFn                  func(data interface{}, walkFn WalkFunc) error
+	MerkleProofAsFn         func(data interface{}, pointer string, out *MerkleProof) error
+	ApplyJSONPatchFn        func(document interface{}, operations []PatchOperation) (interface{}, error)
+	ApplyMergePatchFn       func(document interface{}, patch interface{}) interface{}
+	DiffNumericLeavesFn     func(before, after interface{}) ([]LeafChange, error)
 }
 
 func (c *JSONProviderClientImplMock) JSONMapToFloatSliceAs(data map[string]interface{}, out *[]float64) {
@@ -15,3 +20,53 @@ func (c *JSONProviderClientImplMock) JSONMapToFloatSliceAs(data map[string]inter
 
 	jsonProviderSrv.JSONMapToFloatSliceAs(data, out)
 }
+
+func (c *JSONProviderClientImplMock) Walk(data interface{}, walkFn WalkFunc) error {
+	if c != nil && c.WalkFn != nil {
+		return c.WalkFn(data, walkFn)
+	}
+
+	jsonProviderSrv := New()
+
+	return jsonProviderSrv.Walk(data, walkFn)
+}
+
+func (c *JSONProviderClientImplMock) MerkleProofAs(data interface{}, pointer string, out *MerkleProof) error {
+	if c != nil && c.MerkleProofAsFn != nil {
+		return c.MerkleProofAsFn(data, pointer, out)
+	}
+
+	jsonProviderSrv := New()
+
+	return jsonProviderSrv.MerkleProofAs(data, pointer, out)
+}
+
+func (c *JSONProviderClientImplMock) ApplyJSONPatch(document interface{}, operations []PatchOperation) (interface{}, error) {
+	if c != nil && c.ApplyJSONPatchFn != nil {
+		return c.ApplyJSONPatchFn(document, operations)
+	}
+
+	jsonProviderSrv := New()
+
+	return jsonProviderSrv.ApplyJSONPatch(document, operations)
+}
+
+func (c *JSONProviderClientImplMock) ApplyMergePatch(document interface{}, patch interface{}) interface{} {
+	if c != nil && c.ApplyMergePatchFn != nil {
+		return c.ApplyMergePatchFn(document, patch)
+	}
+
+	jsonProviderSrv := New()
+
+	return jsonProviderSrv.ApplyMergePatch(document, patch)
+}
+
+func (c *JSONProviderClientImplMock) DiffNumericLeaves(before, after interface{}) ([]LeafChange, error) {
+	if c != nil && c.DiffNumericLeavesFn != nil {
+		return c.DiffNumericLeavesFn(before, after)
+	}
+
+	jsonProviderSrv := New()
+
+	return jsonProviderSrv.DiffNumericLeaves(before, after)
+}
@@ -0,0 +1,276 @@
+package jsonprovider
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"go-wai-wong/common"
+)
+
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+	PatchOpMove    = "move"
+	PatchOpCopy    = "copy"
+	PatchOpTest    = "test"
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation, Value is only used by add, replace
+// and test, From only by move and copy. Value is kept raw so a missing value can be told apart
+// from a null one.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// value decodes the value of the operation, the ops that use one must have it.
+func (o PatchOperation) value(index int) (interface{}, error) {
+	if len(o.Value) == 0 {
+		return nil, common.InvalidPatchError{Operation: index, Reason: o.Op + " needs a value"}
+	}
+
+	var value interface{}
+
+	if err := json.Unmarshal(o.Value, &value); err != nil {
+		return nil, common.InvalidPatchError{Operation: index, Reason: err.Error()}
+	}
+
+	return value, nil
+}
+
+// ApplyJSONPatch applies the operations in order to a copy of document, document itself is never
+// modified so a failed patch leaves it untouched.
+func (c jsonProviderImpl) ApplyJSONPatch(document interface{}, operations []PatchOperation) (interface{}, error) {
+	patched := DeepCopy(document)
+
+	for index, operation := range operations {
+		var (
+			value interface{}
+			err   error
+		)
+
+		switch operation.Op {
+		case PatchOpAdd, PatchOpReplace, PatchOpTest:
+			if value, err = operation.value(index); err != nil {
+				return nil, err
+			}
+		}
+
+		switch operation.Op {
+		case PatchOpAdd:
+			patched, err = addValue(patched, operation.Path, value)
+		case PatchOpRemove:
+			patched, _, err = removeValue(patched, operation.Path)
+		case PatchOpReplace:
+			if patched, _, err = removeValue(patched, operation.Path); err == nil {
+				patched, err = addValue(patched, operation.Path, value)
+			}
+		case PatchOpMove:
+			patched, err = moveValue(patched, operation.From, operation.Path)
+		case PatchOpCopy:
+			var copied interface{}
+			if copied, err = ResolvePointer(patched, operation.From); err == nil {
+				patched, err = addValue(patched, operation.Path, DeepCopy(copied))
+			}
+		case PatchOpTest:
+			var current interface{}
+			if current, err = ResolvePointer(patched, operation.Path); err == nil && !reflect.DeepEqual(current, value) {
+				return nil, common.PatchError{Operation: index, Reason: "test failed for path " + operation.Path}
+			}
+		default:
+			return nil, common.PatchError{Operation: index, Reason: "unknown op " + strconv.Quote(operation.Op)}
+		}
+
+		if err != nil {
+			return nil, common.PatchError{Operation: index, Reason: err.Error()}
+		}
+	}
+
+	return patched, nil
+}
+
+// ApplyMergePatch applies an RFC 7396 merge patch to a copy of document.
+func (c jsonProviderImpl) ApplyMergePatch(document interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return DeepCopy(patch)
+	}
+
+	target, ok := document.(map[string]interface{})
+	if !ok {
+		target = map[string]interface{}{}
+	}
+
+	merged := make(map[string]interface{}, len(target))
+	for key, value := range target {
+		merged[key] = DeepCopy(value)
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(merged, key)
+
+			continue
+		}
+
+		merged[key] = c.ApplyMergePatch(merged[key], value)
+	}
+
+	return merged
+}
+
+// DeepCopy copies unmarshalled JSON so the copy can be changed without affecting the original.
+func DeepCopy(data interface{}) interface{} {
+	switch dataTypeAsserted := data.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(dataTypeAsserted))
+		for key, value := range dataTypeAsserted {
+			copied[key] = DeepCopy(value)
+		}
+
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(dataTypeAsserted))
+		for index, value := range dataTypeAsserted {
+			copied[index] = DeepCopy(value)
+		}
+
+		return copied
+	default:
+		return data
+	}
+}
+
+func moveValue(document interface{}, from, path string) (interface{}, error) {
+	if path != from && len(path) > len(from) && path[:len(from)+1] == from+"/" {
+		return nil, common.JSONPointerError{Pointer: path, Reason: "cannot move a value into one of its children"}
+	}
+
+	document, value, err := removeValue(document, from)
+	if err != nil {
+		return nil, err
+	}
+
+	return addValue(document, path, value)
+}
+
+// addValue adds value at pointer and returns the new document, which is only a different value
+// from document when pointer is the root.
+func addValue(document interface{}, pointer string, value interface{}) (interface{}, error) {
+	if pointer == "" {
+		return value, nil
+	}
+
+	parent, token, err := resolveParent(document, pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parentTypeAsserted := parent.container.(type) {
+	case map[string]interface{}:
+		parentTypeAsserted[token] = value
+
+		return document, nil
+	case []interface{}:
+		index := len(parentTypeAsserted)
+
+		if token != "-" {
+			if index, err = ArrayIndex(token, len(parentTypeAsserted)+1); err != nil {
+				return nil, err
+			}
+		}
+
+		grown := make([]interface{}, 0, len(parentTypeAsserted)+1)
+		grown = append(grown, parentTypeAsserted[:index]...)
+		grown = append(grown, value)
+		grown = append(grown, parentTypeAsserted[index:]...)
+
+		return parent.replace(document, grown), nil
+	default:
+		return nil, common.JSONPointerError{Pointer: pointer, Reason: "parent is not an object or array"}
+	}
+}
+
+func removeValue(document interface{}, pointer string) (interface{}, interface{}, error) {
+	if pointer == "" {
+		return nil, document, nil
+	}
+
+	parent, token, err := resolveParent(document, pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch parentTypeAsserted := parent.container.(type) {
+	case map[string]interface{}:
+		value, ok := parentTypeAsserted[token]
+		if !ok {
+			return nil, nil, common.JSONPointerError{Pointer: pointer, Reason: "member " + token + " not found"}
+		}
+
+		delete(parentTypeAsserted, token)
+
+		return document, value, nil
+	case []interface{}:
+		index, err := ArrayIndex(token, len(parentTypeAsserted))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value := parentTypeAsserted[index]
+
+		shrunk := make([]interface{}, 0, len(parentTypeAsserted)-1)
+		shrunk = append(shrunk, parentTypeAsserted[:index]...)
+		shrunk = append(shrunk, parentTypeAsserted[index+1:]...)
+
+		return parent.replace(document, shrunk), value, nil
+	default:
+		return nil, nil, common.JSONPointerError{Pointer: pointer, Reason: "parent is not an object or array"}
+	}
+}
+
+// parentRef is the container holding the value a pointer references, arrays change length when
+// patched so replace stores the new array back where the old one was.
+type parentRef struct {
+	container   interface{}
+	grandparent interface{}
+	token       string
+}
+
+func (p parentRef) replace(document interface{}, container []interface{}) interface{} {
+	switch grandparentTypeAsserted := p.grandparent.(type) {
+	case map[string]interface{}:
+		grandparentTypeAsserted[p.token] = container
+	case []interface{}:
+		index, _ := strconv.Atoi(p.token)
+		grandparentTypeAsserted[index] = container
+	default:
+		return container
+	}
+
+	return document
+}
+
+func resolveParent(document interface{}, pointer string) (parentRef, string, error) {
+	tokens, err := ParsePointer(pointer)
+	if err != nil {
+		return parentRef{}, "", err
+	}
+
+	parent := parentRef{container: document}
+
+	for _, token := range tokens[:len(tokens)-1] {
+		child, err := ResolvePointer(parent.container, JoinPointer("", token))
+		if err != nil {
+			return parentRef{}, "", common.JSONPointerError{Pointer: pointer, Reason: err.Error()}
+		}
+
+		parent = parentRef{container: child, grandparent: parent.container, token: token}
+	}
+
+	return parent, tokens[len(tokens)-1], nil
+}
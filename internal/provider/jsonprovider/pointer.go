@@ -0,0 +1,90 @@
+package jsonprovider
+
+import (
+	"strconv"
+	"strings"
+
+	"go-wai-wong/common"
+)
+
+var (
+	pointerTokenEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerTokenUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// EscapePointerToken escapes a single reference token as per RFC 6901.
+func EscapePointerToken(token string) string {
+	return pointerTokenEscaper.Replace(token)
+}
+
+// JoinPointer appends an unescaped reference token to a JSON Pointer.
+func JoinPointer(pointer, token string) string {
+	return pointer + "/" + EscapePointerToken(token)
+}
+
+// ParsePointer splits a JSON Pointer into its unescaped reference tokens, "" is the whole document.
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, common.JSONPointerError{Pointer: pointer, Reason: "must be empty or start with /"}
+	}
+
+	rawTokens := strings.Split(pointer[1:], "/")
+	tokens := make([]string, 0, len(rawTokens))
+
+	for _, rawToken := range rawTokens {
+		tokens = append(tokens, pointerTokenUnescaper.Replace(rawToken))
+	}
+
+	return tokens, nil
+}
+
+// ResolvePointer returns the value the JSON Pointer references within data.
+func ResolvePointer(data interface{}, pointer string) (interface{}, error) {
+	tokens, err := ParsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	current := data
+
+	for _, token := range tokens {
+		switch currentTypeAsserted := current.(type) {
+		case map[string]interface{}:
+			value, ok := currentTypeAsserted[token]
+			if !ok {
+				return nil, common.JSONPointerError{Pointer: pointer, Reason: "member " + token + " not found"}
+			}
+
+			current = value
+		case []interface{}:
+			index, indexErr := ArrayIndex(token, len(currentTypeAsserted))
+			if indexErr != nil {
+				return nil, common.JSONPointerError{Pointer: pointer, Reason: indexErr.Error()}
+			}
+
+			current = currentTypeAsserted[index]
+		default:
+			return nil, common.JSONPointerError{Pointer: pointer, Reason: "cannot descend into a scalar value"}
+		}
+	}
+
+	return current, nil
+}
+
+// ArrayIndex parses a reference token as an index into an array of the given length.
+func ArrayIndex(token string, length int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, common.ArrayIndexError{Token: token, Length: length}
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index >= length {
+		return 0, common.ArrayIndexError{Token: token, Length: length}
+	}
+
+	return index, nil
+}
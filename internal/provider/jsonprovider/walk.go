@@ -0,0 +1,50 @@
+package jsonprovider
+
+import (
+	"sort"
+	"strconv"
+)
+
+// WalkFunc is called for every node with its JSON Pointer, returning an error stops the walk.
+type WalkFunc func(pointer string, value interface{}) error
+
+// Walk visits data depth first, parents before children, object members in key order so the
+// visiting order is deterministic.
+func (c jsonProviderImpl) Walk(data interface{}, walkFn WalkFunc) error {
+	return walk("", data, walkFn)
+}
+
+func walk(pointer string, data interface{}, walkFn WalkFunc) error {
+	if err := walkFn(pointer, data); err != nil {
+		return err
+	}
+
+	switch dataTypeAsserted := data.(type) {
+	case map[string]interface{}:
+		for _, key := range SortedKeys(dataTypeAsserted) {
+			if err := walk(JoinPointer(pointer, key), dataTypeAsserted[key], walkFn); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for index, element := range dataTypeAsserted {
+			if err := walk(pointer+"/"+strconv.Itoa(index), element, walkFn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SortedKeys returns the keys of an object in ascending order.
+func SortedKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
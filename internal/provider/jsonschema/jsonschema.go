@@ -0,0 +1,86 @@
+package jsonschema
+
+import (
+	"sort"
+	"sync"
+
+	"go-wai-wong/common"
+)
+
+type Service interface {
+	Register(name string, document interface{}) error
+	Remove(name string) error
+	Names() []string
+	Validate(name string, data interface{}) ([]Violation, error)
+}
+
+// jsonSchemaImpl keeps the compiled schemas by name, it is shared between requests so access is
+// guarded by a mutex.
+type jsonSchemaImpl struct {
+	mu      *sync.RWMutex
+	schemas map[string]*Schema
+}
+
+// verify interface compliance
+var _ Service = (*jsonSchemaImpl)(nil)
+
+func New() jsonSchemaImpl {
+	return jsonSchemaImpl{
+		mu:      &sync.RWMutex{},
+		schemas: map[string]*Schema{},
+	}
+}
+
+// Register compiles the schema document and stores it under name, replacing any existing schema.
+func (c jsonSchemaImpl) Register(name string, document interface{}) error {
+	schema, err := Compile(document)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schemas[name] = schema
+
+	return nil
+}
+
+func (c jsonSchemaImpl) Remove(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.schemas[name]; !ok {
+		return common.SchemaNotFoundError(name)
+	}
+
+	delete(c.schemas, name)
+
+	return nil
+}
+
+func (c jsonSchemaImpl) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.schemas))
+	for name := range c.schemas {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (c jsonSchemaImpl) Validate(name string, data interface{}) ([]Violation, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[name]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, common.SchemaNotFoundError(name)
+	}
+
+	return schema.Validate(data), nil
+}
@@ -0,0 +1,139 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func Test_Validate(t *testing.T) {
+	t.Parallel()
+
+	schema := `{
+		"type": "object",
+		"required": ["prices"],
+		"properties": {
+			"prices": {"type": "array", "items": {"$ref": "#/$defs/price"}, "maxItems": 3},
+			"name": {"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+			"kind": {"enum": ["retail", "wholesale"]}
+		},
+		"additionalProperties": false,
+		"$defs": {"price": {"type": "number", "minimum": 0}}
+	}`
+
+	tests := []struct {
+		name          string
+		document      string
+		expectedPaths []string
+		wantErr       bool
+	}{
+		{
+			name:          "validate-valid",
+			document:      `{"prices": [1, 2.5], "name": "shop", "kind": "retail"}`,
+			expectedPaths: []string{},
+		},
+		{
+			name:          "validate-missingRequired",
+			document:      `{}`,
+			expectedPaths: []string{""},
+		},
+		{
+			name:          "validate-nestedViolations",
+			document:      `{"prices": [1, -2, "3"], "name": "A", "kind": "other", "extra/key": 1}`,
+			expectedPaths: []string{"/extra~1key", "/kind", "/name", "/name", "/prices/1", "/prices/2"},
+		},
+		{
+			name:          "validate-wrongRootType",
+			document:      `[1, 2]`,
+			expectedPaths: []string{""},
+		},
+		{
+			name:     "validate-unknownSchemaErr",
+			document: `{}`,
+			wantErr:  true,
+		},
+	}
+
+	jsonSchemaSrv := New()
+
+	var schemaDocument interface{}
+	if err := json.Unmarshal([]byte(schema), &schemaDocument); err != nil {
+		t.Fatalf("could not unmarshal schema: %v", err)
+	}
+
+	if err := jsonSchemaSrv.Register("prices", schemaDocument); err != nil {
+		t.Fatalf("could not register schema: %v", err)
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var document interface{}
+			if err := json.Unmarshal([]byte(tt.document), &document); err != nil {
+				t.Fatalf("could not unmarshal document: %v", err)
+			}
+
+			schemaName := "prices"
+			if tt.wantErr {
+				schemaName = "unknown"
+			}
+
+			violations, err := jsonSchemaSrv.Validate(schemaName, document)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			paths := []string{}
+			for _, violation := range violations {
+				paths = append(paths, violation.InstancePath)
+			}
+
+			if strings.Join(paths, ",") != strings.Join(tt.expectedPaths, ",") {
+				t.Fatalf("expected violation paths: %v, got violations: %v", tt.expectedPaths, violations)
+			}
+		})
+	}
+}
+
+func Test_Compile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr bool
+	}{
+		{name: "compile-boolean", schema: `true`},
+		{name: "compile-recursiveRef", schema: `{"type": "array", "items": {"anyOf": [{"type": "number"}, {"$ref": "#"}]}}`},
+		{name: "compile-unknownType", schema: `{"type": "float"}`, wantErr: true},
+		{name: "compile-unresolvedRef", schema: `{"$ref": "#/$defs/missing"}`, wantErr: true},
+		{name: "compile-remoteRef", schema: `{"$ref": "https://example.com/schema"}`, wantErr: true},
+		{name: "compile-unsupportedKeyword", schema: `{"unevaluatedProperties": false}`, wantErr: true},
+		{name: "compile-badPattern", schema: `{"pattern": "("}`, wantErr: true},
+		{name: "compile-notASchema", schema: `1`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var schemaDocument interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schemaDocument); err != nil {
+				t.Fatalf("could not unmarshal schema: %v", err)
+			}
+
+			if _, err := Compile(schemaDocument); (err != nil) != tt.wantErr {
+				t.Fatalf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package jsonschema
+
+type JSONSchemaClientImplMock struct {
+	RegisterFn func(name string, document interface{}) error
+	RemoveFn   func(name string) error
+	NamesFn    func() []string
+	ValidateFn func(name string, data interface{}) ([]Violation, error)
+}
+
+func (c *JSONSchemaClientImplMock) Register(name string, document interface{}) error {
+	if c != nil && c.RegisterFn != nil {
+		return c.RegisterFn(name, document)
+	}
+
+	jsonSchemaSrv := New()
+
+	return jsonSchemaSrv.Register(name, document)
+}
+
+func (c *JSONSchemaClientImplMock) Remove(name string) error {
+	if c != nil && c.RemoveFn != nil {
+		return c.RemoveFn(name)
+	}
+
+	jsonSchemaSrv := New()
+
+	return jsonSchemaSrv.Remove(name)
+}
+
+func (c *JSONSchemaClientImplMock) Names() []string {
+	if c != nil && c.NamesFn != nil {
+		return c.NamesFn()
+	}
+
+	jsonSchemaSrv := New()
+
+	return jsonSchemaSrv.Names()
+}
+
+func (c *JSONSchemaClientImplMock) Validate(name string, data interface{}) ([]Violation, error) {
+	if c != nil && c.ValidateFn != nil {
+		return c.ValidateFn(name, data)
+	}
+
+	jsonSchemaSrv := New()
+
+	return jsonSchemaSrv.Validate(name, data)
+}
@@ -0,0 +1,413 @@
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"go-wai-wong/common"
+)
+
+// unsupportedKeywords are draft 2020-12 keywords outside the supported subset, they are rejected
+// rather than ignored so a schema never validates less than its author expects.
+var unsupportedKeywords = []string{
+	"$dynamicRef", "$dynamicAnchor", "$recursiveRef", "dependentSchemas", "unevaluatedItems",
+	"unevaluatedProperties", "minContains", "maxContains", "patternProperties",
+}
+
+// Schema is a compiled draft 2020-12 schema.
+type Schema struct {
+	boolean *bool
+
+	types                []string
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	propertyNames        *Schema
+	minProperties        *int
+	maxProperties        *int
+
+	prefixItems []*Schema
+	items       *Schema
+	contains    *Schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	enum     []interface{}
+	constVal interface{}
+	hasConst bool
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+
+	ifSchema   *Schema
+	thenSchema *Schema
+	elseSchema *Schema
+
+	ref  string
+	defs map[string]*Schema
+	root *Schema
+}
+
+// Compile turns an unmarshalled schema document into a Schema, local $ref values ("#" and
+// "#/$defs/<name>") are checked to resolve.
+func Compile(document interface{}) (*Schema, error) {
+	schema, err := compile(document, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := schema.bindRoot(schema); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func compile(document interface{}, location string) (*Schema, error) {
+	switch documentTypeAsserted := document.(type) {
+	case bool:
+		return &Schema{boolean: &documentTypeAsserted}, nil
+	case map[string]interface{}:
+		return compileObject(documentTypeAsserted, location)
+	default:
+		return nil, common.SchemaError{Location: location, Reason: "schema must be an object or a boolean"}
+	}
+}
+
+func compileObject(document map[string]interface{}, location string) (*Schema, error) {
+	for _, keyword := range unsupportedKeywords {
+		if _, ok := document[keyword]; ok {
+			return nil, common.SchemaError{Location: location, Reason: "unsupported keyword " + keyword}
+		}
+	}
+
+	schema := &Schema{}
+
+	var err error
+
+	if schema.types, err = compileTypes(document["type"], location); err != nil {
+		return nil, err
+	}
+
+	if schema.properties, err = compileSchemaMap(document, "properties", location); err != nil {
+		return nil, err
+	}
+
+	if schema.defs, err = compileSchemaMap(document, "$defs", location); err != nil {
+		return nil, err
+	}
+
+	if schema.required, err = compileStrings(document, "required", location); err != nil {
+		return nil, err
+	}
+
+	for keyword, target := range map[string]**Schema{
+		"additionalProperties": &schema.additionalProperties,
+		"propertyNames":        &schema.propertyNames,
+		"items":                &schema.items,
+		"contains":             &schema.contains,
+		"not":                  &schema.not,
+		"if":                   &schema.ifSchema,
+		"then":                 &schema.thenSchema,
+		"else":                 &schema.elseSchema,
+	} {
+		if *target, err = compileOptional(document, keyword, location); err != nil {
+			return nil, err
+		}
+	}
+
+	for keyword, target := range map[string]*[]*Schema{
+		"prefixItems": &schema.prefixItems,
+		"allOf":       &schema.allOf,
+		"anyOf":       &schema.anyOf,
+		"oneOf":       &schema.oneOf,
+	} {
+		if *target, err = compileSchemaList(document, keyword, location); err != nil {
+			return nil, err
+		}
+	}
+
+	for keyword, target := range map[string]**float64{
+		"minimum":          &schema.minimum,
+		"maximum":          &schema.maximum,
+		"exclusiveMinimum": &schema.exclusiveMinimum,
+		"exclusiveMaximum": &schema.exclusiveMaximum,
+		"multipleOf":       &schema.multipleOf,
+	} {
+		if *target, err = compileNumber(document, keyword, location); err != nil {
+			return nil, err
+		}
+	}
+
+	if schema.multipleOf != nil && *schema.multipleOf <= 0 {
+		return nil, common.SchemaError{Location: location + "/multipleOf", Reason: "must be greater than 0"}
+	}
+
+	for keyword, target := range map[string]**int{
+		"minItems":      &schema.minItems,
+		"maxItems":      &schema.maxItems,
+		"minLength":     &schema.minLength,
+		"maxLength":     &schema.maxLength,
+		"minProperties": &schema.minProperties,
+		"maxProperties": &schema.maxProperties,
+	} {
+		if *target, err = compileCount(document, keyword, location); err != nil {
+			return nil, err
+		}
+	}
+
+	if uniqueItems, ok := document["uniqueItems"]; ok {
+		if schema.uniqueItems, ok = uniqueItems.(bool); !ok {
+			return nil, common.SchemaError{Location: location + "/uniqueItems", Reason: "must be a boolean"}
+		}
+	}
+
+	if pattern, ok := document["pattern"]; ok {
+		patternStr, isString := pattern.(string)
+		if !isString {
+			return nil, common.SchemaError{Location: location + "/pattern", Reason: "must be a string"}
+		}
+
+		if schema.pattern, err = regexp.Compile(patternStr); err != nil {
+			return nil, common.SchemaError{Location: location + "/pattern", Reason: err.Error()}
+		}
+	}
+
+	if enum, ok := document["enum"]; ok {
+		if schema.enum, ok = enum.([]interface{}); !ok {
+			return nil, common.SchemaError{Location: location + "/enum", Reason: "must be an array"}
+		}
+	}
+
+	schema.constVal, schema.hasConst = document["const"]
+
+	if ref, ok := document["$ref"]; ok {
+		if schema.ref, ok = ref.(string); !ok {
+			return nil, common.SchemaError{Location: location + "/$ref", Reason: "must be a string"}
+		}
+
+		if schema.ref != "#" && !strings.HasPrefix(schema.ref, "#/$defs/") {
+			return nil, common.SchemaError{Location: location + "/$ref", Reason: "only local references to # or #/$defs/ are supported"}
+		}
+	}
+
+	return schema, nil
+}
+
+// bindRoot gives every subschema access to the root so $ref can be resolved when validating.
+func (s *Schema) bindRoot(root *Schema) error {
+	if s == nil {
+		return nil
+	}
+
+	s.root = root
+
+	if s.ref != "" {
+		if _, err := s.resolveRef(); err != nil {
+			return err
+		}
+	}
+
+	children := []*Schema{
+		s.additionalProperties, s.propertyNames, s.items, s.contains, s.not, s.ifSchema, s.thenSchema, s.elseSchema,
+	}
+	children = append(children, s.prefixItems...)
+	children = append(children, s.allOf...)
+	children = append(children, s.anyOf...)
+	children = append(children, s.oneOf...)
+
+	for _, property := range s.properties {
+		children = append(children, property)
+	}
+
+	for _, def := range s.defs {
+		children = append(children, def)
+	}
+
+	for _, child := range children {
+		if err := child.bindRoot(root); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) resolveRef() (*Schema, error) {
+	if s.ref == "#" {
+		return s.root, nil
+	}
+
+	name := strings.TrimPrefix(s.ref, "#/$defs/")
+
+	def, ok := s.root.defs[name]
+	if !ok {
+		return nil, common.SchemaError{Location: s.ref, Reason: "reference does not resolve"}
+	}
+
+	return def, nil
+}
+
+func compileTypes(value interface{}, location string) ([]string, error) {
+	switch valueTypeAsserted := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{valueTypeAsserted}, checkTypeNames([]string{valueTypeAsserted}, location)
+	case []interface{}:
+		types := make([]string, 0, len(valueTypeAsserted))
+
+		for _, element := range valueTypeAsserted {
+			typeName, ok := element.(string)
+			if !ok {
+				return nil, common.SchemaError{Location: location + "/type", Reason: "must be a string or an array of strings"}
+			}
+
+			types = append(types, typeName)
+		}
+
+		return types, checkTypeNames(types, location)
+	default:
+		return nil, common.SchemaError{Location: location + "/type", Reason: "must be a string or an array of strings"}
+	}
+}
+
+func checkTypeNames(types []string, location string) error {
+	for _, typeName := range types {
+		switch typeName {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return common.SchemaError{Location: location + "/type", Reason: "unknown type " + typeName}
+		}
+	}
+
+	return nil
+}
+
+func compileOptional(document map[string]interface{}, keyword, location string) (*Schema, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	return compile(value, location+"/"+keyword)
+}
+
+func compileSchemaMap(document map[string]interface{}, keyword, location string) (map[string]*Schema, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, common.SchemaError{Location: location + "/" + keyword, Reason: "must be an object"}
+	}
+
+	schemas := make(map[string]*Schema, len(valueMap))
+
+	for name, subDocument := range valueMap {
+		subSchema, err := compile(subDocument, location+"/"+keyword+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		schemas[name] = subSchema
+	}
+
+	return schemas, nil
+}
+
+func compileSchemaList(document map[string]interface{}, keyword, location string) ([]*Schema, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	valueSlice, ok := value.([]interface{})
+	if !ok || len(valueSlice) == 0 {
+		return nil, common.SchemaError{Location: location + "/" + keyword, Reason: "must be a non-empty array"}
+	}
+
+	schemas := make([]*Schema, 0, len(valueSlice))
+
+	for index, subDocument := range valueSlice {
+		subSchema, err := compile(subDocument, fmt.Sprintf("%v/%v/%v", location, keyword, index))
+		if err != nil {
+			return nil, err
+		}
+
+		schemas = append(schemas, subSchema)
+	}
+
+	return schemas, nil
+}
+
+func compileStrings(document map[string]interface{}, keyword, location string) ([]string, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	valueSlice, ok := value.([]interface{})
+	if !ok {
+		return nil, common.SchemaError{Location: location + "/" + keyword, Reason: "must be an array of strings"}
+	}
+
+	strs := make([]string, 0, len(valueSlice))
+
+	for _, element := range valueSlice {
+		str, isString := element.(string)
+		if !isString {
+			return nil, common.SchemaError{Location: location + "/" + keyword, Reason: "must be an array of strings"}
+		}
+
+		strs = append(strs, str)
+	}
+
+	return strs, nil
+}
+
+func compileNumber(document map[string]interface{}, keyword, location string) (*float64, error) {
+	value, ok := document[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	number, ok := value.(float64)
+	if !ok {
+		return nil, common.SchemaError{Location: location + "/" + keyword, Reason: "must be a number"}
+	}
+
+	return &number, nil
+}
+
+func compileCount(document map[string]interface{}, keyword, location string) (*int, error) {
+	number, err := compileNumber(document, keyword, location)
+	if err != nil || number == nil {
+		return nil, err
+	}
+
+	if *number < 0 || *number != math.Trunc(*number) {
+		return nil, common.SchemaError{Location: location + "/" + keyword, Reason: "must be a non-negative integer"}
+	}
+
+	count := int(*number)
+
+	return &count, nil
+}
@@ -0,0 +1,300 @@
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"unicode/utf8"
+
+	"go-wai-wong/internal/provider/jsonprovider"
+)
+
+// maxRefDepth stops schemas like {"$ref": "#"} from recursing forever without consuming input.
+const maxRefDepth = 64
+
+type Violation struct {
+	InstancePath string `json:"instance_path"`
+	Keyword      string `json:"keyword"`
+	Message      string `json:"message"`
+}
+
+// Validate returns every violation of the schema found in data, an empty slice means data is valid.
+func (s *Schema) Validate(data interface{}) []Violation {
+	violations := []Violation{}
+	s.validate(data, "", 0, &violations)
+
+	return violations
+}
+
+func (s *Schema) valid(data interface{}, refDepth int) bool {
+	violations := []Violation{}
+	s.validate(data, "", refDepth, &violations)
+
+	return len(violations) == 0
+}
+
+func (s *Schema) validate(data interface{}, instancePath string, refDepth int, out *[]Violation) {
+	addViolation := func(keyword, format string, args ...interface{}) {
+		*out = append(*out, Violation{InstancePath: instancePath, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.boolean != nil {
+		if !*s.boolean {
+			addViolation("false", "no value is allowed")
+		}
+
+		return
+	}
+
+	if s.ref != "" {
+		if refDepth >= maxRefDepth {
+			addViolation("$ref", "reference depth exceeds %v", maxRefDepth)
+
+			return
+		}
+
+		refSchema, _ := s.resolveRef()
+		refSchema.validate(data, instancePath, refDepth+1, out)
+	}
+
+	if len(s.types) > 0 && !matchesAnyType(data, s.types) {
+		addViolation("type", "expected %v, found %v", s.types, typeOf(data))
+
+		return
+	}
+
+	if s.enum != nil && !containsValue(s.enum, data) {
+		addViolation("enum", "value is not one of %v", s.enum)
+	}
+
+	if s.hasConst && !reflect.DeepEqual(s.constVal, data) {
+		addViolation("const", "value must be %v", s.constVal)
+	}
+
+	switch dataTypeAsserted := data.(type) {
+	case map[string]interface{}:
+		s.validateObject(dataTypeAsserted, instancePath, refDepth, out, addViolation)
+	case []interface{}:
+		s.validateArray(dataTypeAsserted, instancePath, refDepth, out, addViolation)
+	case float64:
+		s.validateNumber(dataTypeAsserted, addViolation)
+	case string:
+		s.validateString(dataTypeAsserted, addViolation)
+	}
+
+	for _, subSchema := range s.allOf {
+		subSchema.validate(data, instancePath, refDepth, out)
+	}
+
+	if len(s.anyOf) > 0 {
+		matched := false
+
+		for _, subSchema := range s.anyOf {
+			if subSchema.valid(data, refDepth) {
+				matched = true
+
+				break
+			}
+		}
+
+		if !matched {
+			addViolation("anyOf", "value does not match any of the schemas")
+		}
+	}
+
+	if len(s.oneOf) > 0 {
+		matched := 0
+
+		for _, subSchema := range s.oneOf {
+			if subSchema.valid(data, refDepth) {
+				matched++
+			}
+		}
+
+		if matched != 1 {
+			addViolation("oneOf", "value must match exactly one schema, matched %v", matched)
+		}
+	}
+
+	if s.not != nil && s.not.valid(data, refDepth) {
+		addViolation("not", "value must not match the schema")
+	}
+
+	if s.ifSchema != nil {
+		if s.ifSchema.valid(data, refDepth) {
+			if s.thenSchema != nil {
+				s.thenSchema.validate(data, instancePath, refDepth, out)
+			}
+		} else if s.elseSchema != nil {
+			s.elseSchema.validate(data, instancePath, refDepth, out)
+		}
+	}
+}
+
+func (s *Schema) validateObject(
+	data map[string]interface{},
+	instancePath string,
+	refDepth int,
+	out *[]Violation,
+	addViolation func(keyword, format string, args ...interface{}),
+) {
+	for _, name := range s.required {
+		if _, ok := data[name]; !ok {
+			addViolation("required", "missing required property %q", name)
+		}
+	}
+
+	if s.minProperties != nil && len(data) < *s.minProperties {
+		addViolation("minProperties", "expected at least %v properties, found %v", *s.minProperties, len(data))
+	}
+
+	if s.maxProperties != nil && len(data) > *s.maxProperties {
+		addViolation("maxProperties", "expected at most %v properties, found %v", *s.maxProperties, len(data))
+	}
+
+	for _, name := range jsonprovider.SortedKeys(data) {
+		propertyPath := jsonprovider.JoinPointer(instancePath, name)
+
+		if s.propertyNames != nil && !s.propertyNames.valid(name, refDepth) {
+			*out = append(*out, Violation{InstancePath: propertyPath, Keyword: "propertyNames", Message: "property name is not allowed"})
+		}
+
+		if propertySchema, ok := s.properties[name]; ok {
+			propertySchema.validate(data[name], propertyPath, refDepth, out)
+		} else if s.additionalProperties != nil {
+			s.additionalProperties.validate(data[name], propertyPath, refDepth, out)
+		}
+	}
+}
+
+func (s *Schema) validateArray(
+	data []interface{},
+	instancePath string,
+	refDepth int,
+	out *[]Violation,
+	addViolation func(keyword, format string, args ...interface{}),
+) {
+	if s.minItems != nil && len(data) < *s.minItems {
+		addViolation("minItems", "expected at least %v items, found %v", *s.minItems, len(data))
+	}
+
+	if s.maxItems != nil && len(data) > *s.maxItems {
+		addViolation("maxItems", "expected at most %v items, found %v", *s.maxItems, len(data))
+	}
+
+	for index, element := range data {
+		elementPath := fmt.Sprintf("%v/%v", instancePath, index)
+
+		if index < len(s.prefixItems) {
+			s.prefixItems[index].validate(element, elementPath, refDepth, out)
+		} else if s.items != nil {
+			s.items.validate(element, elementPath, refDepth, out)
+		}
+
+		if s.uniqueItems && containsValue(data[:index], element) {
+			*out = append(*out, Violation{InstancePath: elementPath, Keyword: "uniqueItems", Message: "duplicate item"})
+		}
+	}
+
+	if s.contains != nil {
+		matched := false
+
+		for _, element := range data {
+			if s.contains.valid(element, refDepth) {
+				matched = true
+
+				break
+			}
+		}
+
+		if !matched {
+			addViolation("contains", "no item matches the contains schema")
+		}
+	}
+}
+
+func (s *Schema) validateNumber(data float64, addViolation func(keyword, format string, args ...interface{})) {
+	if s.minimum != nil && data < *s.minimum {
+		addViolation("minimum", "must be >= %v", *s.minimum)
+	}
+
+	if s.maximum != nil && data > *s.maximum {
+		addViolation("maximum", "must be <= %v", *s.maximum)
+	}
+
+	if s.exclusiveMinimum != nil && data <= *s.exclusiveMinimum {
+		addViolation("exclusiveMinimum", "must be > %v", *s.exclusiveMinimum)
+	}
+
+	if s.exclusiveMaximum != nil && data >= *s.exclusiveMaximum {
+		addViolation("exclusiveMaximum", "must be < %v", *s.exclusiveMaximum)
+	}
+
+	if s.multipleOf != nil {
+		quotient := data / *s.multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			addViolation("multipleOf", "must be a multiple of %v", *s.multipleOf)
+		}
+	}
+}
+
+func (s *Schema) validateString(data string, addViolation func(keyword, format string, args ...interface{})) {
+	length := utf8.RuneCountInString(data)
+
+	if s.minLength != nil && length < *s.minLength {
+		addViolation("minLength", "expected at least %v characters, found %v", *s.minLength, length)
+	}
+
+	if s.maxLength != nil && length > *s.maxLength {
+		addViolation("maxLength", "expected at most %v characters, found %v", *s.maxLength, length)
+	}
+
+	if s.pattern != nil && !s.pattern.MatchString(data) {
+		addViolation("pattern", "must match pattern %v", s.pattern.String())
+	}
+}
+
+func matchesAnyType(data interface{}, types []string) bool {
+	dataType := typeOf(data)
+
+	for _, typeName := range types {
+		if typeName == dataType || (typeName == "number" && dataType == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func typeOf(data interface{}) string {
+	switch dataTypeAsserted := data.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if dataTypeAsserted == math.Trunc(dataTypeAsserted) {
+			return "integer"
+		}
+
+		return "number"
+	case string:
+		return "string"
+	default:
+		return fmt.Sprintf("%T", data)
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+	}
+
+	return false
+}
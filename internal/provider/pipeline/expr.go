@@ -0,0 +1,405 @@
+package pipeline
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go-wai-wong/common"
+)
+
+const (
+	// MaxExpressionLength is the longest expression source accepted.
+	MaxExpressionLength = 256
+	// MaxExpressionNodes caps the size of a parsed expression tree.
+	MaxExpressionNodes = 64
+	// valueVariable is the only variable, it is bound to the number being filtered or mapped.
+	valueVariable = "x"
+)
+
+// functions available to expressions, keyed by name with their argument count.
+var functions = map[string]struct {
+	arity int
+	fn    func(args []float64) float64
+}{
+	"abs":   {arity: 1, fn: func(args []float64) float64 { return math.Abs(args[0]) }},
+	"ceil":  {arity: 1, fn: func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"floor": {arity: 1, fn: func(args []float64) float64 { return math.Floor(args[0]) }},
+	"round": {arity: 1, fn: func(args []float64) float64 { return math.Round(args[0]) }},
+	"min":   {arity: 2, fn: func(args []float64) float64 { return math.Min(args[0], args[1]) }},
+	"max":   {arity: 2, fn: func(args []float64) float64 { return math.Max(args[0], args[1]) }},
+}
+
+// Expr is a parsed arithmetic expression, comparisons and logical operators evaluate to 1 or 0 and
+// any non zero value counts as true.
+type Expr struct {
+	source string
+	root   *exprNode
+}
+
+type exprNode struct {
+	op       string
+	number   float64
+	name     string
+	children []*exprNode
+}
+
+type exprToken struct {
+	kind  string // number, ident, op, eof
+	text  string
+	value float64
+	pos   int
+}
+
+type exprParser struct {
+	source string
+	tokens []exprToken
+	pos    int
+	nodes  int
+}
+
+// binaryPrecedence lists binary operators from loosest to tightest binding.
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+const unaryPrecedence = 7
+
+// ParseExpr parses source into an expression, enforcing the length and node limits.
+func ParseExpr(source string) (*Expr, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, common.ExpressionError{Expression: source, Reason: "empty expression"}
+	}
+
+	if len(source) > MaxExpressionLength {
+		return nil, common.ExpressionError{Expression: source, Reason: "expression longer than " + strconv.Itoa(MaxExpressionLength) + " characters"}
+	}
+
+	tokens, err := lexExpr(source)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &exprParser{source: source, tokens: tokens}
+
+	root, err := parser.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if next := parser.peek(); next.kind != "eof" {
+		return nil, parser.errorAt(next, "unexpected "+next.text)
+	}
+
+	return &Expr{source: source, root: root}, nil
+}
+
+func lexExpr(source string) ([]exprToken, error) {
+	tokens := []exprToken{}
+
+	for pos := 0; pos < len(source); {
+		char := rune(source[pos])
+
+		switch {
+		case unicode.IsSpace(char):
+			pos++
+		case unicode.IsDigit(char) || char == '.':
+			start := pos
+			for pos < len(source) && (unicode.IsDigit(rune(source[pos])) || source[pos] == '.') {
+				pos++
+			}
+
+			if pos < len(source) && (source[pos] == 'e' || source[pos] == 'E') {
+				pos++
+				if pos < len(source) && (source[pos] == '+' || source[pos] == '-') {
+					pos++
+				}
+
+				for pos < len(source) && unicode.IsDigit(rune(source[pos])) {
+					pos++
+				}
+			}
+
+			value, err := strconv.ParseFloat(source[start:pos], 64)
+			if err != nil {
+				return nil, common.ExpressionError{Expression: source, Reason: "invalid number " + source[start:pos]}
+			}
+
+			tokens = append(tokens, exprToken{kind: "number", text: source[start:pos], value: value, pos: start})
+		case unicode.IsLetter(char) || char == '_':
+			start := pos
+			for pos < len(source) && (unicode.IsLetter(rune(source[pos])) || unicode.IsDigit(rune(source[pos])) || source[pos] == '_') {
+				pos++
+			}
+
+			tokens = append(tokens, exprToken{kind: "ident", text: source[start:pos], pos: start})
+		default:
+			op := ""
+
+			if pos+1 < len(source) {
+				switch source[pos : pos+2] {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = source[pos : pos+2]
+				}
+			}
+
+			if op == "" && strings.ContainsRune("+-*/%<>!(),", char) {
+				op = string(char)
+			}
+
+			if op == "" {
+				return nil, common.ExpressionError{Expression: source, Reason: "unexpected character " + strconv.QuoteRune(char)}
+			}
+
+			tokens = append(tokens, exprToken{kind: "op", text: op, pos: pos})
+			pos += len(op)
+		}
+	}
+
+	return append(tokens, exprToken{kind: "eof", text: "end of expression", pos: len(source)}), nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	token := p.tokens[p.pos]
+	if token.kind != "eof" {
+		p.pos++
+	}
+
+	return token
+}
+
+func (p *exprParser) errorAt(token exprToken, reason string) error {
+	return common.ExpressionError{Expression: p.source, Reason: reason + " at position " + strconv.Itoa(token.pos)}
+}
+
+func (p *exprParser) newNode(node *exprNode) (*exprNode, error) {
+	p.nodes++
+	if p.nodes > MaxExpressionNodes {
+		return nil, common.ExpressionError{Expression: p.source, Reason: "expression has more than " + strconv.Itoa(MaxExpressionNodes) + " nodes"}
+	}
+
+	return node, nil
+}
+
+// parseBinary is a precedence climbing parser, minPrecedence stops it at looser binding operators.
+func (p *exprParser) parseBinary(minPrecedence int) (*exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token := p.peek()
+
+		precedence, isBinary := binaryPrecedence[token.text]
+		if token.kind != "op" || !isBinary || precedence <= minPrecedence {
+			return left, nil
+		}
+
+		p.next()
+
+		right, err := p.parseBinary(precedence)
+		if err != nil {
+			return nil, err
+		}
+
+		if left, err = p.newNode(&exprNode{op: token.text, children: []*exprNode{left, right}}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (*exprNode, error) {
+	token := p.peek()
+
+	if token.kind == "op" && (token.text == "-" || token.text == "!" || token.text == "+") {
+		p.next()
+
+		operand, err := p.parseBinary(unaryPrecedence)
+		if err != nil {
+			return nil, err
+		}
+
+		return p.newNode(&exprNode{op: "unary" + token.text, children: []*exprNode{operand}})
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (*exprNode, error) {
+	token := p.next()
+
+	switch {
+	case token.kind == "number":
+		return p.newNode(&exprNode{op: "number", number: token.value})
+	case token.kind == "ident" && token.text == valueVariable:
+		return p.newNode(&exprNode{op: "var"})
+	case token.kind == "ident":
+		function, ok := functions[token.text]
+		if !ok {
+			return nil, p.errorAt(token, "unknown identifier "+token.text)
+		}
+
+		if open := p.next(); open.text != "(" {
+			return nil, p.errorAt(open, "expected ( after "+token.text)
+		}
+
+		args := []*exprNode{}
+
+		for len(args) < function.arity {
+			if len(args) > 0 {
+				if comma := p.next(); comma.text != "," {
+					return nil, p.errorAt(comma, "expected , in call to "+token.text)
+				}
+			}
+
+			arg, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+
+			args = append(args, arg)
+		}
+
+		if closing := p.next(); closing.text != ")" {
+			return nil, p.errorAt(closing, token.text+" takes "+strconv.Itoa(function.arity)+" arguments")
+		}
+
+		return p.newNode(&exprNode{op: "call", name: token.text, children: args})
+	case token.kind == "op" && token.text == "(":
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.next(); closing.text != ")" {
+			return nil, p.errorAt(closing, "expected )")
+		}
+
+		return inner, nil
+	default:
+		return nil, p.errorAt(token, "unexpected "+token.text)
+	}
+}
+
+// Eval evaluates the expression with x bound to value, every visited node consumes one step of
+// the budget and evaluation fails once it runs out.
+func (e *Expr) Eval(value float64, budget *Budget) (float64, error) {
+	return e.eval(e.root, value, budget)
+}
+
+func (e *Expr) eval(node *exprNode, value float64, budget *Budget) (float64, error) {
+	if err := budget.spend(); err != nil {
+		return 0, err
+	}
+
+	switch node.op {
+	case "number":
+		return node.number, nil
+	case "var":
+		return value, nil
+	case "call":
+		args := make([]float64, 0, len(node.children))
+
+		for _, child := range node.children {
+			arg, err := e.eval(child, value, budget)
+			if err != nil {
+				return 0, err
+			}
+
+			args = append(args, arg)
+		}
+
+		return functions[node.name].fn(args), nil
+	case "unary-", "unary+", "unary!":
+		operand, err := e.eval(node.children[0], value, budget)
+		if err != nil {
+			return 0, err
+		}
+
+		switch node.op {
+		case "unary-":
+			return -operand, nil
+		case "unary!":
+			return boolToFloat(operand == 0), nil
+		}
+
+		return operand, nil
+	}
+
+	left, err := e.eval(node.children[0], value, budget)
+	if err != nil {
+		return 0, err
+	}
+
+	// short circuit the logical operators
+	if node.op == "&&" && left == 0 {
+		return 0, nil
+	}
+
+	if node.op == "||" && left != 0 {
+		return 1, nil
+	}
+
+	right, err := e.eval(node.children[1], value, budget)
+	if err != nil {
+		return 0, err
+	}
+
+	return e.applyBinary(node.op, left, right)
+}
+
+func (e *Expr) applyBinary(op string, left, right float64) (float64, error) {
+	switch op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/", "%":
+		if right == 0 {
+			return 0, common.ExpressionError{Expression: e.source, Reason: "division by zero"}
+		}
+
+		if op == "%" {
+			return math.Mod(left, right), nil
+		}
+
+		return left / right, nil
+	case "<":
+		return boolToFloat(left < right), nil
+	case "<=":
+		return boolToFloat(left <= right), nil
+	case ">":
+		return boolToFloat(left > right), nil
+	case ">=":
+		return boolToFloat(left >= right), nil
+	case "==":
+		return boolToFloat(left == right), nil
+	case "!=":
+		return boolToFloat(left != right), nil
+	case "&&", "||":
+		return boolToFloat(right != 0), nil
+	}
+
+	return 0, common.ExpressionError{Expression: e.source, Reason: "unknown operator " + op}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
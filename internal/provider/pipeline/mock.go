@@ -0,0 +1,15 @@
+package pipeline
+
+type PipelineClientImplMock struct {
+	RunFn func(document interface{}, spec Spec) (Result, error)
+}
+
+func (c *PipelineClientImplMock) Run(document interface{}, spec Spec) (Result, error) {
+	if c != nil && c.RunFn != nil {
+		return c.RunFn(document, spec)
+	}
+
+	pipelineSrv := New()
+
+	return pipelineSrv.Run(document, spec)
+}
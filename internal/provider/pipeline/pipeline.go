@@ -0,0 +1,244 @@
+package pipeline
+
+import (
+	"math"
+	"strconv"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/provider/jsonprovider"
+)
+
+const (
+	// MaxSteps is the longest pipeline accepted.
+	MaxSteps = 16
+	// MaxEvaluationSteps is the budget shared by selecting and every expression evaluation in a run.
+	MaxEvaluationSteps = 1_000_000
+
+	ReduceSum     = "sum"
+	ReduceProduct = "product"
+	ReduceMin     = "min"
+	ReduceMax     = "max"
+	ReduceCount   = "count"
+	ReduceAvg     = "avg"
+)
+
+// Step has exactly one of its fields set. Select must come first and reduce last, when omitted
+// they default to "$" and "sum".
+type Step struct {
+	Select string `json:"select,omitempty"`
+	Filter string `json:"filter,omitempty"`
+	Map    string `json:"map,omitempty"`
+	Reduce string `json:"reduce,omitempty"`
+}
+
+type Spec struct {
+	Steps []Step `json:"steps"`
+}
+
+type Result struct {
+	Value float64 `json:"value"`
+	Count int     `json:"count"`
+}
+
+// Budget counts down evaluation steps, one is spent per selected node and per expression node
+// evaluated.
+type Budget struct {
+	remaining int
+}
+
+func NewBudget(steps int) *Budget {
+	return &Budget{remaining: steps}
+}
+
+func (b *Budget) spend() error {
+	if b.remaining <= 0 {
+		return common.EvaluationLimitError(MaxEvaluationSteps)
+	}
+
+	b.remaining--
+
+	return nil
+}
+
+type Service interface {
+	Run(document interface{}, spec Spec) (Result, error)
+}
+
+type pipelineImpl struct{}
+
+// verify interface compliance
+var _ Service = (*pipelineImpl)(nil)
+
+func New() pipelineImpl {
+	return pipelineImpl{}
+}
+
+type compiledStep struct {
+	filter *Expr
+	mapper *Expr
+}
+
+// Run selects the numbers under the selected nodes, then filters and maps them in step order and
+// finally reduces them to a single value.
+func (c pipelineImpl) Run(document interface{}, spec Spec) (Result, error) {
+	selector, steps, reduce, err := compile(spec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	budget := NewBudget(MaxEvaluationSteps)
+
+	selected, err := selector.Select(document, budget)
+	if err != nil {
+		return Result{}, err
+	}
+
+	values := []float64{}
+
+	for _, node := range selected {
+		if err := jsonprovider.New().Walk(node, func(pointer string, value interface{}) error {
+			if number, ok := value.(float64); ok {
+				values = append(values, number)
+			}
+
+			return budget.spend()
+		}); err != nil {
+			return Result{}, err
+		}
+	}
+
+	for _, step := range steps {
+		next := make([]float64, 0, len(values))
+
+		for _, value := range values {
+			if step.filter != nil {
+				keep, err := step.filter.Eval(value, budget)
+				if err != nil {
+					return Result{}, err
+				}
+
+				if keep != 0 {
+					next = append(next, value)
+				}
+
+				continue
+			}
+
+			mapped, err := step.mapper.Eval(value, budget)
+			if err != nil {
+				return Result{}, err
+			}
+
+			next = append(next, mapped)
+		}
+
+		values = next
+	}
+
+	result := reduceValues(reduce, values)
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return Result{}, common.ExpressionError{Expression: reduce, Reason: "result is not a finite number"}
+	}
+
+	return Result{Value: result, Count: len(values)}, nil
+}
+
+func compile(spec Spec) (*Selector, []compiledStep, string, error) {
+	if len(spec.Steps) > MaxSteps {
+		return nil, nil, "", common.PipelineError{Step: MaxSteps, Reason: "pipeline has more than " + strconv.Itoa(MaxSteps) + " steps"}
+	}
+
+	selectorSource, reduce := "$", ReduceSum
+	steps := []compiledStep{}
+
+	for index, step := range spec.Steps {
+		set := 0
+		for _, field := range []string{step.Select, step.Filter, step.Map, step.Reduce} {
+			if field != "" {
+				set++
+			}
+		}
+
+		if set != 1 {
+			return nil, nil, "", common.PipelineError{Step: index, Reason: "step must have exactly one of select, filter, map or reduce"}
+		}
+
+		var err error
+
+		switch {
+		case step.Select != "":
+			if index != 0 {
+				return nil, nil, "", common.PipelineError{Step: index, Reason: "select must be the first step"}
+			}
+
+			selectorSource = step.Select
+		case step.Reduce != "":
+			if index != len(spec.Steps)-1 {
+				return nil, nil, "", common.PipelineError{Step: index, Reason: "reduce must be the last step"}
+			}
+
+			reduce = step.Reduce
+		case step.Filter != "":
+			compiled := compiledStep{}
+			if compiled.filter, err = ParseExpr(step.Filter); err != nil {
+				return nil, nil, "", common.PipelineError{Step: index, Reason: err.Error()}
+			}
+
+			steps = append(steps, compiled)
+		default:
+			compiled := compiledStep{}
+			if compiled.mapper, err = ParseExpr(step.Map); err != nil {
+				return nil, nil, "", common.PipelineError{Step: index, Reason: err.Error()}
+			}
+
+			steps = append(steps, compiled)
+		}
+	}
+
+	switch reduce {
+	case ReduceSum, ReduceProduct, ReduceMin, ReduceMax, ReduceCount, ReduceAvg:
+	default:
+		return nil, nil, "", common.PipelineError{Step: len(spec.Steps) - 1, Reason: "unknown reduce " + reduce}
+	}
+
+	selector, err := ParseSelector(selectorSource)
+	if err != nil {
+		return nil, nil, "", common.PipelineError{Step: 0, Reason: err.Error()}
+	}
+
+	return selector, steps, reduce, nil
+}
+
+func reduceValues(reduce string, values []float64) float64 {
+	if len(values) == 0 {
+		if reduce == ReduceProduct {
+			return 1
+		}
+
+		return 0
+	}
+
+	result := values[0]
+
+	for _, value := range values[1:] {
+		switch reduce {
+		case ReduceSum, ReduceAvg:
+			result += value
+		case ReduceProduct:
+			result *= value
+		case ReduceMin:
+			result = math.Min(result, value)
+		case ReduceMax:
+			result = math.Max(result, value)
+		}
+	}
+
+	switch reduce {
+	case ReduceCount:
+		return float64(len(values))
+	case ReduceAvg:
+		return result / float64(len(values))
+	}
+
+	return result
+}
@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_Run(t *testing.T) {
+	t.Parallel()
+
+	document := `{
+		"prices": [10, -5, {"net": 20}, "free"],
+		"discounts": {"a": 2, "b": [3]},
+		"meta": {"prices": [100]}
+	}`
+
+	tests := []struct {
+		name           string
+		steps          []Step
+		expectedResult float64
+		expectedCount  int
+		wantErr        string
+	}{
+		{
+			name:           "run-defaultSumsEverything",
+			steps:          []Step{},
+			expectedResult: 130,
+			expectedCount:  6,
+		},
+		{
+			name: "run-selectMapFilterSum",
+			steps: []Step{
+				{Select: "$.prices"},
+				{Map: "x * 1.5"},
+				{Filter: "x >= 0"},
+				{Reduce: ReduceSum},
+			},
+			expectedResult: 45,
+			expectedCount:  2,
+		},
+		{
+			name:           "run-recursiveDescentMax",
+			steps:          []Step{{Select: "$..prices[0]"}, {Reduce: ReduceMax}},
+			expectedResult: 100,
+			expectedCount:  2,
+		},
+		{
+			name:           "run-wildcardCount",
+			steps:          []Step{{Select: "$.discounts.*"}, {Reduce: ReduceCount}},
+			expectedResult: 2,
+			expectedCount:  2,
+		},
+		{
+			name:           "run-functionsAndLogic",
+			steps:          []Step{{Select: "$['prices']"}, {Filter: "!(x < 0) && x % 2 == 0"}, {Map: "max(abs(x), 15)"}, {Reduce: ReduceAvg}},
+			expectedResult: 17.5,
+			expectedCount:  2,
+		},
+		{
+			name:    "run-reduceNotLastErr",
+			steps:   []Step{{Reduce: ReduceSum}, {Map: "x"}},
+			wantErr: "common.PipelineError",
+		},
+		{
+			name:    "run-twoFieldsErr",
+			steps:   []Step{{Map: "x", Filter: "x"}},
+			wantErr: "common.PipelineError",
+		},
+		{
+			name:    "run-unknownIdentifierErr",
+			steps:   []Step{{Map: "y + 1"}},
+			wantErr: "common.PipelineError",
+		},
+		{
+			name:    "run-tooManyNodesErr",
+			steps:   []Step{{Map: strings.Repeat("x+", 40) + "x"}},
+			wantErr: "common.PipelineError",
+		},
+		{
+			name:    "run-divisionByZeroErr",
+			steps:   []Step{{Map: "x / 0"}},
+			wantErr: "common.ExpressionError",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var data interface{}
+			if err := json.Unmarshal([]byte(document), &data); err != nil {
+				t.Fatalf("could not unmarshal document: %v", err)
+			}
+
+			result, err := New().Run(data, Spec{Steps: tt.steps})
+
+			if tt.wantErr != "" {
+				if fmt.Sprintf("%T", err) != tt.wantErr {
+					t.Fatalf("Run() error = %v, want error of type %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Run() unexpected error = %v", err)
+			}
+
+			if result.Value != tt.expectedResult || result.Count != tt.expectedCount {
+				t.Fatalf("expected result: %v count: %v, got: %+v", tt.expectedResult, tt.expectedCount, result)
+			}
+		})
+	}
+}
+
+func Test_EvalBudget(t *testing.T) {
+	t.Parallel()
+
+	expr, err := ParseExpr("x * 2 + 1")
+	if err != nil {
+		t.Fatalf("could not parse expression: %v", err)
+	}
+
+	budget := NewBudget(8)
+
+	if _, err := expr.Eval(1, budget); err != nil {
+		t.Fatalf("first evaluation should fit the budget: %v", err)
+	}
+
+	if _, err := expr.Eval(1, budget); err == nil {
+		t.Fatalf("second evaluation should exceed the budget")
+	}
+}
@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"strconv"
+	"strings"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/provider/jsonprovider"
+)
+
+// pathSegment is one step of a selector, name is empty for wildcards and index is -1 unless the
+// segment is an array index.
+type pathSegment struct {
+	name      string
+	index     int
+	wildcard  bool
+	recursive bool
+}
+
+// Selector is a parsed JSONPath subset: $, .name, ['name'], [index], [*], .* and ..name.
+type Selector struct {
+	source   string
+	segments []pathSegment
+}
+
+// ParseSelector parses a JSONPath expression, only the subset described on Selector is supported.
+func ParseSelector(source string) (*Selector, error) {
+	if len(source) > MaxExpressionLength {
+		return nil, common.ExpressionError{Expression: source, Reason: "selector longer than " + strconv.Itoa(MaxExpressionLength) + " characters"}
+	}
+
+	if !strings.HasPrefix(source, "$") {
+		return nil, common.ExpressionError{Expression: source, Reason: "selector must start with $"}
+	}
+
+	selector := &Selector{source: source}
+
+	for pos := 1; pos < len(source); {
+		segment := pathSegment{index: -1}
+
+		switch {
+		case strings.HasPrefix(source[pos:], ".."):
+			segment.recursive = true
+			pos += 2
+		case source[pos] == '.':
+			pos++
+		case source[pos] == '[':
+		default:
+			return nil, common.ExpressionError{Expression: source, Reason: "unexpected character at position " + strconv.Itoa(pos)}
+		}
+
+		var err error
+
+		if pos < len(source) && source[pos] == '[' {
+			pos, err = parseBracket(source, pos, &segment)
+		} else {
+			pos, err = parseName(source, pos, &segment)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		selector.segments = append(selector.segments, segment)
+	}
+
+	return selector, nil
+}
+
+func parseName(source string, pos int, segment *pathSegment) (int, error) {
+	if pos < len(source) && source[pos] == '*' {
+		segment.wildcard = true
+
+		return pos + 1, nil
+	}
+
+	start := pos
+	for pos < len(source) && source[pos] != '.' && source[pos] != '[' {
+		pos++
+	}
+
+	if pos == start {
+		return 0, common.ExpressionError{Expression: source, Reason: "missing member name at position " + strconv.Itoa(start)}
+	}
+
+	segment.name = source[start:pos]
+
+	return pos, nil
+}
+
+func parseBracket(source string, pos int, segment *pathSegment) (int, error) {
+	end := strings.IndexByte(source[pos:], ']')
+	if end < 0 {
+		return 0, common.ExpressionError{Expression: source, Reason: "unterminated [ at position " + strconv.Itoa(pos)}
+	}
+
+	inner := source[pos+1 : pos+end]
+
+	switch {
+	case inner == "*":
+		segment.wildcard = true
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		segment.name = inner[1 : len(inner)-1]
+	default:
+		index, err := strconv.Atoi(inner)
+		if err != nil || index < 0 {
+			return 0, common.ExpressionError{Expression: source, Reason: "invalid index [" + inner + "]"}
+		}
+
+		segment.index = index
+	}
+
+	return pos + end + 1, nil
+}
+
+// Select returns the nodes of document matched by the selector.
+func (s *Selector) Select(document interface{}, budget *Budget) ([]interface{}, error) {
+	current := []interface{}{document}
+
+	for _, segment := range s.segments {
+		next := []interface{}{}
+
+		for _, node := range current {
+			candidates := []interface{}{node}
+
+			if segment.recursive {
+				candidates = candidates[:0]
+
+				if err := jsonprovider.New().Walk(node, func(pointer string, value interface{}) error {
+					candidates = append(candidates, value)
+
+					return budget.spend()
+				}); err != nil {
+					return nil, err
+				}
+			}
+
+			for _, candidate := range candidates {
+				if err := budget.spend(); err != nil {
+					return nil, err
+				}
+
+				next = append(next, segment.match(candidate)...)
+			}
+		}
+
+		current = next
+	}
+
+	return current, nil
+}
+
+func (segment pathSegment) match(node interface{}) []interface{} {
+	switch nodeTypeAsserted := node.(type) {
+	case map[string]interface{}:
+		if segment.wildcard {
+			matched := make([]interface{}, 0, len(nodeTypeAsserted))
+			for _, key := range jsonprovider.SortedKeys(nodeTypeAsserted) {
+				matched = append(matched, nodeTypeAsserted[key])
+			}
+
+			return matched
+		}
+
+		if value, ok := nodeTypeAsserted[segment.name]; ok && segment.index < 0 {
+			return []interface{}{value}
+		}
+	case []interface{}:
+		if segment.wildcard {
+			return nodeTypeAsserted
+		}
+
+		if segment.index >= 0 && segment.index < len(nodeTypeAsserted) {
+			return []interface{}{nodeTypeAsserted[segment.index]}
+		}
+	}
+
+	return nil
+}
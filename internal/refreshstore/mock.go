@@ -0,0 +1,48 @@
+package refreshstore
+
+type RefreshStoreClientImplMock struct {
+	SaveFn          func(tokenHash string, record Record) error
+	UseFn           func(tokenHash string) (Record, error)
+	RevokeFamilyFn  func(family string) error
+	FamilyRevokedFn func(family string) (bool, error)
+}
+
+func (c *RefreshStoreClientImplMock) Save(tokenHash string, record Record) error {
+	if c != nil && c.SaveFn != nil {
+		return c.SaveFn(tokenHash, record)
+	}
+
+	refreshStoreSrv := New()
+
+	return refreshStoreSrv.Save(tokenHash, record)
+}
+
+func (c *RefreshStoreClientImplMock) Use(tokenHash string) (Record, error) {
+	if c != nil && c.UseFn != nil {
+		return c.UseFn(tokenHash)
+	}
+
+	refreshStoreSrv := New()
+
+	return refreshStoreSrv.Use(tokenHash)
+}
+
+func (c *RefreshStoreClientImplMock) RevokeFamily(family string) error {
+	if c != nil && c.RevokeFamilyFn != nil {
+		return c.RevokeFamilyFn(family)
+	}
+
+	refreshStoreSrv := New()
+
+	return refreshStoreSrv.RevokeFamily(family)
+}
+
+func (c *RefreshStoreClientImplMock) FamilyRevoked(family string) (bool, error) {
+	if c != nil && c.FamilyRevokedFn != nil {
+		return c.FamilyRevokedFn(family)
+	}
+
+	refreshStoreSrv := New()
+
+	return refreshStoreSrv.FamilyRevoked(family)
+}
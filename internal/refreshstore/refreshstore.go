@@ -0,0 +1,136 @@
+package refreshstore
+
+import (
+	"sync"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+// Record is the state of a refresh token. Every token rotated from the same login shares a
+// family so reuse of one rotated token can revoke all of them. TokenVersion is the token version of
+// the subject at login, a password change since then invalidates the family. AMR are the methods of
+// the login, refreshed tokens keep them. A family started over a connection with a client
+// certificate keeps its CertificateThumbprint and can only be refreshed with that certificate.
+type Record struct {
+	Family                string
+	Subject               string
+	ExpiresAt             time.Time
+	Used                  bool
+	TokenVersion          int
+	AMR                   []string
+	CertificateThumbprint string
+}
+
+// Service stores refresh tokens by the hash of the token, the token itself is never stored.
+type Service interface {
+	Save(tokenHash string, record Record) error
+	// Use marks the token used and returns the record as it was before, of two concurrent calls
+	// only one sees Used false.
+	Use(tokenHash string) (Record, error)
+	RevokeFamily(family string) error
+	FamilyRevoked(family string) (bool, error)
+}
+
+// refreshStoreImpl keeps refresh tokens in memory, they are lost on restart which only means
+// clients have to log in again.
+type refreshStoreImpl struct {
+	mu      *sync.Mutex
+	records map[string]Record
+	revoked map[string]time.Time
+	now     func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*refreshStoreImpl)(nil)
+
+func New() refreshStoreImpl {
+	return refreshStoreImpl{
+		mu:      &sync.Mutex{},
+		records: map[string]Record{},
+		revoked: map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+// WithClock returns a copy of the store that reads the time from now.
+func (c refreshStoreImpl) WithClock(now func() time.Time) Service {
+	c.now = now
+
+	return c
+}
+
+// Save stores record and drops expired records and revoked families so the maps do not grow
+// without bound.
+func (c refreshStoreImpl) Save(tokenHash string, record Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for hash, stored := range c.records {
+		if now.After(stored.ExpiresAt) {
+			delete(c.records, hash)
+		}
+	}
+
+	for family, expiresAt := range c.revoked {
+		if now.After(expiresAt) {
+			delete(c.revoked, family)
+		}
+	}
+
+	c.records[tokenHash] = record
+
+	return nil
+}
+
+func (c refreshStoreImpl) Use(tokenHash string) (Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record, ok := c.records[tokenHash]
+	if !ok {
+		return Record{}, common.InvalidGrantError("refresh token not found")
+	}
+
+	used := record
+	used.Used = true
+	c.records[tokenHash] = used
+
+	return record, nil
+}
+
+// RevokeFamily removes every token of the family and remembers the family until its newest token
+// would have expired.
+func (c refreshStoreImpl) RevokeFamily(family string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	revokedUntil := c.now()
+
+	for hash, record := range c.records {
+		if record.Family != family {
+			continue
+		}
+
+		if record.ExpiresAt.After(revokedUntil) {
+			revokedUntil = record.ExpiresAt
+		}
+
+		delete(c.records, hash)
+	}
+
+	c.revoked[family] = revokedUntil
+
+	return nil
+}
+
+func (c refreshStoreImpl) FamilyRevoked(family string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, revoked := c.revoked[family]
+
+	return revoked, nil
+}
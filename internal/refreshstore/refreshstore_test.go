@@ -0,0 +1,126 @@
+package refreshstore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+func newTestStore(now *time.Time) refreshStoreImpl {
+	return refreshStoreImpl{
+		mu:      &sync.Mutex{},
+		records: map[string]Record{},
+		revoked: map[string]time.Time{},
+		now:     func() time.Time { return *now },
+	}
+}
+
+func Test_Use(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	refreshStoreSrv := newTestStore(&now)
+
+	if err := refreshStoreSrv.Save("token", Record{Family: "family", Subject: "alice", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("refreshStoreImpl.Save() error = %v", err)
+	}
+
+	record, err := refreshStoreSrv.Use("token")
+	if err != nil || record.Subject != "alice" || record.Used {
+		t.Fatalf("refreshStoreImpl.Use() = %v, %v, want the unused record of alice", record, err)
+	}
+
+	// a second use sees the token used so the caller can revoke the family
+	if record, err := refreshStoreSrv.Use("token"); err != nil || !record.Used {
+		t.Fatalf("refreshStoreImpl.Use() = %v, %v, want the used record", record, err)
+	}
+
+	if _, err := refreshStoreSrv.Use("unknown"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("refreshStoreImpl.Use() error = %v, want InvalidGrantError for an unknown token", err)
+	}
+}
+
+func Test_SaveDropsExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	refreshStoreSrv := newTestStore(&now)
+
+	if err := refreshStoreSrv.Save("expiring", Record{Family: "expiring", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("refreshStoreImpl.Save() error = %v", err)
+	}
+
+	if err := refreshStoreSrv.Save("kept", Record{Family: "kept", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("refreshStoreImpl.Save() error = %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if err := refreshStoreSrv.Save("new", Record{Family: "new", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("refreshStoreImpl.Save() error = %v", err)
+	}
+
+	if _, err := refreshStoreSrv.Use("expiring"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("refreshStoreImpl.Use() error = %v, want InvalidGrantError for a dropped token", err)
+	}
+
+	if _, err := refreshStoreSrv.Use("kept"); err != nil {
+		t.Fatalf("refreshStoreImpl.Use() error = %v, want the unexpired token kept", err)
+	}
+}
+
+func Test_RevokeFamily(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	refreshStoreSrv := newTestStore(&now)
+
+	for hash, record := range map[string]Record{
+		"first":  {Family: "family", ExpiresAt: now.Add(time.Minute)},
+		"second": {Family: "family", ExpiresAt: now.Add(time.Hour)},
+		"other":  {Family: "other", ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := refreshStoreSrv.Save(hash, record); err != nil {
+			t.Fatalf("refreshStoreImpl.Save() error = %v", err)
+		}
+	}
+
+	if err := refreshStoreSrv.RevokeFamily("family"); err != nil {
+		t.Fatalf("refreshStoreImpl.RevokeFamily() error = %v", err)
+	}
+
+	if _, err := refreshStoreSrv.Use("second"); !errors.As(err, new(common.InvalidGrantError)) {
+		t.Fatalf("refreshStoreImpl.Use() error = %v, want InvalidGrantError for a revoked token", err)
+	}
+
+	if _, err := refreshStoreSrv.Use("other"); err != nil {
+		t.Fatalf("refreshStoreImpl.Use() error = %v, want the token of another family kept", err)
+	}
+
+	// the family is remembered until its newest token would have expired
+	now = now.Add(30 * time.Minute)
+
+	if err := refreshStoreSrv.Save("new", Record{Family: "new", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("refreshStoreImpl.Save() error = %v", err)
+	}
+
+	if revoked, err := refreshStoreSrv.FamilyRevoked("family"); err != nil || !revoked {
+		t.Fatalf("refreshStoreImpl.FamilyRevoked() = %v, %v, want revoked", revoked, err)
+	}
+
+	now = now.Add(time.Hour)
+
+	if err := refreshStoreSrv.Save("newer", Record{Family: "newer", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("refreshStoreImpl.Save() error = %v", err)
+	}
+
+	if revoked, err := refreshStoreSrv.FamilyRevoked("family"); err != nil || revoked {
+		t.Fatalf("refreshStoreImpl.FamilyRevoked() = %v, %v, want the family forgotten", revoked, err)
+	}
+}
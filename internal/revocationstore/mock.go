@@ -0,0 +1,28 @@
+package revocationstore
+
+import "time"
+
+type RevocationStoreClientImplMock struct {
+	RevokeFn  func(jti string, expiresAt time.Time) error
+	RevokedFn func(jti string) (bool, error)
+}
+
+func (c *RevocationStoreClientImplMock) Revoke(jti string, expiresAt time.Time) error {
+	if c != nil && c.RevokeFn != nil {
+		return c.RevokeFn(jti, expiresAt)
+	}
+
+	revocationStoreSrv := New()
+
+	return revocationStoreSrv.Revoke(jti, expiresAt)
+}
+
+func (c *RevocationStoreClientImplMock) Revoked(jti string) (bool, error) {
+	if c != nil && c.RevokedFn != nil {
+		return c.RevokedFn(jti)
+	}
+
+	revocationStoreSrv := New()
+
+	return revocationStoreSrv.Revoked(jti)
+}
@@ -0,0 +1,76 @@
+package revocationstore
+
+import (
+	"sync"
+	"time"
+)
+
+// Service records revoked token ids until the token would have expired anyway, after that the
+// signature check rejects the token on its own.
+type Service interface {
+	Revoke(jti string, expiresAt time.Time) error
+	Revoked(jti string) (bool, error)
+}
+
+// revocationStoreImpl keeps revoked token ids in memory, persistent backends implement Service.
+type revocationStoreImpl struct {
+	mu      *sync.Mutex
+	revoked map[string]time.Time
+	now     func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*revocationStoreImpl)(nil)
+
+func New() revocationStoreImpl {
+	return revocationStoreImpl{
+		mu:      &sync.Mutex{},
+		revoked: map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+// WithClock returns a copy of the store that reads the time from now.
+func (c revocationStoreImpl) WithClock(now func() time.Time) Service {
+	c.now = now
+
+	return c
+}
+
+// Revoke records jti until expiresAt and drops the entries that have expired.
+func (c revocationStoreImpl) Revoke(jti string, expiresAt time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for revokedJti, revokedUntil := range c.revoked {
+		if !now.Before(revokedUntil) {
+			delete(c.revoked, revokedJti)
+		}
+	}
+
+	if now.Before(expiresAt) {
+		c.revoked[jti] = expiresAt
+	}
+
+	return nil
+}
+
+func (c revocationStoreImpl) Revoked(jti string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	revokedUntil, ok := c.revoked[jti]
+	if !ok {
+		return false, nil
+	}
+
+	if !c.now().Before(revokedUntil) {
+		delete(c.revoked, jti)
+
+		return false, nil
+	}
+
+	return true, nil
+}
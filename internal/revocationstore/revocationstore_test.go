@@ -0,0 +1,62 @@
+package revocationstore
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Revoked(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	revocationStoreSrv := revocationStoreImpl{
+		mu:      &sync.Mutex{},
+		revoked: map[string]time.Time{},
+		now:     func() time.Time { return now },
+	}
+
+	if err := revocationStoreSrv.Revoke("short", now.Add(time.Minute)); err != nil {
+		t.Fatalf("revocationStoreImpl.Revoke() error = %v", err)
+	}
+
+	if err := revocationStoreSrv.Revoke("long", now.Add(time.Hour)); err != nil {
+		t.Fatalf("revocationStoreImpl.Revoke() error = %v", err)
+	}
+
+	if err := revocationStoreSrv.Revoke("expired", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("revocationStoreImpl.Revoke() error = %v", err)
+	}
+
+	tests := []struct {
+		jti  string
+		at   time.Time
+		want bool
+	}{
+		{jti: "short", at: now, want: true},
+		{jti: "long", at: now, want: true},
+		{jti: "expired", at: now, want: false},
+		{jti: "unknown", at: now, want: false},
+		{jti: "short", at: now.Add(time.Minute), want: false},
+		{jti: "long", at: now.Add(time.Minute), want: true},
+	}
+
+	for _, tt := range tests {
+		now = tt.at
+
+		got, err := revocationStoreSrv.Revoked(tt.jti)
+		if err != nil {
+			t.Fatalf("revocationStoreImpl.Revoked(%v) error = %v", tt.jti, err)
+		}
+
+		if got != tt.want {
+			t.Fatalf("revocationStoreImpl.Revoked(%v) at %v = %v, want %v", tt.jti, tt.at, got, tt.want)
+		}
+	}
+
+	// entries are dropped once the token has expired
+	if _, ok := revocationStoreSrv.revoked["short"]; ok {
+		t.Fatalf("revocationStoreImpl kept the expired entry for short")
+	}
+}
@@ -0,0 +1,131 @@
+package sumapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonschema"
+
+	"github.com/go-chi/chi"
+)
+
+type SchemaListResponse struct {
+	Names []string `json:"names"`
+}
+
+const subjectCtxKey = "b6f1c1f4-6c1e-4a55-a3a4-1d2f0e5b7c91"
+
+func withSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectCtxKey, subject)
+}
+
+func subjectFromContext(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectCtxKey).(string)
+
+	return subject
+}
+
+func handlePutSchema(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var jsonSchemaSrv jsonschema.Service
+
+	if err := jsonschema.FromContextAs(
+		ctx,
+		&jsonSchemaSrv); err != nil {
+		log.Printf("json schema service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	requestBodyBuf := &bytes.Buffer{}
+
+	if _, err := goLibSrv.Copy(requestBodyBuf, request.Body); err != nil {
+		log.Printf("io copy error: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var schemaDocument interface{}
+
+	if unmarshalErr := goLibSrv.Unmarshal(requestBodyBuf.Bytes(), &schemaDocument); unmarshalErr != nil {
+		log.Printf("failed to unmarshal: %v", unmarshalErr)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	name := chi.URLParam(request, "name")
+
+	if err := jsonSchemaSrv.Register(name, schemaDocument); err != nil {
+		log.Printf("failed to register schema: %v", err)
+
+		var schemaErr common.SchemaError
+		if errors.As(err, &schemaErr) {
+			common.WriteError(respWriter, http.StatusBadRequest, "INVALID_SCHEMA", schemaErr.Error())
+
+			return
+		}
+
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func handleDeleteSchema(respWriter http.ResponseWriter, request *http.Request) {
+	var jsonSchemaSrv jsonschema.Service
+
+	if err := jsonschema.FromContextAs(
+		request.Context(),
+		&jsonSchemaSrv); err != nil {
+		log.Printf("json schema service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := jsonSchemaSrv.Remove(chi.URLParam(request, "name")); err != nil {
+		log.Printf("failed to remove schema: %v", err)
+		common.WriteError(respWriter, http.StatusNotFound, "NOT_FOUND", "schema not found")
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func handleListSchemas(respWriter http.ResponseWriter, request *http.Request) {
+	var jsonSchemaSrv jsonschema.Service
+
+	if err := jsonschema.FromContextAs(
+		request.Context(),
+		&jsonSchemaSrv); err != nil {
+		log.Printf("json schema service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &SchemaListResponse{Names: jsonSchemaSrv.Names()})
+}
@@ -0,0 +1,117 @@
+package sumapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonschema"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_adminSchemas(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config.LoadConfig()
+
+	client := &http.Client{}
+
+	tests := []struct {
+		name               string
+		scope              string
+		method             string
+		url                string
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			name:               "adminSchemas-notAdmin",
+			scope:              "sum:write",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/schemas/test",
+			body:               `{"type": "object"}`,
+			expectedStatusCode: 403,
+		},
+		{
+			name:               "adminSchemas-register",
+			scope:              "admin",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/schemas/test",
+			body:               `{"type": "object"}`,
+			expectedStatusCode: 204,
+		},
+		{
+			name:               "adminSchemas-invalidSchema",
+			scope:              "admin",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/schemas/test",
+			body:               `{"type": "float"}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "adminSchemas-deleteMissing",
+			scope:              "admin",
+			method:             "DELETE",
+			url:                "/sumapi/v1/admin/schemas/missing",
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "adminSchemas-list",
+			scope:              "admin",
+			method:             "GET",
+			url:                "/sumapi/v1/admin/schemas",
+			expectedStatusCode: 200,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(jsonschema.Inject(jsonschema.New()))
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), &tokenhelper.Claims{Scope: tt.scope})))
+				})
+			})
+
+			router.Route("/sumapi/v1/admin", func(router chi.Router) {
+				router.Use(RequireScope(scopeAdmin))
+				router.Get("/schemas", handleListSchemas)
+				router.Put("/schemas/{name}", handlePutSchema)
+				router.Delete("/schemas/{name}", handleDeleteSchema)
+			})
+
+			request, err := http.NewRequestWithContext(ctx, tt.method, server.URL+tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+		})
+	}
+}
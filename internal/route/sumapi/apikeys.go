@@ -0,0 +1,387 @@
+package sumapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/apikeystore"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+)
+
+const (
+	// API keys look like sak_<id>_<secret>, the id is the public part used to look up the key
+	apiKeyPrefix      = "sak"
+	apiKeyIDBytes     = 6
+	apiKeySecretBytes = 32
+
+	apiKeyHeader = "X-API-Key"
+	apiKeyScheme = "ApiKey "
+)
+
+const apiKeyCtxKey = "b7d3f0a2-58c4-4e19-8a6f-2c9e71d4b5a3"
+
+type APIKeyRequestBody struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is in seconds, without it the key lives for apikeys.maxexpiresin
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// APIKeyResponse is an API key without its secret, Key is only set when the key is created.
+type APIKeyResponse struct {
+	ID         string   `json:"id"`
+	Key        string   `json:"key,omitempty"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  int64    `json:"created_at"`
+	ExpiresAt  int64    `json:"expires_at"`
+	LastUsedAt int64    `json:"last_used_at,omitempty"`
+}
+
+type APIKeyListResponse struct {
+	Keys []APIKeyResponse `json:"keys"`
+}
+
+func withAPIKey(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, apiKeyCtxKey, id)
+}
+
+// apiKeyFromContext returns the id of the API key the request was authenticated with, empty for
+// bearer tokens.
+func apiKeyFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyCtxKey).(string)
+
+	return id
+}
+
+// apiKeyOf returns the API key of the request, sent as X-API-Key or as Authorization: ApiKey.
+func apiKeyOf(request *http.Request) (string, bool) {
+	if apiKey := request.Header.Get(apiKeyHeader); apiKey != "" {
+		return apiKey, true
+	}
+
+	if auth := request.Header.Get("Authorization"); strings.HasPrefix(auth, apiKeyScheme) {
+		return strings.TrimPrefix(auth, apiKeyScheme), true
+	}
+
+	return "", false
+}
+
+func parseAPIKey(apiKey string) (string, string, bool) {
+	parts := strings.Split(apiKey, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+
+	return parts[1], parts[2], true
+}
+
+func toAPIKeyResponse(key apikeystore.Key) APIKeyResponse {
+	response := APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Unix(),
+		ExpiresAt: key.ExpiresAt.Unix(),
+	}
+
+	if !key.LastUsedAt.IsZero() {
+		response.LastUsedAt = key.LastUsedAt.Unix()
+	}
+
+	return response
+}
+
+// authenticateAPIKey returns the claims of a request authenticated with apiKey. The key only gets
+// the scopes its user still has, so removing a role also narrows the keys of the user. Writes a 401
+// and returns false for invalid keys, keys of disabled users and keys created before the token
+// version of the user changed.
+func authenticateAPIKey(respWriter http.ResponseWriter, request *http.Request, apiKey string) (*tokenhelper.Claims, bool) {
+	ctx := request.Context()
+
+	var apiKeyStoreSrv apikeystore.Service
+
+	if err := apikeystore.FromContextAs(
+		ctx,
+		&apiKeyStoreSrv); err != nil {
+		log.Printf("api key store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return nil, false
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return nil, false
+	}
+
+	writeInvalidAPIKey := func(err error) {
+		log.Printf("failed to verify api key: %v", err)
+		respWriter.Header().Add("WWW-Authenticate", "ApiKey")
+		common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_API_KEY", "api key invalid")
+	}
+
+	id, secret, ok := parseAPIKey(apiKey)
+	if !ok {
+		writeInvalidAPIKey(common.InvalidAPIKeyError(""))
+
+		return nil, false
+	}
+
+	key, err := apiKeyStoreSrv.Authenticate(id, secret)
+	if err != nil {
+		writeInvalidAPIKey(err)
+
+		return nil, false
+	}
+
+	user, err := userStoreSrv.Get(key.Subject)
+	if err != nil || user.Disabled || key.TokenVersion != userStoreSrv.TokenVersion(key.Subject) {
+		writeInvalidAPIKey(common.InvalidAPIKeyError(id))
+
+		return nil, false
+	}
+
+	userScopes := map[string]bool{}
+	for _, scope := range scopesForAMR(scopesOf(rolesOf(user)), nil) {
+		userScopes[scope] = true
+	}
+
+	scopes := []string{}
+
+	for _, scope := range key.Scopes {
+		if userScopes[scope] {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &tokenhelper.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   key.Subject,
+			Id:        key.ID,
+			ExpiresAt: key.ExpiresAt.Unix(),
+		},
+		Scope: strings.Join(scopes, " "),
+		Roles: rolesOf(user),
+	}, true
+}
+
+// RequireBearer only lets through requests authenticated with a token, API keys are static
+// credentials so they cannot manage the account or other keys.
+func RequireBearer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, request *http.Request) {
+		if apiKeyFromContext(request.Context()) != "" {
+			log.Printf("api key: %q used for an endpoint that needs a token", apiKeyFromContext(request.Context()))
+			common.WriteError(respWriter, http.StatusForbidden, "FORBIDDEN", "this endpoint needs a bearer token")
+
+			return
+		}
+
+		next.ServeHTTP(respWriter, request)
+	})
+}
+
+func newAPIKey() (string, string, error) {
+	idBytes := make([]byte, apiKeyIDBytes)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	secretBytes := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return hex.EncodeToString(idBytes), hex.EncodeToString(secretBytes), nil
+}
+
+// handleCreateAPIKey creates an API key for the token subject. The key can only get scopes the
+// token has, and never the scopes that need a second factor.
+func handleCreateAPIKey(respWriter http.ResponseWriter, request *http.Request) {
+	var apiKeyStoreSrv apikeystore.Service
+
+	if err := apikeystore.FromContextAs(
+		request.Context(),
+		&apiKeyStoreSrv); err != nil {
+		log.Printf("api key store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		request.Context(),
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	// keys authenticate as their owner through the user store, so only users can own them and
+	// not the clients of the client credentials grant
+	if _, err := userStoreSrv.Get(subjectFromContext(request.Context())); err != nil {
+		log.Printf("subject: %q is not a user: %v", subjectFromContext(request.Context()), err)
+		common.WriteError(respWriter, http.StatusForbidden, "USER_REQUIRED", "only users can create api keys")
+
+		return
+	}
+
+	var apiKeyRequestBody APIKeyRequestBody
+
+	if !readUserBody(respWriter, request, &apiKeyRequestBody) {
+		return
+	}
+
+	if len(apiKeyRequestBody.Scopes) == 0 {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "scopes are required")
+
+		return
+	}
+
+	claims := claimsFromContext(request.Context())
+
+	for _, scope := range apiKeyRequestBody.Scopes {
+		if mfaScopes[scope] || claims == nil || !claims.HasScope(scope) {
+			log.Printf("subject: %q requested api key scope: %q", subjectFromContext(request.Context()), scope)
+			common.WriteError(respWriter, http.StatusBadRequest, "INVALID_SCOPE", "scope "+scope+" is not allowed")
+
+			return
+		}
+	}
+
+	maxExpiresIn := int64(viper.GetDuration(constant.APIKeysMaxExpiresIn) / time.Second)
+
+	expiresIn := apiKeyRequestBody.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = maxExpiresIn
+	}
+
+	if expiresIn < 0 || expiresIn > maxExpiresIn {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", fmt.Sprintf("expires_in must be between 1 and %v seconds", maxExpiresIn))
+
+		return
+	}
+
+	id, secret, err := newAPIKey()
+	if err != nil {
+		log.Printf("failed to generate api key: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	now := goLibSrv.Now()
+
+	key := apikeystore.Key{
+		ID:         id,
+		Subject:    subjectFromContext(request.Context()),
+		Name:       apiKeyRequestBody.Name,
+		Scopes:     apiKeyRequestBody.Scopes,
+		SecretHash: apikeystore.HashSecret(secret),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Duration(expiresIn) * time.Second),
+		// the key is invalidated with the tokens of the user when the password changes
+		TokenVersion: userStoreSrv.TokenVersion(subjectFromContext(request.Context())),
+	}
+
+	if err := apiKeyStoreSrv.Save(key); err != nil {
+		log.Printf("failed to save api key: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	response := toAPIKeyResponse(key)
+	response.Key = strings.Join([]string{apiKeyPrefix, id, secret}, "_")
+
+	writeResponseStatus(respWriter, http.StatusCreated, &response)
+}
+
+func handleListAPIKeys(respWriter http.ResponseWriter, request *http.Request) {
+	var apiKeyStoreSrv apikeystore.Service
+
+	if err := apikeystore.FromContextAs(
+		request.Context(),
+		&apiKeyStoreSrv); err != nil {
+		log.Printf("api key store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	keys := apiKeyStoreSrv.List(subjectFromContext(request.Context()))
+
+	response := APIKeyListResponse{Keys: make([]APIKeyResponse, 0, len(keys))}
+	for _, key := range keys {
+		response.Keys = append(response.Keys, toAPIKeyResponse(key))
+	}
+
+	writeResponse(respWriter, &response)
+}
+
+func handleRevokeAPIKey(respWriter http.ResponseWriter, request *http.Request) {
+	var apiKeyStoreSrv apikeystore.Service
+
+	if err := apikeystore.FromContextAs(
+		request.Context(),
+		&apiKeyStoreSrv); err != nil {
+		log.Printf("api key store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	id := chi.URLParam(request, "id")
+
+	if err := apiKeyStoreSrv.Revoke(subjectFromContext(request.Context()), id); err != nil {
+		log.Printf("failed to revoke api key: %q: %v", id, err)
+
+		var notFoundErr common.APIKeyNotFoundError
+		if errors.As(err, &notFoundErr) {
+			common.WriteError(respWriter, http.StatusNotFound, "NOT_FOUND", "api key not found")
+
+			return
+		}
+
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,187 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-wai-wong/internal/apikeystore"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/docstore"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_apiKeys(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		t.Fatalf("Could not create the user store: %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "alice password"); err != nil {
+		t.Fatalf("Could not create the user: %v", err)
+	}
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t)))
+	router.Use(refreshstore.Inject(refreshstore.New()))
+	router.Use(userstore.Inject(userStoreSrv))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(challengestore.Inject(challengestore.New()))
+	router.Use(apikeystore.Inject(apikeystore.New()))
+	router.Use(docstore.Inject(docstore.New()))
+
+	InstallRoutes(router)
+
+	_, login := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "alice", "password": "alice password"}`)
+
+	send := func(name, method, path string, header http.Header, body string, expectedStatusCode int, out interface{}) {
+		t.Helper()
+
+		request, err := http.NewRequestWithContext(ctx, method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		for key, values := range header {
+			request.Header[key] = values
+		}
+
+		response, err := (&http.Client{}).Do(request)
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		defer response.Body.Close()
+
+		if response.StatusCode != expectedStatusCode {
+			t.Fatalf("%v: Response status code: %v does not match expected status code: %v", name, response.StatusCode, expectedStatusCode)
+		}
+
+		if out != nil {
+			if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+		}
+	}
+
+	bearer := http.Header{"Authorization": {"Bearer " + login.Token}}
+
+	clientToken, err := newTokenHelper(t).GenToken(golib.WithGoLib(ctx, golib.New()), "reports", tokenhelper.WithScope("documents:read"))
+	if err != nil {
+		t.Fatalf("Could not generate the token: %v", err)
+	}
+
+	send("apiKeys-createByClient", "POST", "/sumapi/v1/apikeys", http.Header{"Authorization": {"Bearer " + clientToken}}, `{"name": "ci", "scopes": ["documents:read"]}`, http.StatusForbidden, nil)
+	send("apiKeys-createAdmin", "POST", "/sumapi/v1/apikeys", bearer, `{"name": "ci", "scopes": ["admin"]}`, http.StatusBadRequest, nil)
+	send("apiKeys-createTooLong", "POST", "/sumapi/v1/apikeys", bearer, `{"name": "ci", "scopes": ["documents:read"], "expires_in": 99999999999}`, http.StatusBadRequest, nil)
+
+	var created APIKeyResponse
+
+	send("apiKeys-create", "POST", "/sumapi/v1/apikeys", bearer, `{"name": "ci", "scopes": ["documents:read"], "expires_in": 3600}`, http.StatusCreated, &created)
+
+	if !strings.HasPrefix(created.Key, apiKeyPrefix+"_"+created.ID+"_") || created.ExpiresAt-created.CreatedAt != 3600 {
+		t.Fatalf("created api key: %+v, want a key with its id that expires in an hour", created)
+	}
+
+	// the same id with another secret
+	wrongKey := created.Key[:len(created.Key)-1] + "0"
+	if wrongKey == created.Key {
+		wrongKey = created.Key[:len(created.Key)-1] + "1"
+	}
+
+	tests := []struct {
+		name               string
+		method             string
+		path               string
+		header             http.Header
+		expectedStatusCode int
+	}{
+		{
+			name:               "apiKeys-header",
+			method:             "GET",
+			path:               "/sumapi/v1/documents/missing",
+			header:             http.Header{apiKeyHeader: {created.Key}},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "apiKeys-authorizationScheme",
+			method:             "GET",
+			path:               "/sumapi/v1/documents/missing",
+			header:             http.Header{"Authorization": {"ApiKey " + created.Key}},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "apiKeys-scopeNotOfKey",
+			method:             "DELETE",
+			path:               "/sumapi/v1/documents/missing",
+			header:             http.Header{apiKeyHeader: {created.Key}},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "apiKeys-cannotManageKeys",
+			method:             "GET",
+			path:               "/sumapi/v1/apikeys",
+			header:             http.Header{apiKeyHeader: {created.Key}},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "apiKeys-wrongSecret",
+			method:             "GET",
+			path:               "/sumapi/v1/documents/missing",
+			header:             http.Header{apiKeyHeader: {wrongKey}},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "apiKeys-malformed",
+			method:             "GET",
+			path:               "/sumapi/v1/documents/missing",
+			header:             http.Header{apiKeyHeader: {"not a key"}},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		send(tt.name, tt.method, tt.path, tt.header, "", tt.expectedStatusCode, nil)
+	}
+
+	var listed APIKeyListResponse
+
+	send("apiKeys-list", "GET", "/sumapi/v1/apikeys", bearer, "", http.StatusOK, &listed)
+
+	if len(listed.Keys) != 1 || listed.Keys[0].ID != created.ID || listed.Keys[0].Key != "" || listed.Keys[0].LastUsedAt == 0 {
+		t.Fatalf("listed api keys: %+v, want the created key without its secret and with its last use", listed)
+	}
+
+	send("apiKeys-revoke", "DELETE", "/sumapi/v1/apikeys/"+created.ID, bearer, "", http.StatusNoContent, nil)
+	send("apiKeys-revokeAgain", "DELETE", "/sumapi/v1/apikeys/"+created.ID, bearer, "", http.StatusNotFound, nil)
+	send("apiKeys-revoked", "GET", "/sumapi/v1/documents/missing", http.Header{apiKeyHeader: {created.Key}}, "", http.StatusUnauthorized, nil)
+
+	send("apiKeys-createBeforePasswordChange", "POST", "/sumapi/v1/apikeys", bearer, `{"name": "ci", "scopes": ["documents:read"]}`, http.StatusCreated, &created)
+
+	if err := userStoreSrv.SetPassword("alice", "new alice password"); err != nil {
+		t.Fatalf("Could not set the password: %v", err)
+	}
+
+	send("apiKeys-passwordChanged", "GET", "/sumapi/v1/documents/missing", http.Header{apiKeyHeader: {created.Key}}, "", http.StatusUnauthorized, nil)
+}
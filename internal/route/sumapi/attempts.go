@@ -0,0 +1,95 @@
+package sumapi
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/constant"
+
+	"github.com/spf13/viper"
+)
+
+// clientIP is the address failures count against besides the username. X-Forwarded-For is not
+// trusted since any client can set it.
+func clientIP(request *http.Request) string {
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+
+	return ip
+}
+
+func attemptKeys(request *http.Request, username string) (string, string) {
+	return "user:" + username, "ip:" + clientIP(request)
+}
+
+// loginWait returns how long the login has to wait before it may be verified, the longer of the
+// waits of the username and the client IP.
+func loginWait(attemptStoreSrv attemptstore.Service, request *http.Request, username string) time.Duration {
+	userKey, ipKey := attemptKeys(request, username)
+
+	wait := attemptStoreSrv.Wait(userKey)
+	if ipWait := attemptStoreSrv.Wait(ipKey); ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait
+}
+
+// countFailedLogin records a wrong password or second factor code against the username and the
+// client IP and audits the ones that got locked out from now on. Other errors, such as a disabled
+// account, are not guesses and do not count.
+func countFailedLogin(attemptStoreSrv attemptstore.Service, now time.Time, request *http.Request, username string, err error) {
+	var (
+		invalidCredentialsErr common.InvalidCredentialsError
+		invalidMFACodeErr     common.InvalidMFACodeError
+	)
+
+	if !errors.As(err, &invalidCredentialsErr) && !errors.As(err, &invalidMFACodeErr) {
+		return
+	}
+
+	userKey, ipKey := attemptKeys(request, username)
+
+	if wait, locked := attemptStoreSrv.Fail(userKey, viper.GetInt(constant.AuthMaxFailures)); locked {
+		logAudit(AuditEvent{
+			Event:       auditEventAccountLocked,
+			Username:    username,
+			LockedUntil: now.Add(wait).UTC().Format(time.RFC3339),
+		})
+	}
+
+	if wait, locked := attemptStoreSrv.Fail(ipKey, viper.GetInt(constant.AuthMaxIPFailures)); locked {
+		logAudit(AuditEvent{
+			Event:       auditEventIPLocked,
+			IP:          clientIP(request),
+			LockedUntil: now.Add(wait).UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// loginSucceeded forgets the failures of the username, the client IP keeps its failures so one
+// valid account cannot be used to reset the count while guessing others.
+func loginSucceeded(attemptStoreSrv attemptstore.Service, request *http.Request, username string) {
+	userKey, _ := attemptKeys(request, username)
+
+	attemptStoreSrv.Reset(userKey)
+}
+
+// setRetryAfter sets Retry-After in whole seconds, rounded up so the client never retries early.
+func setRetryAfter(respWriter http.ResponseWriter, wait time.Duration) {
+	seconds := (wait + time.Second - 1) / time.Second
+
+	respWriter.Header().Set("Retry-After", strconv.FormatInt(int64(seconds), 10))
+}
+
+func writeTooManyAttempts(respWriter http.ResponseWriter, wait time.Duration) {
+	setRetryAfter(respWriter, wait)
+	common.WriteError(respWriter, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS", "too many failed attempts, retry later")
+}
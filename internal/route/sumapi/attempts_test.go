@@ -0,0 +1,125 @@
+package sumapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_handleAuthAttempts(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	newServer := func(attemptStoreSrv attemptstore.Service) *httptest.Server {
+		router := chi.NewRouter()
+		server := httptest.NewServer(router)
+
+		t.Cleanup(func() { server.Close() })
+
+		router.Use(golib.Inject(golib.New()))
+		router.Use(tokenhelper.Inject(newTokenHelper(t)))
+		router.Use(refreshstore.Inject(refreshstore.New()))
+		router.Use(userstore.Inject(testUserStore(t)))
+		router.Use(attemptstore.Inject(attemptStoreSrv))
+		router.Use(challengestore.Inject(challengestore.New()))
+
+		InstallRoutes(router)
+
+		return server
+	}
+
+	// a client IP that is still locked out
+	lockedIP := &attemptstore.AttemptStoreClientImplMock{
+		WaitFn: func(key string) time.Duration {
+			if strings.HasPrefix(key, "ip:") {
+				return 90*time.Second - time.Millisecond
+			}
+
+			return 0
+		},
+	}
+
+	server := newServer(attemptstore.New())
+	lockedIPServer := newServer(lockedIP)
+
+	tests := []struct {
+		name               string
+		serverURL          string
+		body               string
+		expectedStatusCode int
+		expectedRetryAfter string
+	}{
+		{
+			name:               "attempts-firstFailure",
+			serverURL:          server.URL,
+			body:               `{"username": "mallory", "password": "guess"}`,
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "attempts-secondFailureStartsBackoff",
+			serverURL:          server.URL,
+			body:               `{"username": "mallory", "password": "guess"}`,
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "attempts-rightPasswordDuringBackoff",
+			serverURL:          server.URL,
+			body:               `{"username": "mallory", "password": "test"}`,
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedRetryAfter: "1",
+		},
+		{
+			name:               "attempts-otherUserSameIP",
+			serverURL:          server.URL,
+			body:               `{"username": "alice", "password": "test"}`,
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedRetryAfter: "1",
+		},
+		{
+			name:               "attempts-lockedIP",
+			serverURL:          lockedIPServer.URL,
+			body:               `{"username": "alice", "password": "test"}`,
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedRetryAfter: "90",
+		},
+	}
+
+	// the attempts build on each other so they run in order
+	for _, tt := range tests {
+		request, err := http.NewRequestWithContext(ctx, "POST", tt.serverURL+"/sumapi/v1/auth", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		response, err := (&http.Client{}).Do(request)
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != tt.expectedStatusCode {
+			t.Fatalf("%v: Response status code: %v does not match expected status code: %v", tt.name, response.StatusCode, tt.expectedStatusCode)
+		}
+
+		if retryAfter := response.Header.Get("Retry-After"); retryAfter != tt.expectedRetryAfter {
+			t.Fatalf("%v: Retry-After: %q, want: %q", tt.name, retryAfter, tt.expectedRetryAfter)
+		}
+	}
+}
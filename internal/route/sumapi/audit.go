@@ -0,0 +1,31 @@
+package sumapi
+
+import (
+	"encoding/json"
+	"log"
+)
+
+const (
+	auditEventAccountLocked = "account_locked"
+	auditEventIPLocked      = "ip_locked"
+)
+
+// AuditEvent is a security relevant event, logged as one JSON line with the audit: prefix so it
+// can be shipped apart from the rest of the log.
+type AuditEvent struct {
+	Event       string `json:"event"`
+	Username    string `json:"username,omitempty"`
+	IP          string `json:"ip,omitempty"`
+	LockedUntil string `json:"locked_until,omitempty"`
+}
+
+func logAudit(event AuditEvent) {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("failed to marshal audit event: %v", err)
+
+		return
+	}
+
+	log.Printf("audit: %s", eventBytes)
+}
@@ -0,0 +1,567 @@
+package sumapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/codestore"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	codeChallengeMethodS256    = "S256"
+	scopeOpenID                = "openid"
+
+	// RFC 7636 code verifiers are 43 to 128 characters long
+	minCodeVerifierLength = 43
+	maxCodeVerifierLength = 128
+)
+
+// loginPage is the login form of the authorization endpoint, the authorization request is carried
+// along in hidden fields.
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in to {{.Request.ClientID}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<label>Username <input name="username" autocomplete="username" required></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<label>One-time code <input name="code" inputmode="numeric" autocomplete="one-time-code"></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// authorizeRequest is an RFC 6749 authorization request with the RFC 7636 code challenge.
+type authorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func authorizeRequestFrom(values url.Values) authorizeRequest {
+	return authorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		Nonce:               values.Get("nonce"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// validateAuthorizeRequest checks the client and redirect URI first, those errors are shown to the
+// user as the redirect URI cannot be trusted, later errors are sent back to the client through the
+// redirect URI. It writes the error response and returns false on failure, otherwise the client.
+func validateAuthorizeRequest(respWriter http.ResponseWriter, request *http.Request, clientStoreSrv clientstore.Service, authRequest authorizeRequest) (clientstore.Client, bool) {
+	client, err := clientStoreSrv.Get(authRequest.ClientID)
+	if err != nil {
+		log.Printf("authorization request from unknown client: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_CLIENT", "unknown client_id")
+
+		return clientstore.Client{}, false
+	}
+
+	if !client.AllowsRedirectURI(authRequest.RedirectURI) {
+		log.Printf("client: %q sent unregistered redirect uri: %q", client.ID, authRequest.RedirectURI)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_REQUEST", "redirect_uri is not registered")
+
+		return clientstore.Client{}, false
+	}
+
+	scope, scopeNotAllowed := unallowedScope(client, strings.Fields(authRequest.Scope))
+
+	switch {
+	case authRequest.ResponseType != "code":
+		redirectError(respWriter, request, authRequest, "unsupported_response_type", "only the code response type is supported")
+	case !client.AllowsGrant(grantTypeAuthorizationCode):
+		redirectError(respWriter, request, authRequest, "unauthorized_client", "client may not use the authorization code grant")
+	case authRequest.CodeChallenge == "" || authRequest.CodeChallengeMethod != codeChallengeMethodS256:
+		redirectError(respWriter, request, authRequest, "invalid_request", "a S256 code_challenge is required")
+	case scopeNotAllowed:
+		redirectError(respWriter, request, authRequest, "invalid_scope", "scope "+scope+" is not allowed")
+	default:
+		return client, true
+	}
+
+	return clientstore.Client{}, false
+}
+
+// redirect sends the user agent back to the redirect URI of the client with params and the state.
+func redirect(respWriter http.ResponseWriter, request *http.Request, authRequest authorizeRequest, params url.Values) {
+	if authRequest.State != "" {
+		params.Set("state", authRequest.State)
+	}
+
+	redirectURI, err := url.Parse(authRequest.RedirectURI)
+	if err != nil {
+		log.Printf("failed to parse redirect uri: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_REQUEST", "redirect_uri is invalid")
+
+		return
+	}
+
+	query := redirectURI.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(respWriter, request, redirectURI.String(), http.StatusFound)
+}
+
+func redirectError(respWriter http.ResponseWriter, request *http.Request, authRequest authorizeRequest, code, desc string) {
+	log.Printf("authorization request of client: %q failed: %v", authRequest.ClientID, desc)
+	redirect(respWriter, request, authRequest, url.Values{"error": {code}, "error_description": {desc}})
+}
+
+func writeLoginPage(respWriter http.ResponseWriter, request *http.Request, authRequest authorizeRequest, status int, loginErr string) {
+	respWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	respWriter.Header().Set("Cache-Control", "no-store")
+	respWriter.Header().Set("X-Frame-Options", "DENY")
+	respWriter.WriteHeader(status)
+
+	if err := loginPage.Execute(respWriter, struct {
+		Action  string
+		Request authorizeRequest
+		Error   string
+	}{
+		Action:  request.URL.Path,
+		Request: authRequest,
+		Error:   loginErr,
+	}); err != nil {
+		log.Printf("failed to render login page: %v", err)
+	}
+}
+
+// handleAuthorize is the authorization endpoint, it shows the login page for a valid authorization
+// request.
+func handleAuthorize(respWriter http.ResponseWriter, request *http.Request) {
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		request.Context(),
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	authRequest := authorizeRequestFrom(request.URL.Query())
+
+	if _, ok := validateAuthorizeRequest(respWriter, request, clientStoreSrv, authRequest); !ok {
+		return
+	}
+
+	writeLoginPage(respWriter, request, authRequest, http.StatusOK, "")
+}
+
+// handleAuthorizeLogin verifies the login form and redirects back to the client with a short lived,
+// single use authorization code.
+func handleAuthorizeLogin(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		ctx,
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var codeStoreSrv codestore.Service
+
+	if err := codestore.FromContextAs(
+		ctx,
+		&codeStoreSrv); err != nil {
+		log.Printf("code store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var attemptStoreSrv attemptstore.Service
+
+	if err := attemptstore.FromContextAs(
+		ctx,
+		&attemptStoreSrv); err != nil {
+		log.Printf("attempt store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		log.Printf("failed to parse form: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	authRequest := authorizeRequestFrom(request.PostForm)
+
+	client, ok := validateAuthorizeRequest(respWriter, request, clientStoreSrv, authRequest)
+	if !ok {
+		return
+	}
+
+	username := request.PostForm.Get("username")
+
+	if wait := loginWait(attemptStoreSrv, request, username); wait > 0 {
+		log.Printf("login of: %q has to wait: %v", username, wait)
+		setRetryAfter(respWriter, wait)
+		writeLoginPage(respWriter, request, authRequest, http.StatusTooManyRequests, "Too many failed attempts, try again later.")
+
+		return
+	}
+
+	user, err := userStoreSrv.Verify(username, request.PostForm.Get("password"))
+	if err != nil {
+		log.Printf("failed to verify credentials: %v", err)
+		countFailedLogin(attemptStoreSrv, goLibSrv.Now(), request, username, err)
+		writeLoginPage(respWriter, request, authRequest, http.StatusUnauthorized, "Invalid username or password.")
+
+		return
+	}
+
+	amr, err := loginPageSecondFactor(userStoreSrv, user, request.PostForm.Get("code"))
+	if err != nil {
+		log.Printf("failed to verify second factor: %v", err)
+		countFailedLogin(attemptStoreSrv, goLibSrv.Now(), request, username, err)
+		writeLoginPage(respWriter, request, authRequest, http.StatusUnauthorized, secondFactorMessage(err))
+
+		return
+	}
+
+	loginSucceeded(attemptStoreSrv, request, username)
+
+	code, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("failed to generate authorization code: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	codeHash, err := sha256Hex(code)
+	if err != nil {
+		log.Printf("failed to hash authorization code: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	now := goLibSrv.Now()
+
+	if err := codeStoreSrv.Save(codeHash, codestore.Grant{
+		ClientID:            authRequest.ClientID,
+		RedirectURI:         authRequest.RedirectURI,
+		Subject:             user.Username,
+		Scope:               clientScopes(client, grantedScopes(user, strings.Fields(authRequest.Scope), amr)),
+		Nonce:               authRequest.Nonce,
+		CodeChallenge:       authRequest.CodeChallenge,
+		CodeChallengeMethod: authRequest.CodeChallengeMethod,
+		AuthTime:            now,
+		AMR:                 amr,
+		ExpiresAt:           now.Add(viper.GetDuration(constant.OAuthCodeExpiresIn)),
+	}); err != nil {
+		log.Printf("failed to save authorization code: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	redirect(respWriter, request, authRequest, url.Values{"code": {code}})
+}
+
+// unallowedScope returns the first of scopes that client may not request, openid is allowed for
+// every client.
+func unallowedScope(client clientstore.Client, scopes []string) (string, bool) {
+	for _, scope := range scopes {
+		if scope != scopeOpenID && !client.AllowsScope(scope) {
+			return scope, true
+		}
+	}
+
+	return "", false
+}
+
+// clientScopes returns the scopes client is allowed, plus openid.
+func clientScopes(client clientstore.Client, scopes []string) []string {
+	allowed := []string{}
+
+	for _, scope := range scopes {
+		if scope == scopeOpenID || client.AllowsScope(scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+
+	return allowed
+}
+
+// grantedScopes returns the requested scopes the user has, plus openid when requested. Without
+// requested scopes the user gets all of its scopes. The scopes that need a second factor are only
+// granted when amr has one.
+func grantedScopes(user userstore.User, requested, amr []string) []string {
+	userScopes := scopesForAMR(scopesOf(rolesOf(user)), amr)
+	if len(requested) == 0 {
+		return userScopes
+	}
+
+	granted := []string{}
+
+	for _, scope := range requested {
+		if scope == scopeOpenID {
+			granted = append(granted, scope)
+
+			continue
+		}
+
+		for _, userScope := range userScopes {
+			if scope == userScope {
+				granted = append(granted, scope)
+
+				break
+			}
+		}
+	}
+
+	return granted
+}
+
+// verifyCodeVerifier checks an RFC 7636 S256 code verifier against the code challenge.
+func verifyCodeVerifier(codeVerifier, codeChallenge string) bool {
+	if len(codeVerifier) < minCodeVerifierLength || len(codeVerifier) > maxCodeVerifierLength {
+		return false
+	}
+
+	verifierHash := sha256.Sum256([]byte(codeVerifier))
+	computed := base64.RawURLEncoding.EncodeToString(verifierHash[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(codeChallenge)) == 1
+}
+
+// identifyClient authenticates confidential clients like authenticateClient, public clients only
+// send their client_id. Writes a 401 and returns false when the client is unknown or invalid.
+func identifyClient(respWriter http.ResponseWriter, request *http.Request, clientStoreSrv clientstore.Service) (clientstore.Client, bool) {
+	if _, _, ok := request.BasicAuth(); ok || request.PostForm.Get("client_secret") != "" {
+		return authenticateClient(respWriter, request, clientStoreSrv)
+	}
+
+	client, err := clientStoreSrv.Get(request.PostForm.Get("client_id"))
+	if err == nil && client.Public {
+		return client, true
+	}
+
+	log.Printf("failed to identify public client: %v", err)
+	respWriter.Header().Add("WWW-Authenticate", `Basic realm="sumapi"`)
+	common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_CLIENT", "client authentication failed")
+
+	return clientstore.Client{}, false
+}
+
+// handleAuthorizationCode redeems an authorization code for an access token, plus an ID token when
+// the openid scope was granted.
+func handleAuthorizationCode(respWriter http.ResponseWriter, request *http.Request, tokenHelperSrv tokenhelper.Service, clientStoreSrv clientstore.Service) {
+	ctx := request.Context()
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var codeStoreSrv codestore.Service
+
+	if err := codestore.FromContextAs(
+		ctx,
+		&codeStoreSrv); err != nil {
+		log.Printf("code store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	client, ok := identifyClient(respWriter, request, clientStoreSrv)
+	if !ok {
+		return
+	}
+
+	codeHash, err := sha256Hex(request.PostForm.Get("code"))
+	if err != nil {
+		log.Printf("failed to hash authorization code: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	grant, err := codeStoreSrv.Redeem(codeHash)
+	if err != nil {
+		writeGrantError(respWriter, err)
+
+		return
+	}
+
+	switch {
+	case grant.ClientID != client.ID:
+		writeGrantError(respWriter, common.InvalidGrantError("authorization code was issued to another client"))
+
+		return
+	case grant.RedirectURI != request.PostForm.Get("redirect_uri"):
+		writeGrantError(respWriter, common.InvalidGrantError("redirect_uri does not match the authorization request"))
+
+		return
+	case !verifyCodeVerifier(request.PostForm.Get("code_verifier"), grant.CodeChallenge):
+		writeGrantError(respWriter, common.InvalidGrantError("code_verifier does not match the code challenge"))
+
+		return
+	}
+
+	user, err := userStoreSrv.Get(grant.Subject)
+	if err != nil || user.Disabled {
+		writeGrantError(respWriter, common.InvalidGrantError("user not found or disabled"))
+
+		return
+	}
+
+	response, err := userTokenResponse(
+		ctx,
+		tokenHelperSrv,
+		user,
+		client.ID,
+		grant.Scope,
+		grant.AMR,
+		tokenhelper.WithNonce(grant.Nonce),
+		tokenhelper.WithAuthTime(grant.AuthTime),
+	)
+	if err != nil {
+		log.Printf("failed to generate tokens: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, response)
+}
+
+// userTokenResponse issues an access token of user for a client, plus an ID token when the openid
+// scope was granted. Both carry amr, the methods of the login, and idTokenOpts add the other claims
+// of the login to the ID token.
+func userTokenResponse(
+	ctx context.Context,
+	tokenHelperSrv tokenhelper.Service,
+	user userstore.User,
+	clientID string,
+	scope []string,
+	amr []string,
+	idTokenOpts ...tokenhelper.Option,
+) (*TokenResponse, error) {
+	accessToken, err := tokenHelperSrv.GenToken(
+		ctx,
+		user.Username,
+		append([]tokenhelper.Option{
+			tokenhelper.WithRoles(rolesOf(user)...),
+			tokenhelper.WithScope(scope...),
+			tokenhelper.WithAuthorizedParty(clientID),
+			tokenhelper.WithAMR(amr...),
+		}, certificateBinding(ctx)...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   uint32(viper.GetDuration(constant.TokenExpiresIn) / time.Second),
+		Scope:       strings.Join(scope, " "),
+	}
+
+	for _, granted := range scope {
+		if granted != scopeOpenID {
+			continue
+		}
+
+		// the ID token is for the client, its audience keeps it from being used as an access token.
+		// The client reads it without our encryption key, so it is only signed.
+		opts := append([]tokenhelper.Option{
+			tokenhelper.WithAudience(clientID),
+			tokenhelper.WithAuthorizedParty(clientID),
+			tokenhelper.WithAMR(amr...),
+			tokenhelper.WithoutEncryption(),
+		}, idTokenOpts...)
+
+		if response.IDToken, err = tokenHelperSrv.GenToken(ctx, user.Username, opts...); err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
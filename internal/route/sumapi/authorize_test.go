@@ -0,0 +1,368 @@
+package sumapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/codestore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	testRedirectURI  = "http://localhost:3000/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// newAuthorizeServer also creates bob, a user with a second factor, and returns the TOTP secret of bob.
+func newAuthorizeServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	dashboard := clientstore.Client{
+		ID:           "dashboard",
+		Public:       true,
+		GrantTypes:   []string{grantTypeAuthorizationCode},
+		Scopes:       []string{"sum:write", "documents:read"},
+		RedirectURIs: []string{testRedirectURI},
+	}
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		t.Fatalf("Could not create the user store: %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "alice password"); err != nil {
+		t.Fatalf("Could not create the user: %v", err)
+	}
+
+	bobSecret := createTOTPUser(t, userStoreSrv, "bob", "bob password")
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t)))
+	router.Use(userstore.Inject(userStoreSrv))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(codestore.Inject(codestore.New()))
+	router.Use(clientstore.Inject(&clientstore.ClientStoreClientImplMock{
+		GetFn: func(id string) (clientstore.Client, error) {
+			if id != dashboard.ID {
+				return clientstore.Client{}, common.InvalidClientError(id)
+			}
+
+			return dashboard, nil
+		},
+	}))
+
+	InstallRoutes(router)
+
+	return server, bobSecret
+}
+
+// noRedirectClient returns redirects instead of following them.
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func authorizeParams(redirectURI, codeChallenge string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"dashboard"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid sum:write"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func testCodeChallenge() string {
+	verifierHash := sha256.Sum256([]byte(testCodeVerifier))
+
+	return base64.RawURLEncoding.EncodeToString(verifierHash[:])
+}
+
+func Test_handleAuthorize(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	server, _ := newAuthorizeServer(t)
+
+	notAllowedScope := authorizeParams(testRedirectURI, testCodeChallenge())
+	notAllowedScope.Set("scope", "openid admin")
+
+	tests := []struct {
+		name               string
+		params             url.Values
+		expectedStatusCode int
+		expectedError      string
+	}{
+		{
+			name:               "handleAuthorize-loginPage",
+			params:             authorizeParams(testRedirectURI, testCodeChallenge()),
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "handleAuthorize-unregisteredRedirectURI",
+			params:             authorizeParams("http://evil.example/callback", testCodeChallenge()),
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "handleAuthorize-missingCodeChallenge",
+			params:             authorizeParams(testRedirectURI, ""),
+			expectedStatusCode: 302,
+			expectedError:      "invalid_request",
+		},
+		{
+			name:               "handleAuthorize-scopeNotAllowed",
+			params:             notAllowedScope,
+			expectedStatusCode: 302,
+			expectedError:      "invalid_scope",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/sumapi/v1/oauth/authorize?"+tt.params.Encode(), http.NoBody)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := noRedirectClient.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			if tt.expectedError == "" {
+				return
+			}
+
+			location, err := url.Parse(response.Header.Get("Location"))
+			if err != nil {
+				t.Fatalf("Could not parse the redirect: %v", err)
+			}
+
+			if location.Query().Get("error") != tt.expectedError || location.Query().Get("state") != "xyz" {
+				t.Fatalf("Redirect: %v, want error: %v with the state", location, tt.expectedError)
+			}
+		})
+	}
+}
+
+func Test_authorizationCodeFlow(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	server, bobSecret := newAuthorizeServer(t)
+
+	postForm := func(path string, form url.Values) *http.Response {
+		t.Helper()
+
+		request, err := http.NewRequestWithContext(ctx, "POST", server.URL+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		response, err := noRedirectClient.Do(request)
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		t.Cleanup(func() { response.Body.Close() })
+
+		return response
+	}
+
+	login := authorizeParams(testRedirectURI, testCodeChallenge())
+	login.Set("username", "alice")
+	login.Set("password", "wrong password")
+
+	if response := postForm("/sumapi/v1/oauth/authorize", login); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	login.Set("password", "alice password")
+
+	response := postForm("/sumapi/v1/oauth/authorize", login)
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil || location.Query().Get("code") == "" || location.Query().Get("state") != "xyz" {
+		t.Fatalf("Redirect: %v, %v, want a code and the state", location, err)
+	}
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"dashboard"},
+		"redirect_uri":  {testRedirectURI},
+		"code":          {location.Query().Get("code")},
+		"code_verifier": {strings.Repeat("x", 43)},
+	}
+
+	// a wrong verifier burns the code as well
+	if response := postForm("/sumapi/v1/oauth/token", exchange); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	response = postForm("/sumapi/v1/oauth/authorize", login)
+	location, _ = url.Parse(response.Header.Get("Location"))
+
+	exchange.Set("code", location.Query().Get("code"))
+	exchange.Set("code_verifier", testCodeVerifier)
+
+	response = postForm("/sumapi/v1/oauth/token", exchange)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusOK)
+	}
+
+	var tokenResponse TokenResponse
+
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		t.Fatalf("Could not decode the response: %v", err)
+	}
+
+	if tokenResponse.Scope != "openid sum:write" || tokenResponse.AccessToken == "" {
+		t.Fatalf("token response scope: %q, want openid sum:write and an access token", tokenResponse.Scope)
+	}
+
+	idClaims := &tokenhelper.Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenResponse.IDToken, idClaims); err != nil {
+		t.Fatalf("Could not parse the id token: %v", err)
+	}
+
+	if idClaims.Subject != "alice" || idClaims.Audience != "dashboard" || idClaims.Nonce != "n-0S6_WzA2Mj" || idClaims.AuthTime == 0 {
+		t.Fatalf("id token claims: %+v, want alice, the dashboard audience, the nonce and auth_time", idClaims)
+	}
+
+	// codes are single use
+	if response := postForm("/sumapi/v1/oauth/token", exchange); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	// without a requested scope the token gets the scopes of alice the client is allowed
+	login.Del("scope")
+
+	response = postForm("/sumapi/v1/oauth/authorize", login)
+	location, _ = url.Parse(response.Header.Get("Location"))
+	exchange.Set("code", location.Query().Get("code"))
+
+	response = postForm("/sumapi/v1/oauth/token", exchange)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusOK)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		t.Fatalf("Could not decode the response: %v", err)
+	}
+
+	if tokenResponse.Scope != "documents:read sum:write" {
+		t.Fatalf("token response scope: %q, want documents:read sum:write", tokenResponse.Scope)
+	}
+
+	// bob has a second factor so the password alone does not get a code
+	bobLogin := authorizeParams(testRedirectURI, testCodeChallenge())
+	bobLogin.Set("username", "bob")
+	bobLogin.Set("password", "bob password")
+
+	if response := postForm("/sumapi/v1/oauth/authorize", bobLogin); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	bobLogin.Set("code", totpCodeAt(t, bobSecret, time.Now().Add(30*time.Second)))
+
+	response = postForm("/sumapi/v1/oauth/authorize", bobLogin)
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusFound)
+	}
+
+	location, _ = url.Parse(response.Header.Get("Location"))
+	exchange.Set("code", location.Query().Get("code"))
+
+	response = postForm("/sumapi/v1/oauth/token", exchange)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusOK)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		t.Fatalf("Could not decode the response: %v", err)
+	}
+
+	accessClaims := &tokenhelper.Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenResponse.AccessToken, accessClaims); err != nil {
+		t.Fatalf("Could not parse the access token: %v", err)
+	}
+
+	if accessClaims.Subject != "bob" || !accessClaims.HasAMR(amrOTP) {
+		t.Fatalf("access token claims: %+v, want bob with the otp amr", accessClaims)
+	}
+}
+
+func Test_verifyCodeVerifier(t *testing.T) {
+	t.Parallel()
+
+	// the example of RFC 7636 appendix B
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{name: "verifyCodeVerifier-rfcExample", verifier: testCodeVerifier, want: true},
+		{name: "verifyCodeVerifier-wrongVerifier", verifier: strings.Repeat("x", 43), want: false},
+		{name: "verifyCodeVerifier-tooShort", verifier: "short", want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := verifyCodeVerifier(tt.verifier, challenge); got != tt.want {
+				t.Fatalf("verifyCodeVerifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package sumapi
+
+import (
+	"context"
+	"crypto/x509"
+	"log"
+	"net/http"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/spf13/viper"
+)
+
+// CertificateUser maps the subject of a client certificate, such as CN=alice,O=Acme, to a user.
+type CertificateUser struct {
+	Subject  string `mapstructure:"subject"`
+	Username string `mapstructure:"username"`
+}
+
+// recordClientCertificate records the verified client certificate of the connection so tokens
+// can be bound to it and bound tokens are checked against it. Certificates the server did not
+// verify against tls.clientcafile are ignored.
+func recordClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, request *http.Request) {
+		var cert *x509.Certificate
+
+		if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 && len(request.TLS.VerifiedChains[0]) > 0 {
+			cert = request.TLS.VerifiedChains[0][0]
+		}
+
+		next.ServeHTTP(respWriter, request.WithContext(tokenhelper.WithClientCertificate(request.Context(), cert)))
+	})
+}
+
+// certificateBinding binds the access tokens issued over a connection with a client certificate
+// to it, as RFC 8705 certificate-bound access tokens.
+func certificateBinding(ctx context.Context) []tokenhelper.Option {
+	cert := tokenhelper.ClientCertificateFromContext(ctx)
+	if cert == nil {
+		return nil
+	}
+
+	return []tokenhelper.Option{tokenhelper.WithCertificateBinding(cert)}
+}
+
+// certificateThumbprint is the x5t#S256 of the client certificate of the connection, empty without
+// one.
+func certificateThumbprint(ctx context.Context) string {
+	cert := tokenhelper.ClientCertificateFromContext(ctx)
+	if cert == nil {
+		return ""
+	}
+
+	return tokenhelper.CertificateThumbprint(cert)
+}
+
+// certificateUsername returns the user the subject of cert is mapped to in tls.certificateusers.
+func certificateUsername(cert *x509.Certificate) (string, bool) {
+	var users []CertificateUser
+
+	if err := viper.UnmarshalKey(constant.TLSCertificateUsers, &users); err != nil {
+		log.Printf("failed to read certificate users: %v", err)
+
+		return "", false
+	}
+
+	subject := cert.Subject.String()
+
+	for _, user := range users {
+		if user.Subject == subject && user.Username != "" {
+			return user.Username, true
+		}
+	}
+
+	return "", false
+}
+
+// handleCertificateAuth logs in the user the client certificate of the connection is mapped to,
+// without a password. The tokens are bound to the certificate and, as the certificate is a single
+// factor, never get the scopes that need a second factor.
+func handleCertificateAuth(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		ctx,
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var refreshStoreSrv refreshstore.Service
+
+	if err := refreshstore.FromContextAs(
+		ctx,
+		&refreshStoreSrv); err != nil {
+		log.Printf("refresh store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	cert := tokenhelper.ClientCertificateFromContext(ctx)
+	if cert == nil {
+		common.WriteError(respWriter, http.StatusUnauthorized, "CERTIFICATE_REQUIRED", "a verified client certificate is required")
+
+		return
+	}
+
+	username, ok := certificateUsername(cert)
+	if !ok {
+		log.Printf("client certificate: %q is not mapped to a user", cert.Subject.String())
+		common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_CERTIFICATE", "client certificate is not mapped to a user")
+
+		return
+	}
+
+	user, err := userStoreSrv.Get(username)
+	if err != nil {
+		log.Printf("failed to get user of client certificate: %v", err)
+		common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_CERTIFICATE", "client certificate is not mapped to a user")
+
+		return
+	}
+
+	if user.Disabled {
+		writeCredentialsError(respWriter, common.AccountDisabledError(user.Username))
+
+		return
+	}
+
+	writeAuthResponse(respWriter, request, tokenHelperSrv, refreshStoreSrv, user, []string{amrCertificate})
+}
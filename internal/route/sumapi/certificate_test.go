@@ -0,0 +1,250 @@
+package sumapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-wai-wong/internal/apikeystore"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+)
+
+// testCA issues client certificates for the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate the key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sumapi test ca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create the certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse the certificate: %v", err)
+	}
+
+	return testCA{cert: cert, key: key}
+}
+
+// clientCertificate issues a client certificate for subject, every call has a new key.
+func (ca testCA) clientCertificate(t *testing.T, subject pkix.Name, serial int64) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate the key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Could not create the certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse the certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// Test_certificateFlow does not run in parallel as it sets the certificate users in the global
+// config.
+func Test_certificateFlow(t *testing.T) {
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	aliceSubject := pkix.Name{CommonName: "alice", Organization: []string{"Acme"}}
+
+	viper.Set(constant.TLSCertificateUsers, []map[string]interface{}{
+		{"subject": aliceSubject.String(), "username": "alice"},
+	})
+
+	ca := newTestCA(t)
+	aliceCert := ca.clientCertificate(t, aliceSubject, 2)
+	otherAliceCert := ca.clientCertificate(t, aliceSubject, 3)
+	malloryCert := ca.clientCertificate(t, pkix.Name{CommonName: "mallory"}, 4)
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		t.Fatalf("Could not create the user store: %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "alice password"); err != nil {
+		t.Fatalf("Could not create the user: %v", err)
+	}
+
+	router := chi.NewRouter()
+	server := httptest.NewUnstartedServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t)))
+	router.Use(refreshstore.Inject(refreshstore.New()))
+	router.Use(userstore.Inject(userStoreSrv))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(challengestore.Inject(challengestore.New()))
+	router.Use(apikeystore.Inject(apikeystore.New()))
+
+	InstallRoutes(router)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	server.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+
+	// clientWith connects with the client certificates in certs, each client has its own connections
+	clientWith := func(certs ...tls.Certificate) *http.Client {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+
+		return &http.Client{Transport: transport}
+	}
+
+	aliceClient := clientWith(aliceCert)
+	otherAliceClient := clientWith(otherAliceCert)
+	noCertClient := clientWith()
+
+	do := func(client *http.Client, method, path, token, body string, expectedStatusCode int, out interface{}) {
+		t.Helper()
+
+		request, err := http.NewRequestWithContext(ctx, method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		defer response.Body.Close()
+
+		if response.StatusCode != expectedStatusCode {
+			responseBytes, _ := io.ReadAll(response.Body)
+			t.Fatalf("Response status code: %v does not match expected status code: %v, body: %s", response.StatusCode, expectedStatusCode, responseBytes)
+		}
+
+		if out != nil {
+			if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+		}
+	}
+
+	checkBinding := func(token string, cert tls.Certificate) {
+		t.Helper()
+
+		claims := &tokenhelper.Claims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+			t.Fatalf("Could not parse the token: %v", err)
+		}
+
+		if claims.Confirmation == nil || claims.Confirmation.X5TS256 != tokenhelper.CertificateThumbprint(cert.Leaf) {
+			t.Fatalf("token cnf: %+v, want the thumbprint of the client certificate", claims.Confirmation)
+		}
+	}
+
+	var errResponse struct {
+		Code string `json:"code"`
+	}
+
+	do(noCertClient, "POST", "/sumapi/v1/auth/certificate", "", "", http.StatusUnauthorized, &errResponse)
+
+	if errResponse.Code != "CERTIFICATE_REQUIRED" {
+		t.Fatalf("error code: %q, want CERTIFICATE_REQUIRED", errResponse.Code)
+	}
+
+	do(clientWith(malloryCert), "POST", "/sumapi/v1/auth/certificate", "", "", http.StatusUnauthorized, &errResponse)
+
+	if errResponse.Code != "INVALID_CERTIFICATE" {
+		t.Fatalf("error code: %q, want INVALID_CERTIFICATE", errResponse.Code)
+	}
+
+	var certificateAuth AuthResponse
+
+	do(aliceClient, "POST", "/sumapi/v1/auth/certificate", "", "", http.StatusOK, &certificateAuth)
+	checkBinding(certificateAuth.Token, aliceCert)
+
+	// the bound token is only accepted over a connection with the same certificate
+	do(aliceClient, "GET", "/sumapi/v1/apikeys", certificateAuth.Token, "", http.StatusOK, nil)
+	do(otherAliceClient, "GET", "/sumapi/v1/apikeys", certificateAuth.Token, "", http.StatusUnauthorized, nil)
+	do(noCertClient, "GET", "/sumapi/v1/apikeys", certificateAuth.Token, "", http.StatusUnauthorized, nil)
+
+	var refreshed AuthResponse
+
+	do(aliceClient, "POST", "/sumapi/v1/auth/refresh", "", `{"refresh_token":"`+certificateAuth.RefreshToken+`"}`, http.StatusOK, &refreshed)
+	checkBinding(refreshed.Token, aliceCert)
+
+	do(otherAliceClient, "POST", "/sumapi/v1/auth/refresh", "", `{"refresh_token":"`+refreshed.RefreshToken+`"}`, http.StatusUnauthorized, nil)
+
+	// a password login over a connection with a client certificate is bound to it as well
+	var passwordAuth AuthResponse
+
+	do(otherAliceClient, "POST", "/sumapi/v1/auth", "", `{"username":"alice","password":"alice password"}`, http.StatusOK, &passwordAuth)
+	checkBinding(passwordAuth.Token, otherAliceCert)
+
+	var unboundAuth AuthResponse
+
+	do(noCertClient, "POST", "/sumapi/v1/auth", "", `{"username":"alice","password":"alice password"}`, http.StatusOK, &unboundAuth)
+	do(aliceClient, "GET", "/sumapi/v1/apikeys", unboundAuth.Token, "", http.StatusOK, nil)
+}
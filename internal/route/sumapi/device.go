@@ -0,0 +1,481 @@
+package sumapi
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/devicestore"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// user codes use consonants only so they cannot spell words and are easy to type, 8 of
+	// them give about 34 bits, plenty for a code that lives a few minutes
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// saveUserCodeAttempts bounds the retries when a new user code collides with a pending one
+	saveUserCodeAttempts = 3
+)
+
+// devicePage is the verification page where a user signs in to approve a device. There is no deny,
+// a device that is not approved is never connected and its code expires.
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+<h1>Connect a device</h1>
+{{if .Message}}<p role="alert">{{.Message}}</p>{{end}}
+{{if not .Done}}<form method="post" action="{{.Action}}">
+<label>Code <input name="user_code" value="{{.UserCode}}" autocomplete="off" required></label>
+<label>Username <input name="username" autocomplete="username" required></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<label>One-time code <input name="code" inputmode="numeric" autocomplete="one-time-code"></label>
+<button type="submit">Approve</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// DeviceAuthorizationResponse is the RFC 8628 device authorization response.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               uint32 `json:"expires_in"`
+	Interval                uint32 `json:"interval"`
+}
+
+// newUserCode returns a random user code formatted as XXXX-XXXX.
+func newUserCode() (string, error) {
+	var userCode strings.Builder
+
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			userCode.WriteByte('-')
+		}
+
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to read random index: %w", err)
+		}
+
+		userCode.WriteByte(userCodeAlphabet[index.Int64()])
+	}
+
+	return userCode.String(), nil
+}
+
+func deviceVerificationURI() string {
+	return tokenhelper.Issuer() + "/sumapi/v1/oauth/device"
+}
+
+// handleDeviceAuthorization is the RFC 8628 device authorization endpoint, it starts a device grant
+// and returns the device code the client polls with and the user code the user enters.
+func handleDeviceAuthorization(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		ctx,
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var deviceStoreSrv devicestore.Service
+
+	if err := devicestore.FromContextAs(
+		ctx,
+		&deviceStoreSrv); err != nil {
+		log.Printf("device store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		log.Printf("failed to parse form: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	respWriter.Header().Set("Cache-Control", "no-store")
+
+	client, ok := identifyClient(respWriter, request, clientStoreSrv)
+	if !ok {
+		return
+	}
+
+	if !client.AllowsGrant(grantTypeDeviceCode) {
+		log.Printf("client: %q may not use the device code grant", client.ID)
+		common.WriteError(respWriter, http.StatusBadRequest, "UNAUTHORIZED_CLIENT", "client may not use this grant_type")
+
+		return
+	}
+
+	requestedScope := strings.Fields(request.PostForm.Get("scope"))
+
+	if scope, ok := unallowedScope(client, requestedScope); ok {
+		log.Printf("client: %q requested scope: %q", client.ID, scope)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_SCOPE", "scope "+scope+" is not allowed")
+
+		return
+	}
+
+	deviceCode, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("failed to generate device code: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	deviceCodeHash, err := sha256Hex(deviceCode)
+	if err != nil {
+		log.Printf("failed to hash device code: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	expiresIn := viper.GetDuration(constant.OAuthDeviceCodeExpiresIn)
+	interval := viper.GetDuration(constant.OAuthDevicePollInterval)
+
+	var userCode string
+
+	for attempt := 0; attempt < saveUserCodeAttempts; attempt++ {
+		if userCode, err = newUserCode(); err != nil {
+			break
+		}
+
+		if err = deviceStoreSrv.Save(deviceCodeHash, devicestore.Grant{
+			ClientID:       client.ID,
+			UserCode:       userCode,
+			RequestedScope: requestedScope,
+			Interval:       interval,
+			ExpiresAt:      goLibSrv.Now().Add(expiresIn),
+		}); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		log.Printf("failed to save device grant: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	verificationURI := deviceVerificationURI()
+
+	writeResponse(respWriter, &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+		ExpiresIn:               uint32(expiresIn / time.Second),
+		Interval:                uint32(interval / time.Second),
+	})
+}
+
+func writeDevicePage(respWriter http.ResponseWriter, request *http.Request, status int, userCode, message string, done bool) {
+	respWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	respWriter.Header().Set("Cache-Control", "no-store")
+	respWriter.Header().Set("X-Frame-Options", "DENY")
+	respWriter.WriteHeader(status)
+
+	if err := devicePage.Execute(respWriter, struct {
+		Action   string
+		UserCode string
+		Message  string
+		Done     bool
+	}{
+		Action:   request.URL.Path,
+		UserCode: userCode,
+		Message:  message,
+		Done:     done,
+	}); err != nil {
+		log.Printf("failed to render device page: %v", err)
+	}
+}
+
+// handleDevice shows the verification page, prefilled with the user code of
+// verification_uri_complete.
+func handleDevice(respWriter http.ResponseWriter, request *http.Request) {
+	writeDevicePage(respWriter, request, http.StatusOK, request.URL.Query().Get("user_code"), "", false)
+}
+
+// handleDeviceLogin verifies the user and approves the device grant of the user code, an approved
+// device gets the requested scopes the user has and the client is allowed.
+func handleDeviceLogin(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		ctx,
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var deviceStoreSrv devicestore.Service
+
+	if err := devicestore.FromContextAs(
+		ctx,
+		&deviceStoreSrv); err != nil {
+		log.Printf("device store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var attemptStoreSrv attemptstore.Service
+
+	if err := attemptstore.FromContextAs(
+		ctx,
+		&attemptStoreSrv); err != nil {
+		log.Printf("attempt store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		log.Printf("failed to parse form: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	userCode := request.PostForm.Get("user_code")
+
+	username := request.PostForm.Get("username")
+
+	if wait := loginWait(attemptStoreSrv, request, username); wait > 0 {
+		log.Printf("login of: %q has to wait: %v", username, wait)
+		setRetryAfter(respWriter, wait)
+		writeDevicePage(respWriter, request, http.StatusTooManyRequests, userCode, "Too many failed attempts, try again later.", false)
+
+		return
+	}
+
+	user, err := userStoreSrv.Verify(username, request.PostForm.Get("password"))
+	if err != nil {
+		log.Printf("failed to verify credentials: %v", err)
+		countFailedLogin(attemptStoreSrv, goLibSrv.Now(), request, username, err)
+		writeDevicePage(respWriter, request, http.StatusUnauthorized, userCode, "Invalid username or password.", false)
+
+		return
+	}
+
+	amr, err := loginPageSecondFactor(userStoreSrv, user, request.PostForm.Get("code"))
+	if err != nil {
+		log.Printf("failed to verify second factor: %v", err)
+		countFailedLogin(attemptStoreSrv, goLibSrv.Now(), request, username, err)
+		writeDevicePage(respWriter, request, http.StatusUnauthorized, userCode, secondFactorMessage(err), false)
+
+		return
+	}
+
+	loginSucceeded(attemptStoreSrv, request, username)
+
+	grant, err := deviceStoreSrv.Lookup(userCode)
+	if err != nil {
+		log.Printf("failed to look up user code: %v", err)
+		writeDevicePage(respWriter, request, http.StatusBadRequest, userCode, "The code is invalid or has expired.", false)
+
+		return
+	}
+
+	client, err := clientStoreSrv.Get(grant.ClientID)
+	if err != nil {
+		log.Printf("failed to get client of device grant: %v", err)
+		writeDevicePage(respWriter, request, http.StatusBadRequest, userCode, "The code is invalid or has expired.", false)
+
+		return
+	}
+
+	scope := clientScopes(client, grantedScopes(user, grant.RequestedScope, amr))
+
+	if err := deviceStoreSrv.Approve(userCode, user.Username, scope, amr); err != nil {
+		log.Printf("failed to approve device grant: %v", err)
+		writeDevicePage(respWriter, request, http.StatusBadRequest, userCode, "The code is invalid or has expired.", false)
+
+		return
+	}
+
+	writeDevicePage(respWriter, request, http.StatusOK, "", "The device is connected, you can return to it now.", true)
+}
+
+// writeDeviceError answers a poll of a device code that cannot be redeemed yet, these are RFC 8628
+// 400 errors the client acts on rather than failures.
+func writeDeviceError(respWriter http.ResponseWriter, err error) {
+	var (
+		pendingErr   common.AuthorizationPendingError
+		slowDownErr  common.SlowDownError
+		expiredErr   common.ExpiredTokenError
+		invalidGrant common.InvalidGrantError
+	)
+
+	switch {
+	case errors.As(err, &pendingErr):
+		common.WriteError(respWriter, http.StatusBadRequest, "AUTHORIZATION_PENDING", "the user has not approved the device yet")
+	case errors.As(err, &slowDownErr):
+		common.WriteError(respWriter, http.StatusBadRequest, "SLOW_DOWN", "poll less often, the interval went up by 5 seconds")
+
+	case errors.As(err, &expiredErr):
+		common.WriteError(respWriter, http.StatusBadRequest, "EXPIRED_TOKEN", "the device code expired")
+	case errors.As(err, &invalidGrant):
+		writeGrantError(respWriter, err)
+	default:
+		log.Printf("failed to poll device code: %v", err)
+		common.WriteInternalError(respWriter)
+	}
+}
+
+// handleDeviceCode redeems an approved device code for an access token, plus an ID token when the
+// openid scope was granted.
+func handleDeviceCode(respWriter http.ResponseWriter, request *http.Request, tokenHelperSrv tokenhelper.Service, clientStoreSrv clientstore.Service) {
+	ctx := request.Context()
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var deviceStoreSrv devicestore.Service
+
+	if err := devicestore.FromContextAs(
+		ctx,
+		&deviceStoreSrv); err != nil {
+		log.Printf("device store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	client, ok := identifyClient(respWriter, request, clientStoreSrv)
+	if !ok {
+		return
+	}
+
+	if !client.AllowsGrant(grantTypeDeviceCode) {
+		log.Printf("client: %q may not use the device code grant", client.ID)
+		common.WriteError(respWriter, http.StatusBadRequest, "UNAUTHORIZED_CLIENT", "client may not use this grant_type")
+
+		return
+	}
+
+	deviceCodeHash, err := sha256Hex(request.PostForm.Get("device_code"))
+	if err != nil {
+		log.Printf("failed to hash device code: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	grant, err := deviceStoreSrv.Poll(deviceCodeHash)
+	if err != nil {
+		writeDeviceError(respWriter, err)
+
+		return
+	}
+
+	if grant.ClientID != client.ID {
+		writeGrantError(respWriter, common.InvalidGrantError("device code was issued to another client"))
+
+		return
+	}
+
+	user, err := userStoreSrv.Get(grant.Subject)
+	if err != nil || user.Disabled {
+		writeGrantError(respWriter, common.InvalidGrantError("user not found or disabled"))
+
+		return
+	}
+
+	response, err := userTokenResponse(
+		ctx,
+		tokenHelperSrv,
+		user,
+		client.ID,
+		grant.Scope,
+		grant.AMR,
+		tokenhelper.WithAuthTime(grant.ApprovedAt),
+	)
+	if err != nil {
+		log.Printf("failed to generate tokens: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, response)
+}
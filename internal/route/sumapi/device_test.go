@@ -0,0 +1,231 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/devicestore"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+)
+
+// newDeviceServer also creates bob, a user with a second factor, and returns the TOTP secret of bob.
+func newDeviceServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	cli := clientstore.Client{
+		ID:         "cli",
+		Public:     true,
+		GrantTypes: []string{grantTypeDeviceCode},
+		Scopes:     []string{"sum:write"},
+	}
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		t.Fatalf("Could not create the user store: %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "alice password"); err != nil {
+		t.Fatalf("Could not create the user: %v", err)
+	}
+
+	bobSecret := createTOTPUser(t, userStoreSrv, "bob", "bob password")
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t)))
+	router.Use(userstore.Inject(userStoreSrv))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(devicestore.Inject(devicestore.New()))
+	router.Use(clientstore.Inject(&clientstore.ClientStoreClientImplMock{
+		GetFn: func(id string) (clientstore.Client, error) {
+			if id != cli.ID {
+				return clientstore.Client{}, common.InvalidClientError(id)
+			}
+
+			return cli, nil
+		},
+	}))
+
+	InstallRoutes(router)
+
+	return server, bobSecret
+}
+
+func Test_deviceFlow(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	server, bobSecret := newDeviceServer(t)
+
+	postForm := func(path string, form url.Values) *http.Response {
+		t.Helper()
+
+		request, err := http.NewRequestWithContext(ctx, "POST", server.URL+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		t.Cleanup(func() { response.Body.Close() })
+
+		return response
+	}
+
+	authorizeDevice := func(scope string) DeviceAuthorizationResponse {
+		t.Helper()
+
+		response := postForm("/sumapi/v1/oauth/device_authorization", url.Values{
+			"client_id": {"cli"},
+			"scope":     {scope},
+		})
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusOK)
+		}
+
+		var deviceResponse DeviceAuthorizationResponse
+
+		if err := json.NewDecoder(response.Body).Decode(&deviceResponse); err != nil {
+			t.Fatalf("Could not decode the response: %v", err)
+		}
+
+		if deviceResponse.DeviceCode == "" || len(deviceResponse.UserCode) != userCodeLength+1 || deviceResponse.Interval == 0 {
+			t.Fatalf("device authorization response: %+v, want a device code, user code and interval", deviceResponse)
+		}
+
+		return deviceResponse
+	}
+
+	poll := func(deviceCode, expectedCode string, expectedStatusCode int) *http.Response {
+		t.Helper()
+
+		response := postForm("/sumapi/v1/oauth/token", url.Values{
+			"grant_type":  {grantTypeDeviceCode},
+			"client_id":   {"cli"},
+			"device_code": {deviceCode},
+		})
+		if response.StatusCode != expectedStatusCode {
+			t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, expectedStatusCode)
+		}
+
+		if expectedCode != "" {
+			var errResponse struct {
+				Code string `json:"code"`
+			}
+
+			if err := json.NewDecoder(response.Body).Decode(&errResponse); err != nil || errResponse.Code != expectedCode {
+				t.Fatalf("error response: %+v, %v, want code: %v", errResponse, err, expectedCode)
+			}
+		}
+
+		return response
+	}
+
+	// polling before the interval has passed slows the client down
+	pending := authorizeDevice("sum:write")
+	poll(pending.DeviceCode, "AUTHORIZATION_PENDING", http.StatusBadRequest)
+	poll(pending.DeviceCode, "SLOW_DOWN", http.StatusBadRequest)
+
+	// the client may only ask for its own scopes
+	if response := postForm("/sumapi/v1/oauth/device_authorization", url.Values{
+		"client_id": {"cli"},
+		"scope":     {"sum:write admin"},
+	}); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusBadRequest)
+	}
+
+	// without a scope the device gets the scopes of alice the client is allowed
+	approved := authorizeDevice("")
+
+	approve := url.Values{
+		"user_code": {strings.ToLower(approved.UserCode)},
+		"username":  {"alice"},
+		"password":  {"wrong password"},
+	}
+
+	if response := postForm("/sumapi/v1/oauth/device", approve); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	approve.Set("password", "alice password")
+
+	if response := postForm("/sumapi/v1/oauth/device", approve); response.StatusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusOK)
+	}
+
+	response := poll(approved.DeviceCode, "", http.StatusOK)
+
+	var tokenResponse TokenResponse
+
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		t.Fatalf("Could not decode the response: %v", err)
+	}
+
+	if tokenResponse.Scope != "sum:write" || tokenResponse.AccessToken == "" || tokenResponse.IDToken != "" {
+		t.Fatalf("token response: %+v, want the sum:write scope and only an access token", tokenResponse)
+	}
+
+	// device codes are single use
+	poll(approved.DeviceCode, "INVALID_GRANT", http.StatusUnauthorized)
+
+	// bob has a second factor so the password alone does not approve the device
+	bobApproved := authorizeDevice("sum:write")
+
+	bobApprove := url.Values{
+		"user_code": {bobApproved.UserCode},
+		"username":  {"bob"},
+		"password":  {"bob password"},
+	}
+
+	if response := postForm("/sumapi/v1/oauth/device", bobApprove); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	bobApprove.Set("code", totpCodeAt(t, bobSecret, time.Now().Add(30*time.Second)))
+
+	if response := postForm("/sumapi/v1/oauth/device", bobApprove); response.StatusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusOK)
+	}
+
+	response = poll(bobApproved.DeviceCode, "", http.StatusOK)
+
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		t.Fatalf("Could not decode the response: %v", err)
+	}
+
+	accessClaims := &tokenhelper.Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenResponse.AccessToken, accessClaims); err != nil {
+		t.Fatalf("Could not parse the access token: %v", err)
+	}
+
+	if accessClaims.Subject != "bob" || !accessClaims.HasAMR(amrOTP) {
+		t.Fatalf("access token claims: %+v, want bob with the otp amr", accessClaims)
+	}
+}
@@ -0,0 +1,85 @@
+package sumapi
+
+import (
+	"log"
+	"net/http"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonprovider"
+)
+
+type DiffRequestBody struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type DiffResponse struct {
+	BeforeSum int                       `json:"before_sum"`
+	AfterSum  int                       `json:"after_sum"`
+	Delta     int                       `json:"delta"`
+	Changes   []jsonprovider.LeafChange `json:"changes"`
+}
+
+func handleDiff(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var jsonProviderSrv jsonprovider.Service
+
+	if err := jsonprovider.FromContextAs(
+		ctx,
+		&jsonProviderSrv); err != nil {
+		log.Printf("json provider service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var diffRequestBody DiffRequestBody
+
+	if !readJSONBody(respWriter, request, goLibSrv, &diffRequestBody) {
+		return
+	}
+
+	beforeSum, err := sumDocument(jsonProviderSrv, diffRequestBody.Before)
+	if err != nil {
+		log.Printf("failed to sum before document: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	afterSum, err := sumDocument(jsonProviderSrv, diffRequestBody.After)
+	if err != nil {
+		log.Printf("failed to sum after document: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	changes, err := jsonProviderSrv.DiffNumericLeaves(diffRequestBody.Before, diffRequestBody.After)
+	if err != nil {
+		log.Printf("failed to diff documents: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &DiffResponse{
+		BeforeSum: beforeSum,
+		AfterSum:  afterSum,
+		Delta:     afterSum - beforeSum,
+		Changes:   changes,
+	})
+}
@@ -0,0 +1,94 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonprovider"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_handleDiff(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	client := &http.Client{}
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedDelta      int
+		expectedChanges    int
+	}{
+		{
+			name:               "handleDiff-successfulResponse",
+			body:               `{"before": {"a": [1, 2], "b": 3}, "after": {"a": [1, 5], "c": 4}}`,
+			expectedStatusCode: 200,
+			expectedDelta:      4,
+			expectedChanges:    3,
+		},
+		{
+			name:               "handleDiff-identical",
+			body:               `{"before": [1, {"a": 2}], "after": [1, {"a": 2}]}`,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "handleDiff-badJSON",
+			body:               `{"before": `,
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(jsonprovider.Inject(&jsonprovider.JSONProviderClientImplMock{}))
+
+			router.Route("/sumapi/v1", func(router chi.Router) {
+				router.Post("/diff", handleDiff)
+			})
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/diff", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			var diffResponse DiffResponse
+
+			if err := json.NewDecoder(response.Body).Decode(&diffResponse); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if diffResponse.Delta != tt.expectedDelta || len(diffResponse.Changes) != tt.expectedChanges {
+				t.Fatalf("response: %+v does not match expected delta: %v and %v changes", diffResponse, tt.expectedDelta, tt.expectedChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package sumapi
+
+import (
+	"net/http"
+
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/keystore"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/spf13/viper"
+)
+
+// OpenIDConfiguration is the OpenID Connect discovery document, only the fields that apply to
+// this API are filled in.
+type OpenIDConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint      string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+	// TLSClientCertificateBoundAccessTokens is the RFC 8705 metadata, set when client certificates
+	// are verified
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+}
+
+func openIDConfiguration() *OpenIDConfiguration {
+	issuer := tokenhelper.Issuer()
+
+	algorithm := viper.GetString(constant.TokenAlgorithm)
+	if algorithm == "" {
+		algorithm = keystore.AlgorithmHS256
+	}
+
+	return &OpenIDConfiguration{
+		Issuer:                                issuer,
+		JWKSURI:                               issuer + "/.well-known/jwks.json",
+		AuthorizationEndpoint:                 issuer + "/sumapi/v1/oauth/authorize",
+		TokenEndpoint:                         issuer + "/sumapi/v1/oauth/token",
+		DeviceAuthorizationEndpoint:           issuer + "/sumapi/v1/oauth/device_authorization",
+		UserInfoEndpoint:                      issuer + "/userinfo",
+		GrantTypesSupported:                   viper.GetStringSlice(constant.OIDCGrantTypes),
+		ResponseTypesSupported:                []string{"code"},
+		SubjectTypesSupported:                 []string{"public"},
+		IDTokenSigningAlgValuesSupported:      []string{algorithm},
+		ClaimsSupported:                       viper.GetStringSlice(constant.OIDCClaims),
+		ScopesSupported:                       append([]string{scopeOpenID}, scopesOf(roleNames())...),
+		CodeChallengeMethodsSupported:         []string{codeChallengeMethodS256},
+		TLSClientCertificateBoundAccessTokens: viper.GetString(constant.TLSClientCAFile) != "",
+	}
+}
+
+// handleOpenIDConfiguration serves the discovery document built from the token and oidc config.
+func handleOpenIDConfiguration(respWriter http.ResponseWriter, request *http.Request) {
+	writeResponse(respWriter, openIDConfiguration())
+}
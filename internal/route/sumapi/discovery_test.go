@@ -0,0 +1,65 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-wai-wong/internal/config"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_handleOpenIDConfiguration(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	InstallRoutes(router)
+
+	request, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, http.StatusOK)
+	}
+
+	var discovery OpenIDConfiguration
+	if err := json.NewDecoder(response.Body).Decode(&discovery); err != nil {
+		t.Fatalf("Could not decode the response: %v", err)
+	}
+
+	if discovery.Issuer != "http://localhost:8080" ||
+		discovery.JWKSURI != "http://localhost:8080/.well-known/jwks.json" ||
+		discovery.AuthorizationEndpoint != "http://localhost:8080/sumapi/v1/oauth/authorize" ||
+		discovery.TokenEndpoint != "http://localhost:8080/sumapi/v1/oauth/token" ||
+		discovery.UserInfoEndpoint != "http://localhost:8080/userinfo" {
+		t.Fatalf("Response discovery document: %+v does not match the issuer urls", discovery)
+	}
+
+	if len(discovery.IDTokenSigningAlgValuesSupported) != 1 || discovery.IDTokenSigningAlgValuesSupported[0] != "HS256" {
+		t.Fatalf("Response algorithms: %v do not match expected: [HS256]", discovery.IDTokenSigningAlgValuesSupported)
+	}
+
+	if len(discovery.GrantTypesSupported) == 0 || len(discovery.ClaimsSupported) == 0 {
+		t.Fatalf("Response discovery document: %+v is missing grants or claims", discovery)
+	}
+}
@@ -0,0 +1,174 @@
+package sumapi
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// handleTokenExchange is the RFC 8693 token exchange grant, a service trades the token of a user
+// for a token to call another API on behalf of the user. The new token keeps the subject, its
+// scope can only narrow and it carries the calling client in the act claim. The audience stays the
+// one of the subject token unless the client asks for another API that accepts our tokens.
+func handleTokenExchange(respWriter http.ResponseWriter, request *http.Request, tokenHelperSrv tokenhelper.Service, clientStoreSrv clientstore.Service) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	client, ok := authenticateClient(respWriter, request, clientStoreSrv)
+	if !ok {
+		return
+	}
+
+	if !client.AllowsGrant(grantTypeTokenExchange) {
+		log.Printf("client: %q may not use the token exchange grant", client.ID)
+		common.WriteError(respWriter, http.StatusBadRequest, "UNAUTHORIZED_CLIENT", "client may not use this grant_type")
+
+		return
+	}
+
+	if tokenType := request.PostForm.Get("subject_token_type"); tokenType != tokenTypeAccessToken && tokenType != tokenTypeJWT {
+		log.Printf("client: %q sent subject token type: %q", client.ID, tokenType)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_REQUEST", "subject_token_type is not supported")
+
+		return
+	}
+
+	// the service exchanging is not the holder of the subject token, a token bound to the
+	// certificate of the user is presented over the connection of the service
+	subjectClaims, err := tokenHelperSrv.VerifyToken(tokenhelper.WithoutCertificateBinding(ctx), request.PostForm.Get("subject_token"))
+	if err != nil {
+		log.Printf("client: %q sent an invalid subject token: %v", client.ID, err)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_REQUEST", "subject_token is invalid")
+
+		return
+	}
+
+	scopes, ok := exchangedScopes(respWriter, request, client, subjectClaims)
+	if !ok {
+		return
+	}
+
+	audience := subjectClaims.Audience
+
+	if requested := request.PostForm.Get("audience"); requested != "" && requested != audience {
+		if !configuredAudience(requested) {
+			log.Printf("client: %q requested audience: %q that is not configured", client.ID, requested)
+			common.WriteError(respWriter, http.StatusBadRequest, "INVALID_TARGET", "audience is not allowed")
+
+			return
+		}
+
+		audience = requested
+	}
+
+	if !client.AllowsAudience(audience) {
+		log.Printf("client: %q requested audience: %q", client.ID, audience)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_TARGET", "audience is not allowed")
+
+		return
+	}
+
+	// the exchanged token must not outlive the subject token
+	now := goLibSrv.Now()
+
+	expiresAt := now.Add(viper.GetDuration(constant.TokenExpiresIn))
+	if subjectExpiresAt := time.Unix(subjectClaims.ExpiresAt, 0); subjectExpiresAt.Before(expiresAt) {
+		expiresAt = subjectExpiresAt
+	}
+
+	token, err := tokenHelperSrv.GenToken(
+		ctx,
+		subjectClaims.Subject,
+		append([]tokenhelper.Option{
+			tokenhelper.WithScope(scopes...),
+			tokenhelper.WithAudience(audience),
+			tokenhelper.WithAuthorizedParty(client.ID),
+			tokenhelper.WithActor(&tokenhelper.Actor{Subject: client.ID, Actor: subjectClaims.Actor}),
+			tokenhelper.WithExpiresAt(expiresAt),
+		}, certificateBinding(ctx)...)...,
+	)
+	if err != nil {
+		log.Printf("failed to generate token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &TokenResponse{
+		AccessToken:     token,
+		IssuedTokenType: tokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       uint32(expiresAt.Sub(now) / time.Second),
+		Scope:           strings.Join(scopes, " "),
+	})
+}
+
+// configuredAudience reports whether audience is token.audience or one of token.audiences, the
+// APIs that accept the tokens of this server.
+func configuredAudience(audience string) bool {
+	if audience == viper.GetString(constant.TokenAudience) {
+		return true
+	}
+
+	for _, configured := range viper.GetStringSlice(constant.TokenAudiences) {
+		if configured == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exchangedScopes returns the requested scopes, each must be in the subject token and allowed for
+// the client. Without a requested scope it returns the scopes of the subject token the client is
+// allowed. Writes a 400 and returns false when a scope cannot be granted.
+func exchangedScopes(respWriter http.ResponseWriter, request *http.Request, client clientstore.Client, subjectClaims *tokenhelper.Claims) ([]string, bool) {
+	requested := strings.Fields(request.PostForm.Get("scope"))
+	if len(requested) > 0 {
+		for _, scope := range requested {
+			if !subjectClaims.HasScope(scope) || !client.AllowsScope(scope) {
+				log.Printf("client: %q requested scope: %q", client.ID, scope)
+				common.WriteError(respWriter, http.StatusBadRequest, "INVALID_SCOPE", "scope "+scope+" is not allowed")
+
+				return nil, false
+			}
+		}
+
+		return requested, true
+	}
+
+	scopes := []string{}
+
+	for _, scope := range subjectClaims.Scopes() {
+		if client.AllowsScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes, true
+}
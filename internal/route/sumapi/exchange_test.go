@@ -0,0 +1,248 @@
+package sumapi
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+)
+
+// Test_handleTokenExchange does not run in parallel as it sets the token audiences in the global
+// config.
+func Test_handleTokenExchange(t *testing.T) {
+	config.LoadConfig()
+
+	audiences := viper.GetStringSlice(constant.TokenAudiences)
+
+	t.Cleanup(func() { viper.Set(constant.TokenAudiences, audiences) })
+
+	viper.Set(constant.TokenAudiences, []string{"billing", "payroll"})
+
+	ctx := golib.WithGoLib(context.Background(), golib.New())
+
+	reports := clientstore.Client{
+		ID:         "reports",
+		GrantTypes: []string{grantTypeTokenExchange},
+		Scopes:     []string{"sum:write", "documents:read"},
+		Audiences:  []string{"local", "billing", "archive"},
+	}
+
+	userToken, err := newTokenHelper(t).GenToken(ctx, "alice", tokenhelper.WithScope("sum:write", "documents:write"))
+	if err != nil {
+		t.Fatalf("Could not generate the token: %v", err)
+	}
+
+	// a token the gateway already got on behalf of alice
+	delegatedToken, err := newTokenHelper(t).GenToken(
+		ctx,
+		"alice",
+		tokenhelper.WithScope("sum:write"),
+		tokenhelper.WithActor(&tokenhelper.Actor{Subject: "gateway"}),
+	)
+	if err != nil {
+		t.Fatalf("Could not generate the token: %v", err)
+	}
+
+	// a token bound to the certificate of alice, the service exchanging it does not have it
+	boundToken, err := newTokenHelper(t).GenToken(
+		ctx,
+		"alice",
+		tokenhelper.WithScope("sum:write"),
+		tokenhelper.WithCertificateBinding(newTestCA(t).clientCertificate(t, pkix.Name{CommonName: "alice"}, 2).Leaf),
+	)
+	if err != nil {
+		t.Fatalf("Could not generate the token: %v", err)
+	}
+
+	exchange := func(subjectToken string, extra url.Values) url.Values {
+		form := url.Values{
+			"grant_type":         {grantTypeTokenExchange},
+			"subject_token":      {subjectToken},
+			"subject_token_type": {tokenTypeAccessToken},
+		}
+
+		for key, values := range extra {
+			form[key] = values
+		}
+
+		return form
+	}
+
+	tests := []struct {
+		name               string
+		form               url.Values
+		expectedStatusCode int
+		expectedScope      string
+		expectedAudience   string
+		expectedActors     []string
+	}{
+		{
+			name:               "tokenExchange-narrowedToClient",
+			form:               exchange(userToken, nil),
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write",
+			expectedAudience:   "local",
+			expectedActors:     []string{"reports"},
+		},
+		{
+			name:               "tokenExchange-sameAudience",
+			form:               exchange(userToken, url.Values{"audience": {"local"}, "scope": {"sum:write"}}),
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write",
+			expectedAudience:   "local",
+			expectedActors:     []string{"reports"},
+		},
+		{
+			name:               "tokenExchange-otherAudience",
+			form:               exchange(userToken, url.Values{"audience": {"billing"}, "scope": {"sum:write"}}),
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write",
+			expectedAudience:   "billing",
+			expectedActors:     []string{"reports"},
+		},
+		{
+			// the client is allowed archive but it does not accept our tokens
+			name:               "tokenExchange-audienceNotConfigured",
+			form:               exchange(userToken, url.Values{"audience": {"archive"}}),
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "tokenExchange-actorChain",
+			form:               exchange(delegatedToken, nil),
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write",
+			expectedAudience:   "local",
+			expectedActors:     []string{"reports", "gateway"},
+		},
+		{
+			name:               "tokenExchange-boundSubjectToken",
+			form:               exchange(boundToken, nil),
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write",
+			expectedAudience:   "local",
+			expectedActors:     []string{"reports"},
+		},
+		{
+			name:               "tokenExchange-scopeNotInSubjectToken",
+			form:               exchange(userToken, url.Values{"scope": {"documents:read"}}),
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "tokenExchange-scopeNotAllowed",
+			form:               exchange(userToken, url.Values{"scope": {"documents:write"}}),
+			expectedStatusCode: 400,
+		},
+		{
+			// payroll accepts our tokens but the client is not allowed it
+			name:               "tokenExchange-invalidAudience",
+			form:               exchange(userToken, url.Values{"audience": {"payroll"}}),
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "tokenExchange-invalidSubjectToken",
+			form:               exchange("not a token", nil),
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "tokenExchange-unsupportedTokenType",
+			form:               exchange(userToken, url.Values{"subject_token_type": {"urn:ietf:params:oauth:token-type:refresh_token"}}),
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(golib.New()))
+			router.Use(tokenhelper.Inject(newTokenHelper(t)))
+			router.Use(clientstore.Inject(&clientstore.ClientStoreClientImplMock{
+				AuthenticateFn: func(id, secret string) (clientstore.Client, error) {
+					if id != reports.ID || secret != "reports secret" {
+						return clientstore.Client{}, common.InvalidClientError(id)
+					}
+
+					return reports, nil
+				},
+			}))
+
+			InstallRoutes(router)
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/oauth/token", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.SetBasicAuth("reports", "reports+secret")
+
+			response, err := (&http.Client{}).Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			if response.StatusCode != http.StatusOK {
+				return
+			}
+
+			var tokenResponse TokenResponse
+
+			if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if tokenResponse.Scope != tt.expectedScope || tokenResponse.IssuedTokenType != tokenTypeAccessToken {
+				t.Fatalf("token response scope: %q type: %q, want scope: %q", tokenResponse.Scope, tokenResponse.IssuedTokenType, tt.expectedScope)
+			}
+
+			claims := &tokenhelper.Claims{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(tokenResponse.AccessToken, claims); err != nil {
+				t.Fatalf("Could not parse the token: %v", err)
+			}
+
+			if claims.Subject != "alice" || claims.AuthorizedParty != "reports" || claims.Audience != tt.expectedAudience {
+				t.Fatalf("token sub: %q azp: %q aud: %q, want alice and audience: %q", claims.Subject, claims.AuthorizedParty, claims.Audience, tt.expectedAudience)
+			}
+
+			actor := claims.Actor
+			for _, expectedActor := range tt.expectedActors {
+				if actor == nil || actor.Subject != expectedActor {
+					t.Fatalf("token act: %+v, want the actors: %v", claims.Actor, tt.expectedActors)
+				}
+
+				actor = actor.Actor
+			}
+
+			if actor != nil {
+				t.Fatalf("token act: %+v, want only the actors: %v", claims.Actor, tt.expectedActors)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package sumapi
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/tokenhelper"
+)
+
+// IntrospectionResponse is the RFC 7662 introspection response, an inactive token only has
+// active set.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	JTI       string `json:"jti,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	// Actor is the delegation chain of an exchanged token
+	Actor *tokenhelper.Actor `json:"act,omitempty"`
+	// Confirmation is the client certificate a bound token has to be presented with
+	Confirmation *tokenhelper.Confirmation `json:"cnf,omitempty"`
+}
+
+// authenticateClient checks the client credentials of a request, sent with HTTP Basic auth or as
+// client_id and client_secret form values. Writes a 401 and returns false when they are invalid.
+func authenticateClient(respWriter http.ResponseWriter, request *http.Request, clientStoreSrv clientstore.Service) (clientstore.Client, bool) {
+	clientID, clientSecret, ok := request.BasicAuth()
+	if ok {
+		// RFC 6749 form encodes the credentials before they are base64 encoded
+		var idErr, secretErr error
+
+		clientID, idErr = url.QueryUnescape(clientID)
+		clientSecret, secretErr = url.QueryUnescape(clientSecret)
+
+		if idErr != nil || secretErr != nil {
+			ok = false
+		}
+	} else {
+		clientID, clientSecret = request.PostForm.Get("client_id"), request.PostForm.Get("client_secret")
+		ok = clientID != ""
+	}
+
+	if ok {
+		client, err := clientStoreSrv.Authenticate(clientID, clientSecret)
+		if err == nil {
+			return client, true
+		}
+
+		log.Printf("failed to authenticate client: %v", err)
+	}
+
+	respWriter.Header().Add("WWW-Authenticate", `Basic realm="sumapi"`)
+	common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_CLIENT", "client authentication failed")
+
+	return clientstore.Client{}, false
+}
+
+// handleIntrospect is RFC 7662 token introspection for authenticated clients.
+func handleIntrospect(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		ctx,
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		ctx,
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		log.Printf("failed to parse form: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	if _, ok := authenticateClient(respWriter, request, clientStoreSrv); !ok {
+		return
+	}
+
+	token := request.PostForm.Get("token")
+	if token == "" {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "token is required")
+
+		return
+	}
+
+	// the client introspecting is not the holder of the token, the resource server checks cnf
+	claims, err := tokenHelperSrv.VerifyToken(tokenhelper.WithoutCertificateBinding(ctx), token)
+	if err != nil {
+		log.Printf("introspected token is not active: %v", err)
+		writeResponse(respWriter, &IntrospectionResponse{Active: false})
+
+		return
+	}
+
+	writeResponse(respWriter, &IntrospectionResponse{
+		Active:       true,
+		Subject:      claims.Subject,
+		Audience:     claims.Audience,
+		Issuer:       claims.Issuer,
+		ExpiresAt:    claims.ExpiresAt,
+		IssuedAt:     claims.IssuedAt,
+		Scope:        claims.Scope,
+		JTI:          claims.Id,
+		ClientID:     claims.AuthorizedParty,
+		Actor:        claims.Actor,
+		Confirmation: claims.Confirmation,
+	})
+}
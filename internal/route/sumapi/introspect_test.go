@@ -0,0 +1,149 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_handleIntrospect(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := golib.WithGoLib(context.Background(), golib.New())
+
+	token, err := newTokenHelper(t).GenToken(ctx, "testUsername")
+	if err != nil {
+		t.Fatalf("Get token failed, %v", err)
+	}
+
+	clientStoreMock := &clientstore.ClientStoreClientImplMock{
+		AuthenticateFn: func(id, secret string) (clientstore.Client, error) {
+			if id == "gateway" && secret == "gateway secret" {
+				return clientstore.Client{ID: id}, nil
+			}
+
+			return clientstore.Client{}, common.InvalidClientError(id)
+		},
+	}
+
+	tests := []struct {
+		name               string
+		form               url.Values
+		basicAuth          []string
+		expectedStatusCode int
+		expectedActive     bool
+	}{
+		{
+			name:               "handleIntrospect-activeToken",
+			form:               url.Values{"token": {token}},
+			basicAuth:          []string{"gateway", "gateway+secret"},
+			expectedStatusCode: 200,
+			expectedActive:     true,
+		},
+		{
+			name:               "handleIntrospect-formClientCredentials",
+			form:               url.Values{"token": {token}, "client_id": {"gateway"}, "client_secret": {"gateway secret"}},
+			expectedStatusCode: 200,
+			expectedActive:     true,
+		},
+		{
+			name:               "handleIntrospect-inactiveToken",
+			form:               url.Values{"token": {"not-a-token"}},
+			basicAuth:          []string{"gateway", "gateway+secret"},
+			expectedStatusCode: 200,
+			expectedActive:     false,
+		},
+		{
+			name:               "handleIntrospect-missingToken",
+			form:               url.Values{},
+			basicAuth:          []string{"gateway", "gateway+secret"},
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "handleIntrospect-badClientSecret",
+			form:               url.Values{"token": {token}},
+			basicAuth:          []string{"gateway", "wrong"},
+			expectedStatusCode: 401,
+		},
+		{
+			name:               "handleIntrospect-noClientCredentials",
+			form:               url.Values{"token": {token}},
+			expectedStatusCode: 401,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(golib.New()))
+			router.Use(tokenhelper.Inject(newTokenHelper(t)))
+			router.Use(clientstore.Inject(clientStoreMock))
+
+			InstallRoutes(router)
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/introspect", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			if tt.basicAuth != nil {
+				request.SetBasicAuth(tt.basicAuth[0], tt.basicAuth[1])
+			}
+
+			response, err := (&http.Client{}).Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			if response.StatusCode != http.StatusOK {
+				return
+			}
+
+			var introspection IntrospectionResponse
+			if err := json.NewDecoder(response.Body).Decode(&introspection); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if introspection.Active != tt.expectedActive {
+				t.Fatalf("Response active: %v does not match expected active: %v", introspection.Active, tt.expectedActive)
+			}
+
+			if tt.expectedActive && (introspection.Subject != "testUsername" || introspection.JTI == "" || introspection.IssuedAt == 0 || introspection.ExpiresAt == 0) {
+				t.Fatalf("Response introspection: %+v is missing claims", introspection)
+			}
+
+			if !tt.expectedActive && introspection.Subject != "" {
+				t.Fatalf("Response introspection: %+v has claims for an inactive token", introspection)
+			}
+		})
+	}
+}
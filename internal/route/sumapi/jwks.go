@@ -0,0 +1,69 @@
+package sumapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/keystore"
+	"go-wai-wong/internal/tokenhelper"
+)
+
+// handleJWKS publishes the public keys of the key store, active and retired keys still inside
+// their overlap window. Without a key store the public key of token.publickeyfile is published,
+// there is no public key for HS256.
+func handleJWKS(respWriter http.ResponseWriter, request *http.Request) {
+	var keyStoreSrv keystore.Service
+
+	if err := keystore.FromContextAs(
+		request.Context(),
+		&keyStoreSrv); err != nil {
+		var missingErr common.CtxValueKeyMissingError
+		if errors.As(err, &missingErr) {
+			handleKeyFileJWKS(respWriter, request)
+
+			return
+		}
+
+		log.Printf("key store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	jwks, err := keyStoreSrv.JWKS()
+	if err != nil {
+		log.Printf("failed to build jwks: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	respWriter.Header().Set("Content-Type", "application/jwk-set+json")
+	writeResponse(respWriter, &jwks)
+}
+
+func handleKeyFileJWKS(respWriter http.ResponseWriter, request *http.Request) {
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		request.Context(),
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	jwks, err := tokenHelperSrv.JWKS()
+	if err != nil {
+		log.Printf("failed to build jwks: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	respWriter.Header().Set("Content-Type", "application/jwk-set+json")
+	writeResponse(respWriter, &jwks)
+}
@@ -0,0 +1,134 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/keystore"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_handleJWKS(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	client := &http.Client{}
+
+	privateKey, err := keystore.GenerateKey(keystore.AlgorithmES256)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		keyStoreMock       *keystore.KeyStoreClientImplMock
+		tokenHelperMock    *tokenhelper.TokenClientImplMock
+		expectedStatusCode int
+		expectedKids       []string
+	}{
+		{
+			name: "handleJWKS-activeAndRetiredKeys",
+			keyStoreMock: &keystore.KeyStoreClientImplMock{
+				JWKSFn: func() (keystore.JWKSet, error) {
+					jwks := keystore.JWKSet{}
+
+					for _, kid := range []string{"retired", "active"} {
+						jwk, err := keystore.PublicJWK(keystore.Key{ID: kid, Algorithm: keystore.AlgorithmES256, PublicKey: privateKey.Public()})
+						if err != nil {
+							return keystore.JWKSet{}, err
+						}
+
+						jwks.Keys = append(jwks.Keys, jwk)
+					}
+
+					return jwks, nil
+				},
+			},
+			expectedStatusCode: 200,
+			expectedKids:       []string{"retired", "active"},
+		},
+		{
+			name: "handleJWKS-keyFile",
+			tokenHelperMock: &tokenhelper.TokenClientImplMock{
+				JWKSFn: func() (keystore.JWKSet, error) {
+					jwk, err := keystore.PublicJWK(keystore.Key{ID: "thumbprint", Algorithm: keystore.AlgorithmES256, PublicKey: privateKey.Public()})
+					if err != nil {
+						return keystore.JWKSet{}, err
+					}
+
+					return keystore.JWKSet{Keys: []keystore.JWK{jwk}}, nil
+				},
+			},
+			expectedStatusCode: 200,
+			expectedKids:       []string{"thumbprint"},
+		},
+		{
+			name:               "handleJWKS-hs256",
+			tokenHelperMock:    &tokenhelper.TokenClientImplMock{},
+			expectedStatusCode: 200,
+			expectedKids:       []string{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			if tt.keyStoreMock != nil {
+				router.Use(keystore.Inject(tt.keyStoreMock))
+			}
+
+			if tt.tokenHelperMock != nil {
+				router.Use(tokenhelper.Inject(tt.tokenHelperMock))
+			}
+
+			router.Get("/.well-known/jwks.json", handleJWKS)
+
+			request, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/.well-known/jwks.json", nil)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			var jwks keystore.JWKSet
+			if err := json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if len(jwks.Keys) != len(tt.expectedKids) {
+				t.Fatalf("Response keys: %v do not match expected kids: %v", jwks.Keys, tt.expectedKids)
+			}
+
+			for index, jwk := range jwks.Keys {
+				if jwk.Kid != tt.expectedKids[index] || jwk.Kty != "EC" {
+					t.Fatalf("Response key: %+v does not match expected kid: %v", jwk, tt.expectedKids[index])
+				}
+			}
+		})
+	}
+}
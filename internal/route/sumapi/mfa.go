@@ -0,0 +1,372 @@
+package sumapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/spf13/viper"
+)
+
+type MFARequestBody struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TOTPConfirmRequestBody struct {
+	Code string `json:"code"`
+}
+
+// TOTPEnrollmentResponse has the new secret, otpauth_uri is the text of the QR code authenticator
+// apps scan.
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// writeMFAChallenge answers a right password of a user with a second factor with a short lived
+// mfa_token to send with the code to /auth/mfa, it expires relative to now.
+func writeMFAChallenge(respWriter http.ResponseWriter, challengeStoreSrv challengestore.Service, now time.Time, user userstore.User) {
+	mfaToken, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("failed to generate mfa token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	mfaTokenHash, err := sha256Hex(mfaToken)
+	if err != nil {
+		log.Printf("failed to hash mfa token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	expiresIn := viper.GetDuration(constant.MFAChallengeExpiresIn)
+
+	if err := challengeStoreSrv.Save(mfaTokenHash, challengestore.Challenge{
+		Subject:   user.Username,
+		ExpiresAt: now.Add(expiresIn),
+	}); err != nil {
+		log.Printf("failed to save mfa challenge: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &AuthResponse{
+		ExpiresIn:   uint32(expiresIn / time.Second),
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// loginPageSecondFactor checks the one time code the login pages send along with the password and
+// returns the amr of the login. Users without a second factor log in with their password only,
+// users with one get MFARequiredError without a code, which is not a failed login.
+func loginPageSecondFactor(userStoreSrv userstore.Service, user userstore.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return []string{amrPassword}, nil
+	}
+
+	if code == "" {
+		return nil, common.MFARequiredError(user.Username)
+	}
+
+	if err := userStoreSrv.VerifyTOTP(user.Username, code); err != nil {
+		return nil, err
+	}
+
+	return []string{amrPassword, amrOTP, amrMFA}, nil
+}
+
+// secondFactorMessage is the message of the login pages for an error of loginPageSecondFactor.
+func secondFactorMessage(err error) string {
+	var mfaRequiredErr common.MFARequiredError
+	if errors.As(err, &mfaRequiredErr) {
+		return "Enter the one-time code from your authenticator app."
+	}
+
+	return "Invalid one-time code."
+}
+
+// handleMFA is the second step of /auth, it swaps the mfa_token and a TOTP code or a recovery code
+// for the token and refresh token. Wrong codes count as failed logins of the user.
+func handleMFA(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		ctx,
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var refreshStoreSrv refreshstore.Service
+
+	if err := refreshstore.FromContextAs(
+		ctx,
+		&refreshStoreSrv); err != nil {
+		log.Printf("refresh store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var attemptStoreSrv attemptstore.Service
+
+	if err := attemptstore.FromContextAs(
+		ctx,
+		&attemptStoreSrv); err != nil {
+		log.Printf("attempt store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var challengeStoreSrv challengestore.Service
+
+	if err := challengestore.FromContextAs(
+		ctx,
+		&challengeStoreSrv); err != nil {
+		log.Printf("challenge store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var mfaRequestBody MFARequestBody
+
+	if !readJSONBody(respWriter, request, goLibSrv, &mfaRequestBody) {
+		return
+	}
+
+	if mfaRequestBody.MFAToken == "" || (mfaRequestBody.Code == "") == (mfaRequestBody.RecoveryCode == "") {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "mfa_token and either code or recovery_code are required")
+
+		return
+	}
+
+	mfaTokenHash, err := sha256Hex(mfaRequestBody.MFAToken)
+	if err != nil {
+		log.Printf("failed to hash mfa token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	challenge, err := challengeStoreSrv.Get(mfaTokenHash)
+	if err != nil {
+		writeGrantError(respWriter, err)
+
+		return
+	}
+
+	// the account is checked before the challenge is used up and the failed logins are reset
+	user, err := userStoreSrv.Get(challenge.Subject)
+	if err != nil || user.Disabled {
+		writeGrantError(respWriter, common.InvalidGrantError("user not found or disabled"))
+
+		return
+	}
+
+	if wait := loginWait(attemptStoreSrv, request, challenge.Subject); wait > 0 {
+		log.Printf("login of: %q has to wait: %v", challenge.Subject, wait)
+		writeTooManyAttempts(respWriter, wait)
+
+		return
+	}
+
+	if mfaRequestBody.Code != "" {
+		err = userStoreSrv.VerifyTOTP(challenge.Subject, mfaRequestBody.Code)
+	} else {
+		err = userStoreSrv.UseRecoveryCode(challenge.Subject, mfaRequestBody.RecoveryCode)
+	}
+
+	if err != nil {
+		log.Printf("failed to verify second factor: %v", err)
+		countFailedLogin(attemptStoreSrv, goLibSrv.Now(), request, challenge.Subject, err)
+		writeMFAError(respWriter, err)
+
+		return
+	}
+
+	if err := challengeStoreSrv.Delete(mfaTokenHash); err != nil {
+		log.Printf("failed to delete mfa challenge: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	loginSucceeded(attemptStoreSrv, request, challenge.Subject)
+
+	// recovery codes are one time codes as well
+	writeAuthResponse(respWriter, request, tokenHelperSrv, refreshStoreSrv, user, []string{amrPassword, amrOTP, amrMFA})
+}
+
+// allowSelfEnrollment writes 403 MFA_ENROLLMENT_FORBIDDEN and returns false when the roles of
+// subject have scopes that need a second factor. A password alone would otherwise be enough to
+// enroll one and get those scopes, such users are enrolled out of band.
+func allowSelfEnrollment(respWriter http.ResponseWriter, userStoreSrv userstore.Service, subject string) bool {
+	user, err := userStoreSrv.Get(subject)
+	if err != nil {
+		log.Printf("failed to get user: %q: %v", subject, err)
+		writeUserStoreError(respWriter, err)
+
+		return false
+	}
+
+	if len(withheldScopes(user, nil)) > 0 {
+		log.Printf("user: %q with scopes that need a second factor tried to enroll one", subject)
+		common.WriteError(respWriter, http.StatusForbidden, "MFA_ENROLLMENT_FORBIDDEN", "users with scopes that need a second factor are enrolled by an operator")
+
+		return false
+	}
+
+	return true
+}
+
+// handleEnrollTOTP starts the TOTP enrolment of the token subject, the secret only becomes the
+// second factor once a code of it is confirmed.
+func handleEnrollTOTP(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	subject := subjectFromContext(request.Context())
+
+	if !allowSelfEnrollment(respWriter, userStoreSrv, subject) {
+		return
+	}
+
+	secret, err := userStoreSrv.EnrollTOTP(subject)
+	if err != nil {
+		log.Printf("failed to enroll totp of: %q: %v", subject, err)
+		writeMFAError(respWriter, err)
+
+		return
+	}
+
+	writeResponse(respWriter, &TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: userstore.TOTPURI(viper.GetString(constant.MFAIssuer), subject, secret),
+	})
+}
+
+// handleConfirmTOTP enables the pending TOTP secret of the token subject with a code of it and
+// returns the recovery codes, they are only shown this once.
+func handleConfirmTOTP(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var confirmRequestBody TOTPConfirmRequestBody
+
+	if !readUserBody(respWriter, request, &confirmRequestBody) {
+		return
+	}
+
+	if confirmRequestBody.Code == "" {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "code is required")
+
+		return
+	}
+
+	subject := subjectFromContext(request.Context())
+
+	// the roles may have changed since the enrolment
+	if !allowSelfEnrollment(respWriter, userStoreSrv, subject) {
+		return
+	}
+
+	recoveryCodes, err := userStoreSrv.ConfirmTOTP(subject, confirmRequestBody.Code)
+	if err != nil {
+		log.Printf("failed to confirm totp of: %q: %v", subject, err)
+		writeMFAError(respWriter, err)
+
+		return
+	}
+
+	writeResponse(respWriter, &RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+func writeMFAError(respWriter http.ResponseWriter, err error) {
+	var invalidMFACodeErr common.InvalidMFACodeError
+	if errors.As(err, &invalidMFACodeErr) {
+		common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_MFA_CODE", "code is incorrect")
+
+		return
+	}
+
+	var mfaEnabledErr common.MFAEnabledError
+	if errors.As(err, &mfaEnabledErr) {
+		common.WriteError(respWriter, http.StatusConflict, "MFA_ENABLED", "a second factor is already enabled")
+
+		return
+	}
+
+	var mfaNotEnrolledErr common.MFANotEnrolledError
+	if errors.As(err, &mfaNotEnrolledErr) {
+		common.WriteError(respWriter, http.StatusBadRequest, "MFA_NOT_ENROLLED", "no pending enrolment to confirm")
+
+		return
+	}
+
+	writeUserStoreError(respWriter, err)
+}
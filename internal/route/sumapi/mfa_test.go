@@ -0,0 +1,243 @@
+package sumapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+)
+
+// totpCodeAt is the code an authenticator app shows for secret at the time at.
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("Could not decode the secret: %v", err)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// createTOTPUser creates a user with a confirmed TOTP secret and returns the secret. The code of
+// the current time step is used up by the confirmation.
+func createTOTPUser(t *testing.T, userStoreSrv userstore.Service, username, password string) string {
+	t.Helper()
+
+	if _, err := userStoreSrv.Create(username, password); err != nil {
+		t.Fatalf("Could not create the user: %v", err)
+	}
+
+	secret, err := userStoreSrv.EnrollTOTP(username)
+	if err != nil {
+		t.Fatalf("Could not enroll the user: %v", err)
+	}
+
+	if _, err := userStoreSrv.ConfirmTOTP(username, totpCodeAt(t, secret, time.Now())); err != nil {
+		t.Fatalf("Could not confirm the secret: %v", err)
+	}
+
+	return secret
+}
+
+func Test_mfaFlow(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		t.Fatalf("Could not create the user store: %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "alice password"); err != nil {
+		t.Fatalf("Could not create the user: %v", err)
+	}
+
+	if err := userStoreSrv.SetRoles("alice", []string{"user", "admin"}); err != nil {
+		t.Fatalf("Could not set the roles: %v", err)
+	}
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t)))
+	router.Use(refreshstore.Inject(refreshstore.New()))
+	router.Use(userstore.Inject(userStoreSrv))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(challengestore.Inject(challengestore.New()))
+
+	InstallRoutes(router)
+
+	post := func(path, token, body string, expectedStatusCode int, out interface{}) {
+		t.Helper()
+
+		request, err := http.NewRequestWithContext(ctx, "POST", server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		response, err := (&http.Client{}).Do(request)
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		defer response.Body.Close()
+
+		if response.StatusCode != expectedStatusCode {
+			t.Fatalf("%v: Response status code: %v does not match expected status code: %v", path, response.StatusCode, expectedStatusCode)
+		}
+
+		if out != nil {
+			if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+		}
+	}
+
+	checkClaims := func(token string, expectedAdmin bool, expectedAMR ...string) {
+		t.Helper()
+
+		claims := &tokenhelper.Claims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+			t.Fatalf("Could not parse the token: %v", err)
+		}
+
+		if claims.HasScope(scopeAdmin) != expectedAdmin || strings.Join(claims.AMR, " ") != strings.Join(expectedAMR, " ") {
+			t.Fatalf("token scope: %q amr: %v, want admin: %v and amr: %v", claims.Scope, claims.AMR, expectedAdmin, expectedAMR)
+		}
+	}
+
+	login := `{"username": "alice", "password": "alice password"}`
+
+	// without a second factor the admin role does not get the admin scope
+	var passwordLogin AuthResponse
+
+	post("/sumapi/v1/auth", "", login, http.StatusOK, &passwordLogin)
+	checkClaims(passwordLogin.Token, false, amrPassword)
+
+	if strings.Join(passwordLogin.ScopesRequiringMFA, " ") != scopeAdmin {
+		t.Fatalf("auth response scopes requiring mfa: %v, want the admin scope", passwordLogin.ScopesRequiringMFA)
+	}
+
+	// nor can the password enroll one for the admin role, an operator enrolls such users
+	post("/sumapi/v1/users/me/mfa/totp", passwordLogin.Token, "", http.StatusForbidden, nil)
+	post("/sumapi/v1/users/me/mfa/totp/confirm", passwordLogin.Token, `{"code": "000000"}`, http.StatusForbidden, nil)
+
+	// users without the admin role enroll themselves
+	if err := userStoreSrv.SetRoles("alice", []string{"user"}); err != nil {
+		t.Fatalf("Could not set the roles: %v", err)
+	}
+
+	var enrollment TOTPEnrollmentResponse
+
+	post("/sumapi/v1/users/me/mfa/totp", passwordLogin.Token, "", http.StatusOK, &enrollment)
+
+	if !strings.HasPrefix(enrollment.OTPAuthURI, "otpauth://totp/sumapi:alice?") || !strings.Contains(enrollment.OTPAuthURI, "secret="+enrollment.Secret) {
+		t.Fatalf("enrollment: %+v, want the otpauth uri of the secret", enrollment)
+	}
+
+	post("/sumapi/v1/users/me/mfa/totp/confirm", passwordLogin.Token, `{"code": "000000"}`, http.StatusUnauthorized, nil)
+
+	var recovery RecoveryCodesResponse
+
+	post("/sumapi/v1/users/me/mfa/totp/confirm", passwordLogin.Token, fmt.Sprintf(`{"code": %q}`, totpCodeAt(t, enrollment.Secret, time.Now())), http.StatusOK, &recovery)
+
+	if len(recovery.RecoveryCodes) == 0 {
+		t.Fatalf("confirm response: %+v, want recovery codes", recovery)
+	}
+
+	post("/sumapi/v1/users/me/mfa/totp", passwordLogin.Token, "", http.StatusConflict, nil)
+
+	if err := userStoreSrv.SetRoles("alice", []string{"user", "admin"}); err != nil {
+		t.Fatalf("Could not set the roles: %v", err)
+	}
+
+	// the password alone only gets a challenge now
+	var challenge AuthResponse
+
+	post("/sumapi/v1/auth", "", login, http.StatusOK, &challenge)
+
+	if !challenge.MFARequired || challenge.MFAToken == "" || challenge.Token != "" || challenge.RefreshToken != "" {
+		t.Fatalf("auth response: %+v, want only an mfa challenge", challenge)
+	}
+
+	post("/sumapi/v1/auth/mfa", "", fmt.Sprintf(`{"mfa_token": %q, "code": "000000"}`, challenge.MFAToken), http.StatusUnauthorized, nil)
+	post("/sumapi/v1/auth/mfa", "", `{"mfa_token": "unknown", "code": "000000"}`, http.StatusUnauthorized, nil)
+	post("/sumapi/v1/auth/mfa", "", fmt.Sprintf(`{"mfa_token": %q}`, challenge.MFAToken), http.StatusBadRequest, nil)
+
+	// the code of the next step, the one of the current step was used to confirm
+	mfaBody := fmt.Sprintf(`{"mfa_token": %q, "code": %q}`, challenge.MFAToken, totpCodeAt(t, enrollment.Secret, time.Now().Add(30*time.Second)))
+
+	// a disabled account neither uses up the challenge nor the code
+	if err := userStoreSrv.SetDisabled("alice", true); err != nil {
+		t.Fatalf("Could not disable the user: %v", err)
+	}
+
+	post("/sumapi/v1/auth/mfa", "", mfaBody, http.StatusUnauthorized, nil)
+
+	if err := userStoreSrv.SetDisabled("alice", false); err != nil {
+		t.Fatalf("Could not enable the user: %v", err)
+	}
+
+	var mfaLogin AuthResponse
+
+	post("/sumapi/v1/auth/mfa", "", mfaBody, http.StatusOK, &mfaLogin)
+	checkClaims(mfaLogin.Token, true, amrPassword, amrOTP, amrMFA)
+
+	if len(mfaLogin.ScopesRequiringMFA) != 0 {
+		t.Fatalf("auth response scopes requiring mfa: %v, want none", mfaLogin.ScopesRequiringMFA)
+	}
+
+	// challenges are single use
+	post("/sumapi/v1/auth/mfa", "", fmt.Sprintf(`{"mfa_token": %q, "recovery_code": %q}`, challenge.MFAToken, recovery.RecoveryCodes[0]), http.StatusUnauthorized, nil)
+
+	var refreshed AuthResponse
+
+	post("/sumapi/v1/auth/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, mfaLogin.RefreshToken), http.StatusOK, &refreshed)
+	checkClaims(refreshed.Token, true, amrPassword, amrOTP, amrMFA)
+
+	post("/sumapi/v1/auth", "", login, http.StatusOK, &challenge)
+
+	var recoveryLogin AuthResponse
+
+	post("/sumapi/v1/auth/mfa", "", fmt.Sprintf(`{"mfa_token": %q, "recovery_code": %q}`, challenge.MFAToken, recovery.RecoveryCodes[0]), http.StatusOK, &recoveryLogin)
+	checkClaims(recoveryLogin.Token, true, amrPassword, amrOTP, amrMFA)
+}
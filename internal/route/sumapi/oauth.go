@@ -0,0 +1,147 @@
+package sumapi
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/spf13/viper"
+)
+
+const grantTypeClientCredentials = "client_credentials"
+
+// TokenResponse is the RFC 6749 access token response of the token endpoint.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    uint32 `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// IssuedTokenType is only set by the token exchange grant
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// handleToken is the OAuth 2 token endpoint, it takes form encoded requests and picks the grant
+// by grant_type.
+func handleToken(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		ctx,
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		ctx,
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		log.Printf("failed to parse form: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	// token responses must not be cached
+	respWriter.Header().Set("Cache-Control", "no-store")
+
+	switch grantType := request.PostForm.Get("grant_type"); grantType {
+	case grantTypeClientCredentials:
+		handleClientCredentials(respWriter, request, tokenHelperSrv, clientStoreSrv)
+	case grantTypeAuthorizationCode:
+		handleAuthorizationCode(respWriter, request, tokenHelperSrv, clientStoreSrv)
+	case grantTypeDeviceCode:
+		handleDeviceCode(respWriter, request, tokenHelperSrv, clientStoreSrv)
+	case grantTypeTokenExchange:
+		handleTokenExchange(respWriter, request, tokenHelperSrv, clientStoreSrv)
+	default:
+		log.Printf("unsupported grant type: %q", grantType)
+		common.WriteError(respWriter, http.StatusBadRequest, "UNSUPPORTED_GRANT_TYPE", "grant_type is not supported")
+	}
+}
+
+// handleClientCredentials issues a token to the client itself, with the client as subject and azp.
+// The requested scope and audience must be allowed for the client, without a scope the token gets
+// every allowed scope and without an audience the first allowed audience.
+func handleClientCredentials(respWriter http.ResponseWriter, request *http.Request, tokenHelperSrv tokenhelper.Service, clientStoreSrv clientstore.Service) {
+	client, ok := authenticateClient(respWriter, request, clientStoreSrv)
+	if !ok {
+		return
+	}
+
+	if !client.AllowsGrant(grantTypeClientCredentials) {
+		log.Printf("client: %q may not use the client credentials grant", client.ID)
+		common.WriteError(respWriter, http.StatusBadRequest, "UNAUTHORIZED_CLIENT", "client may not use this grant_type")
+
+		return
+	}
+
+	scopes := strings.Fields(request.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	for _, scope := range scopes {
+		if !client.AllowsScope(scope) {
+			log.Printf("client: %q requested scope: %q", client.ID, scope)
+			common.WriteError(respWriter, http.StatusBadRequest, "INVALID_SCOPE", "scope "+scope+" is not allowed")
+
+			return
+		}
+	}
+
+	audience := request.PostForm.Get("audience")
+	if audience == "" && len(client.Audiences) > 0 {
+		audience = client.Audiences[0]
+	}
+
+	if !client.AllowsAudience(audience) {
+		log.Printf("client: %q requested audience: %q", client.ID, audience)
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_TARGET", "audience is not allowed")
+
+		return
+	}
+
+	token, err := tokenHelperSrv.GenToken(
+		request.Context(),
+		client.ID,
+		append([]tokenhelper.Option{
+			tokenhelper.WithScope(scopes...),
+			tokenhelper.WithAudience(audience),
+			tokenhelper.WithAuthorizedParty(client.ID),
+		}, certificateBinding(request.Context())...)...,
+	)
+	if err != nil {
+		log.Printf("failed to generate token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   uint32(viper.GetDuration(constant.TokenExpiresIn) / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
@@ -0,0 +1,179 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/tokenhelper"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+)
+
+// testClientStore knows the batch client, allowed the client credentials grant, and the gateway
+// client, which is not.
+func testClientStore(t *testing.T) *clientstore.ClientStoreClientImplMock {
+	t.Helper()
+
+	clients := map[string]clientstore.Client{
+		"batch": {
+			ID:         "batch",
+			GrantTypes: []string{grantTypeClientCredentials},
+			Scopes:     []string{"sum:write", "documents:read"},
+			Audiences:  []string{"local", "billing"},
+		},
+		"gateway": {ID: "gateway"},
+	}
+
+	return &clientstore.ClientStoreClientImplMock{
+		AuthenticateFn: func(id, secret string) (clientstore.Client, error) {
+			client, ok := clients[id]
+			if !ok || secret != id+" secret" {
+				return clientstore.Client{}, common.InvalidClientError(id)
+			}
+
+			return client, nil
+		},
+	}
+}
+
+func Test_handleClientCredentials(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := golib.WithGoLib(context.Background(), golib.New())
+
+	tests := []struct {
+		name               string
+		form               url.Values
+		basicAuth          []string
+		expectedStatusCode int
+		expectedScope      string
+		expectedAudience   string
+	}{
+		{
+			name:               "clientCredentials-allowedScopes",
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			basicAuth:          []string{"batch", "batch+secret"},
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write documents:read",
+			expectedAudience:   "local",
+		},
+		{
+			name:               "clientCredentials-requestedScope",
+			form:               url.Values{"grant_type": {"client_credentials"}, "scope": {"sum:write"}},
+			basicAuth:          []string{"batch", "batch+secret"},
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write",
+			expectedAudience:   "local",
+		},
+		{
+			name:               "clientCredentials-invalidScope",
+			form:               url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}},
+			basicAuth:          []string{"batch", "batch+secret"},
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "clientCredentials-otherAudience",
+			form:               url.Values{"grant_type": {"client_credentials"}, "audience": {"billing"}},
+			basicAuth:          []string{"batch", "batch+secret"},
+			expectedStatusCode: 200,
+			expectedScope:      "sum:write documents:read",
+			expectedAudience:   "billing",
+		},
+		{
+			name:               "clientCredentials-invalidAudience",
+			form:               url.Values{"grant_type": {"client_credentials"}, "audience": {"payroll"}},
+			basicAuth:          []string{"batch", "batch+secret"},
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "clientCredentials-grantNotAllowed",
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			basicAuth:          []string{"gateway", "gateway+secret"},
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "clientCredentials-badClientSecret",
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			basicAuth:          []string{"batch", "wrong"},
+			expectedStatusCode: 401,
+		},
+		{
+			name:               "clientCredentials-unsupportedGrantType",
+			form:               url.Values{"grant_type": {"password"}},
+			basicAuth:          []string{"batch", "batch+secret"},
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(golib.New()))
+			router.Use(tokenhelper.Inject(newTokenHelper(t)))
+			router.Use(clientstore.Inject(testClientStore(t)))
+
+			InstallRoutes(router)
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/oauth/token", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.SetBasicAuth(tt.basicAuth[0], tt.basicAuth[1])
+
+			response, err := (&http.Client{}).Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			if response.StatusCode != http.StatusOK {
+				return
+			}
+
+			var tokenResponse TokenResponse
+
+			if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if tokenResponse.Scope != tt.expectedScope || tokenResponse.TokenType != "Bearer" {
+				t.Fatalf("token response scope: %q type: %q, want scope: %q", tokenResponse.Scope, tokenResponse.TokenType, tt.expectedScope)
+			}
+
+			claims := &tokenhelper.Claims{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(tokenResponse.AccessToken, claims); err != nil {
+				t.Fatalf("Could not parse the token: %v", err)
+			}
+
+			if claims.Subject != "batch" || claims.AuthorizedParty != "batch" || claims.Audience != tt.expectedAudience {
+				t.Fatalf("token sub: %q azp: %q aud: %q, want the client and audience: %q", claims.Subject, claims.AuthorizedParty, claims.Audience, tt.expectedAudience)
+			}
+		})
+	}
+}
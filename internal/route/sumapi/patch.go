@@ -0,0 +1,317 @@
+package sumapi
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/docstore"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonprovider"
+
+	"github.com/go-chi/chi"
+)
+
+// PatchRequestBody takes exactly one of BaseID or Base and exactly one of JSONPatch or MergePatch.
+type PatchRequestBody struct {
+	BaseID     string                        `json:"base_id,omitempty"`
+	Base       interface{}                   `json:"base,omitempty"`
+	JSONPatch  []jsonprovider.PatchOperation `json:"json_patch,omitempty"`
+	MergePatch interface{}                   `json:"merge_patch,omitempty"`
+}
+
+type PatchResponse struct {
+	SHA256      string `json:"sha256"`
+	Sum         int    `json:"sum"`
+	PreviousSum int    `json:"previous_sum"`
+	Delta       int    `json:"delta"`
+	BaseID      string `json:"base_id,omitempty"`
+	Version     int    `json:"version,omitempty"`
+}
+
+type DocumentResponse struct {
+	ID      string `json:"id"`
+	SHA256  string `json:"sha256"`
+	Sum     int    `json:"sum"`
+	Version int    `json:"version"`
+}
+
+// sumDocument adds up every number in any JSON value the same way handleSum does.
+func sumDocument(jsonProviderSrv jsonprovider.Service, document interface{}) (int, error) {
+	sumResult := 0
+
+	err := jsonProviderSrv.Walk(document, func(pointer string, value interface{}) error {
+		if number, ok := value.(float64); ok {
+			sumResult += int(number)
+		}
+
+		return nil
+	})
+
+	return sumResult, err
+}
+
+// readJSONBody copies the request body and unmarshals it into out, it writes the error response
+// and returns false on failure.
+func readJSONBody(respWriter http.ResponseWriter, request *http.Request, goLibSrv golib.Service, out interface{}) bool {
+	requestBodyBuf := &bytes.Buffer{}
+
+	if _, err := goLibSrv.Copy(requestBodyBuf, request.Body); err != nil {
+		log.Printf("io copy error: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return false
+	}
+
+	if unmarshalErr := goLibSrv.Unmarshal(requestBodyBuf.Bytes(), out); unmarshalErr != nil {
+		log.Printf("failed to unmarshal: %v", unmarshalErr)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return false
+	}
+
+	return true
+}
+
+func handlePutDocument(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var jsonProviderSrv jsonprovider.Service
+
+	if err := jsonprovider.FromContextAs(
+		ctx,
+		&jsonProviderSrv); err != nil {
+		log.Printf("json provider service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var docStoreSrv docstore.Service
+
+	if err := docstore.FromContextAs(
+		ctx,
+		&docStoreSrv); err != nil {
+		log.Printf("doc store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var document interface{}
+
+	if !readJSONBody(respWriter, request, goLibSrv, &document) {
+		return
+	}
+
+	sumResult, err := sumDocument(jsonProviderSrv, document)
+	if err != nil {
+		log.Printf("failed to sum document: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	stored := docStoreSrv.Put(subjectFromContext(ctx), chi.URLParam(request, "id"), document, sumResult)
+
+	writeDocumentResponse(respWriter, stored)
+}
+
+func handleGetDocument(respWriter http.ResponseWriter, request *http.Request) {
+	var docStoreSrv docstore.Service
+
+	if err := docstore.FromContextAs(
+		request.Context(),
+		&docStoreSrv); err != nil {
+		log.Printf("doc store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	stored, err := docStoreSrv.Get(subjectFromContext(request.Context()), chi.URLParam(request, "id"))
+	if err != nil {
+		log.Printf("failed to get document: %v", err)
+		common.WriteError(respWriter, http.StatusNotFound, "NOT_FOUND", "document not found")
+
+		return
+	}
+
+	writeResponse(respWriter, stored)
+}
+
+func handleDeleteDocument(respWriter http.ResponseWriter, request *http.Request) {
+	var docStoreSrv docstore.Service
+
+	if err := docstore.FromContextAs(
+		request.Context(),
+		&docStoreSrv); err != nil {
+		log.Printf("doc store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := docStoreSrv.Delete(subjectFromContext(request.Context()), chi.URLParam(request, "id")); err != nil {
+		log.Printf("failed to delete document: %v", err)
+		common.WriteError(respWriter, http.StatusNotFound, "NOT_FOUND", "document not found")
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func writeDocumentResponse(respWriter http.ResponseWriter, stored docstore.Document) {
+	hash, err := sha256Hex(strconv.Itoa(stored.Sum))
+	if err != nil {
+		log.Printf("failed to hash sum: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &DocumentResponse{ID: stored.ID, SHA256: hash, Sum: stored.Sum, Version: stored.Version})
+}
+
+// handlePatch patches an inline base or a stored document, stored documents are replaced by the
+// patched result.
+func handlePatch(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var jsonProviderSrv jsonprovider.Service
+
+	if err := jsonprovider.FromContextAs(
+		ctx,
+		&jsonProviderSrv); err != nil {
+		log.Printf("json provider service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var docStoreSrv docstore.Service
+
+	if err := docstore.FromContextAs(
+		ctx,
+		&docStoreSrv); err != nil {
+		log.Printf("doc store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var patchRequestBody PatchRequestBody
+
+	if !readJSONBody(respWriter, request, goLibSrv, &patchRequestBody) {
+		return
+	}
+
+	if (patchRequestBody.BaseID == "") == (patchRequestBody.Base == nil) ||
+		(patchRequestBody.JSONPatch == nil) == (patchRequestBody.MergePatch == nil) {
+		log.Printf("patch request needs one base and one patch")
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "exactly one of base_id or base and one of json_patch or merge_patch is required")
+
+		return
+	}
+
+	applyPatch := func(base interface{}) (interface{}, int, error) {
+		if patchRequestBody.MergePatch != nil {
+			patched := jsonProviderSrv.ApplyMergePatch(base, patchRequestBody.MergePatch)
+			sumResult, err := sumDocument(jsonProviderSrv, patched)
+
+			return patched, sumResult, err
+		}
+
+		patched, err := jsonProviderSrv.ApplyJSONPatch(base, patchRequestBody.JSONPatch)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		sumResult, err := sumDocument(jsonProviderSrv, patched)
+
+		return patched, sumResult, err
+	}
+
+	response := &PatchResponse{BaseID: patchRequestBody.BaseID}
+
+	var err error
+
+	if patchRequestBody.BaseID != "" {
+		var stored docstore.Document
+
+		stored, err = docStoreSrv.Update(subjectFromContext(ctx), patchRequestBody.BaseID, func(current docstore.Document) (interface{}, int, error) {
+			response.PreviousSum = current.Sum
+
+			return applyPatch(current.Document)
+		})
+
+		response.Sum, response.Version = stored.Sum, stored.Version
+	} else {
+		if response.PreviousSum, err = sumDocument(jsonProviderSrv, patchRequestBody.Base); err == nil {
+			_, response.Sum, err = applyPatch(patchRequestBody.Base)
+		}
+	}
+
+	if err != nil {
+		log.Printf("failed to patch document: %v", err)
+		writePatchError(respWriter, err)
+
+		return
+	}
+
+	response.Delta = response.Sum - response.PreviousSum
+
+	if response.SHA256, err = sha256Hex(strconv.Itoa(response.Sum)); err != nil {
+		log.Printf("failed to hash sum: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, response)
+}
+
+func writePatchError(respWriter http.ResponseWriter, err error) {
+	var (
+		invalidPatchErr common.InvalidPatchError
+		patchErr        common.PatchError
+		notFoundErr     common.DocumentNotFoundError
+	)
+
+	switch {
+	case errors.As(err, &invalidPatchErr):
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_PATCH", invalidPatchErr.Error())
+	case errors.As(err, &patchErr):
+		common.WriteError(respWriter, http.StatusUnprocessableEntity, "PATCH_FAILED", patchErr.Error())
+	case errors.As(err, &notFoundErr):
+		common.WriteError(respWriter, http.StatusNotFound, "NOT_FOUND", notFoundErr.Error())
+	default:
+		common.WriteInternalError(respWriter)
+	}
+}
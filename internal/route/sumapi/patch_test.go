@@ -0,0 +1,141 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-wai-wong/internal/docstore"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonprovider"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_handlePatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	client := &http.Client{}
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedSum        int
+		expectedDelta      int
+	}{
+		{
+			name:               "handlePatch-inlineJSONPatch",
+			body:               `{"base": {"a": [1, 2]}, "json_patch": [{"op": "add", "path": "/a/-", "value": 7}]}`,
+			expectedStatusCode: 200,
+			expectedSum:        10,
+			expectedDelta:      7,
+		},
+		{
+			name:               "handlePatch-inlineMergePatch",
+			body:               `{"base": {"a": 1, "b": 2}, "merge_patch": {"b": null, "c": {"d": 5}}}`,
+			expectedStatusCode: 200,
+			expectedSum:        6,
+			expectedDelta:      3,
+		},
+		{
+			name:               "handlePatch-storedBase",
+			body:               `{"base_id": "doc1", "json_patch": [{"op": "replace", "path": "/total", "value": 4}]}`,
+			expectedStatusCode: 200,
+			expectedSum:        4,
+			expectedDelta:      -6,
+		},
+		{
+			name:               "handlePatch-failedTestOp",
+			body:               `{"base": {"a": 1}, "json_patch": [{"op": "test", "path": "/a", "value": 2}]}`,
+			expectedStatusCode: 422,
+		},
+		{
+			name:               "handlePatch-missingStoredBase",
+			body:               `{"base_id": "missing", "merge_patch": {"a": 1}}`,
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "handlePatch-storedBaseOfOtherSubject",
+			body:               `{"base_id": "doc2", "merge_patch": {"a": 1}}`,
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "handlePatch-missingValue",
+			body:               `{"base": {"a": 1}, "json_patch": [{"op": "add", "path": "/b"}]}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "handlePatch-twoPatches",
+			body:               `{"base": {}, "merge_patch": {"a": 1}, "json_patch": []}`,
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			docStoreSrv := docstore.New()
+			docStoreSrv.Put("alice", "doc1", map[string]interface{}{"total": float64(10)}, 10)
+			docStoreSrv.Put("bob", "doc2", map[string]interface{}{"total": float64(10)}, 10)
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(jsonprovider.Inject(&jsonprovider.JSONProviderClientImplMock{}))
+			router.Use(docstore.Inject(docStoreSrv))
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(respWriter http.ResponseWriter, request *http.Request) {
+					next.ServeHTTP(respWriter, request.WithContext(withSubject(request.Context(), "alice")))
+				})
+			})
+
+			router.Route("/sumapi/v1", func(router chi.Router) {
+				router.Post("/patch", handlePatch)
+			})
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/patch", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			var patchResponse PatchResponse
+
+			if err := json.NewDecoder(response.Body).Decode(&patchResponse); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if patchResponse.Sum != tt.expectedSum || patchResponse.Delta != tt.expectedDelta {
+				t.Fatalf("response: %+v does not match expected sum: %v and delta: %v", patchResponse, tt.expectedSum, tt.expectedDelta)
+			}
+
+			if tt.expectedStatusCode == http.StatusOK && patchResponse.BaseID != "" {
+				stored, err := docStoreSrv.Get("alice", patchResponse.BaseID)
+				if err != nil || stored.Sum != tt.expectedSum || stored.Version != 2 {
+					t.Fatalf("stored document: %+v was not updated, err: %v", stored, err)
+				}
+			}
+		})
+	}
+}
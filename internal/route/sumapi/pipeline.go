@@ -0,0 +1,92 @@
+package sumapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/pipeline"
+)
+
+type PipelineSumRequestBody struct {
+	Document interface{}   `json:"document"`
+	Pipeline pipeline.Spec `json:"pipeline"`
+}
+
+type PipelineSumResponse struct {
+	SHA256 string  `json:"sha256"`
+	Result float64 `json:"result"`
+	Count  int     `json:"count"`
+}
+
+// handlePipelineSum runs the pipeline from the request body over its document, the body has
+// already been read by handleSum.
+func handlePipelineSum(respWriter http.ResponseWriter, request *http.Request, goLibSrv golib.Service, body []byte) {
+	var pipelineSrv pipeline.Service
+
+	if err := pipeline.FromContextAs(
+		request.Context(),
+		&pipelineSrv); err != nil {
+		log.Printf("pipeline service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var pipelineRequestBody PipelineSumRequestBody
+
+	if unmarshalErr := goLibSrv.Unmarshal(body, &pipelineRequestBody); unmarshalErr != nil {
+		log.Printf("failed to unmarshal: %v", unmarshalErr)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	if !validateSumSchema(respWriter, request, pipelineRequestBody.Document) {
+		return
+	}
+
+	result, err := pipelineSrv.Run(pipelineRequestBody.Document, pipelineRequestBody.Pipeline)
+	if err != nil {
+		log.Printf("failed to run pipeline: %v", err)
+		writePipelineError(respWriter, err)
+
+		return
+	}
+
+	hash, err := sha256Hex(strconv.FormatFloat(result.Value, 'f', -1, 64))
+	if err != nil {
+		log.Printf("failed to hash result: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &PipelineSumResponse{
+		SHA256: hash,
+		Result: result.Value,
+		Count:  result.Count,
+	})
+}
+
+func writePipelineError(respWriter http.ResponseWriter, err error) {
+	var (
+		pipelineErr   common.PipelineError
+		expressionErr common.ExpressionError
+		limitErr      common.EvaluationLimitError
+	)
+
+	switch {
+	case errors.As(err, &pipelineErr):
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_PIPELINE", pipelineErr.Error())
+	case errors.As(err, &limitErr):
+		common.WriteError(respWriter, http.StatusUnprocessableEntity, "PIPELINE_LIMIT_EXCEEDED", limitErr.Error())
+	case errors.As(err, &expressionErr):
+		common.WriteError(respWriter, http.StatusUnprocessableEntity, "PIPELINE_EVALUATION_FAILED", expressionErr.Error())
+	default:
+		common.WriteInternalError(respWriter)
+	}
+}
@@ -0,0 +1,102 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonprovider"
+	"go-wai-wong/internal/provider/pipeline"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_handlePipelineSum(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	client := &http.Client{}
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedResult     float64
+	}{
+		{
+			name: "handlePipelineSum-successfulResponse",
+			body: `{
+				"document": {"prices": [10, -5, 20], "other": [1000]},
+				"pipeline": {"steps": [{"select": "$.prices"}, {"map": "x * 1.2"}, {"filter": "x >= 0"}, {"reduce": "sum"}]}
+			}`,
+			expectedStatusCode: 200,
+			expectedResult:     36,
+		},
+		{
+			name:               "handlePipelineSum-invalidPipeline",
+			body:               `{"document": [1], "pipeline": {"steps": [{"map": "x +"}]}}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "handlePipelineSum-evaluationFailed",
+			body:               `{"document": [1], "pipeline": {"steps": [{"map": "1 / (x - 1)"}]}}`,
+			expectedStatusCode: 422,
+		},
+		{
+			name:               "handlePipelineSum-badJSON",
+			body:               `{"document": [1], "pipeline": {"steps": "sum"}}`,
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(jsonprovider.Inject(&jsonprovider.JSONProviderClientImplMock{}))
+			router.Use(pipeline.Inject(&pipeline.PipelineClientImplMock{}))
+
+			router.Route("/sumapi/v1", func(router chi.Router) {
+				router.Post("/sum", handleSum)
+			})
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/sum?mode=pipeline", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			var pipelineResponse PipelineSumResponse
+
+			if err := json.NewDecoder(response.Body).Decode(&pipelineResponse); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if pipelineResponse.Result != tt.expectedResult {
+				t.Fatalf("response result: %v does not match expected result: %v", pipelineResponse.Result, tt.expectedResult)
+			}
+		})
+	}
+}
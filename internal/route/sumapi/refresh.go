@@ -0,0 +1,246 @@
+package sumapi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/spf13/viper"
+)
+
+const opaqueTokenBytes = 32
+
+type RefreshRequestBody struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newOpaqueToken returns a random url safe token.
+func newOpaqueToken() (string, error) {
+	tokenBytes := make([]byte, opaqueTokenBytes)
+
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// issueRefreshToken stores a new refresh token for subject that expires from now, an empty family
+// starts a new family. amr are the methods of the login the family started with, a certificateThumbprint binds the
+// token to the client certificate of the login.
+func issueRefreshToken(
+	refreshStoreSrv refreshstore.Service,
+	now time.Time,
+	subject, family string,
+	tokenVersion int,
+	amr []string,
+	certificateThumbprint string,
+) (string, error) {
+	if family == "" {
+		var err error
+
+		if family, err = newOpaqueToken(); err != nil {
+			return "", err
+		}
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	refreshTokenHash, err := sha256Hex(refreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	if err := refreshStoreSrv.Save(refreshTokenHash, refreshstore.Record{
+		Family:                family,
+		Subject:               subject,
+		ExpiresAt:             now.Add(viper.GetDuration(constant.TokenRefreshExpiresIn)),
+		TokenVersion:          tokenVersion,
+		AMR:                   amr,
+		CertificateThumbprint: certificateThumbprint,
+	}); err != nil {
+		return "", fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+// handleRefresh swaps a refresh token for a new token and refresh token. A refresh token can only
+// be used once, using it again means it leaked so its whole family is revoked.
+func handleRefresh(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		ctx,
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var refreshStoreSrv refreshstore.Service
+
+	if err := refreshstore.FromContextAs(
+		ctx,
+		&refreshStoreSrv); err != nil {
+		log.Printf("refresh store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var refreshRequestBody RefreshRequestBody
+
+	if !readJSONBody(respWriter, request, goLibSrv, &refreshRequestBody) {
+		return
+	}
+
+	if refreshRequestBody.RefreshToken == "" {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "refresh_token is required")
+
+		return
+	}
+
+	refreshTokenHash, err := sha256Hex(refreshRequestBody.RefreshToken)
+	if err != nil {
+		log.Printf("failed to hash refresh token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	record, err := refreshStoreSrv.Use(refreshTokenHash)
+	if err != nil {
+		writeGrantError(respWriter, err)
+
+		return
+	}
+
+	if record.Used {
+		log.Printf("refresh token reused, revoking family of subject: %q", record.Subject)
+
+		if err := refreshStoreSrv.RevokeFamily(record.Family); err != nil {
+			log.Printf("failed to revoke refresh token family: %v", err)
+			common.WriteInternalError(respWriter)
+
+			return
+		}
+
+		writeGrantError(respWriter, common.InvalidGrantError("refresh token reused"))
+
+		return
+	}
+
+	revoked, err := refreshStoreSrv.FamilyRevoked(record.Family)
+	if err != nil {
+		log.Printf("failed to check refresh token family: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if revoked {
+		writeGrantError(respWriter, common.InvalidGrantError("refresh token revoked"))
+
+		return
+	}
+
+	if goLibSrv.Now().After(record.ExpiresAt) {
+		writeGrantError(respWriter, common.InvalidGrantError("refresh token expired"))
+
+		return
+	}
+
+	if record.CertificateThumbprint != "" && record.CertificateThumbprint != certificateThumbprint(ctx) {
+		writeGrantError(respWriter, common.InvalidGrantError("refresh token is bound to another client certificate"))
+
+		return
+	}
+
+	user, err := userStoreSrv.Get(record.Subject)
+	if err != nil || user.Disabled {
+		writeGrantError(respWriter, common.InvalidGrantError("user not found or disabled"))
+
+		return
+	}
+
+	if record.TokenVersion != user.TokenVersion {
+		writeGrantError(respWriter, common.InvalidGrantError("password changed since login"))
+
+		return
+	}
+
+	token, err := tokenHelperSrv.GenToken(ctx, record.Subject, append(userTokenOptions(user, record.AMR), certificateBinding(ctx)...)...)
+	if err != nil {
+		log.Printf("failed to generate token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	refreshToken, err := issueRefreshToken(refreshStoreSrv, goLibSrv.Now(), record.Subject, record.Family, record.TokenVersion, record.AMR, record.CertificateThumbprint)
+	if err != nil {
+		log.Printf("failed to issue refresh token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &AuthResponse{
+		Token:        token,
+		ExpiresIn:    uint32(viper.GetDuration(constant.TokenExpiresIn) / time.Second),
+		RefreshToken: refreshToken,
+	})
+}
+
+func writeGrantError(respWriter http.ResponseWriter, err error) {
+	log.Printf("invalid grant: %v", err)
+
+	var invalidGrantErr common.InvalidGrantError
+	if errors.As(err, &invalidGrantErr) {
+		common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_GRANT", string(invalidGrantErr))
+
+		return
+	}
+
+	common.WriteInternalError(respWriter)
+}
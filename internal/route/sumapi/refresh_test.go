@@ -0,0 +1,185 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/provider/jsonprovider"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/revocationstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+)
+
+func postAuth(t *testing.T, ctx context.Context, url, body string) (int, AuthResponse) {
+	t.Helper()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	defer response.Body.Close()
+
+	var authResponse AuthResponse
+
+	if response.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(response.Body).Decode(&authResponse); err != nil {
+			t.Fatalf("Could not decode the response: %v", err)
+		}
+	}
+
+	return response.StatusCode, authResponse
+}
+
+func newAuthServer(t *testing.T, refreshStoreSrv refreshstore.Service) *httptest.Server {
+	t.Helper()
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t)))
+	router.Use(jsonprovider.Inject(jsonprovider.New()))
+	router.Use(refreshstore.Inject(refreshStoreSrv))
+	router.Use(revocationstore.Inject(revocationstore.New()))
+	router.Use(userstore.Inject(testUserStore(t)))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(challengestore.Inject(challengestore.New()))
+	router.Use(clientstore.Inject(&clientstore.ClientStoreClientImplMock{
+		GetFn: func(id string) (clientstore.Client, error) {
+			if id != "cli" {
+				return clientstore.Client{}, common.InvalidClientError(id)
+			}
+
+			return clientstore.Client{ID: "cli", Public: true}, nil
+		},
+	}))
+
+	InstallRoutes(router)
+
+	return server
+}
+
+func Test_handleRefreshRotation(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+	server := newAuthServer(t, refreshstore.New())
+
+	statusCode, login := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "test", "password": "test"}`)
+	if statusCode != http.StatusOK || login.RefreshToken == "" {
+		t.Fatalf("Response status code: %v refresh token: %q, want 200 with a refresh token", statusCode, login.RefreshToken)
+	}
+
+	statusCode, rotated := postAuth(t, ctx, server.URL+"/sumapi/v1/auth/refresh", `{"refresh_token": "`+login.RefreshToken+`"}`)
+	if statusCode != http.StatusOK || rotated.Token == "" || rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("Response status code: %v response: %+v, want 200 with a new refresh token", statusCode, rotated)
+	}
+
+	// using the rotated token again revokes the family, including the token it was rotated to
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/auth/refresh", `{"refresh_token": "`+login.RefreshToken+`"}`); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusUnauthorized)
+	}
+
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/auth/refresh", `{"refresh_token": "`+rotated.RefreshToken+`"}`); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusUnauthorized)
+	}
+}
+
+func Test_handleRefresh(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name               string
+		body               string
+		refreshStoreMock   *refreshstore.RefreshStoreClientImplMock
+		expectedStatusCode int
+	}{
+		{
+			name:               "handleRefresh-missingRefreshToken",
+			body:               `{}`,
+			refreshStoreMock:   &refreshstore.RefreshStoreClientImplMock{},
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "handleRefresh-unknownRefreshToken",
+			body:               `{"refresh_token": "unknown"}`,
+			refreshStoreMock:   &refreshstore.RefreshStoreClientImplMock{},
+			expectedStatusCode: 401,
+		},
+		{
+			name: "handleRefresh-expiredRefreshToken",
+			body: `{"refresh_token": "expired"}`,
+			refreshStoreMock: &refreshstore.RefreshStoreClientImplMock{
+				UseFn: func(tokenHash string) (refreshstore.Record, error) {
+					return refreshstore.Record{Family: "family", Subject: "test", ExpiresAt: time.Now().Add(-time.Minute)}, nil
+				},
+			},
+			expectedStatusCode: 401,
+		},
+		{
+			name: "handleRefresh-revokedFamily",
+			body: `{"refresh_token": "revoked"}`,
+			refreshStoreMock: &refreshstore.RefreshStoreClientImplMock{
+				UseFn: func(tokenHash string) (refreshstore.Record, error) {
+					return refreshstore.Record{Family: "family", Subject: "test", ExpiresAt: time.Now().Add(time.Hour)}, nil
+				},
+				FamilyRevokedFn: func(family string) (bool, error) {
+					return true, nil
+				},
+			},
+			expectedStatusCode: 401,
+		},
+		{
+			name: "handleRefresh-validRefreshToken",
+			body: `{"refresh_token": "valid"}`,
+			refreshStoreMock: &refreshstore.RefreshStoreClientImplMock{
+				UseFn: func(tokenHash string) (refreshstore.Record, error) {
+					return refreshstore.Record{Family: "family", Subject: "test", ExpiresAt: time.Now().Add(time.Hour)}, nil
+				},
+			},
+			expectedStatusCode: 200,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t, tt.refreshStoreMock)
+
+			statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/auth/refresh", tt.body)
+			if statusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, tt.expectedStatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package sumapi
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+)
+
+// revokeRefreshToken revokes the family of a refresh token, unknown tokens are ignored.
+func revokeRefreshToken(refreshStoreSrv refreshstore.Service, refreshToken string) error {
+	refreshTokenHash, err := sha256Hex(refreshToken)
+	if err != nil {
+		return err
+	}
+
+	record, err := refreshStoreSrv.Use(refreshTokenHash)
+	if err != nil {
+		var invalidGrantErr common.InvalidGrantError
+		if errors.As(err, &invalidGrantErr) {
+			return nil
+		}
+
+		return err
+	}
+
+	return refreshStoreSrv.RevokeFamily(record.Family)
+}
+
+// handleRevoke is RFC 7009 token revocation for OAuth clients. Confidential clients authenticate
+// like for introspection and public clients send their client_id. A client only revokes the tokens
+// issued to it, refresh tokens are only issued by the login of /auth and never to a client. Invalid
+// tokens and tokens of others are left alone without an error, so the response is always 200 for a
+// known client unless the stores fail.
+func handleRevoke(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		ctx,
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		ctx,
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		log.Printf("failed to parse form: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+		return
+	}
+
+	client, ok := identifyClient(respWriter, request, clientStoreSrv)
+	if !ok {
+		return
+	}
+
+	token := request.PostForm.Get("token")
+	if token == "" {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "token is required")
+
+		return
+	}
+
+	// the revoking client is not always the holder of a bound token, the azp check is what matters
+	claims, err := tokenHelperSrv.VerifyToken(tokenhelper.WithoutCertificateBinding(ctx), token)
+	if err != nil {
+		log.Printf("not a revocable token: %v", err)
+		respWriter.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	if claims.AuthorizedParty != client.ID {
+		log.Printf("client: %q tried to revoke a token issued to: %q", client.ID, claims.AuthorizedParty)
+		respWriter.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	if err := tokenHelperSrv.Revoke(ctx, token); err != nil {
+		log.Printf("failed to revoke token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusOK)
+}
+
+// handleLogout revokes the bearer token of the request and, when the body has one, the family of
+// the refresh token.
+func handleLogout(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var tokenHelperSrv tokenhelper.Service
+
+	if err := tokenhelper.FromContextAs(
+		ctx,
+		&tokenHelperSrv); err != nil {
+		log.Printf("token helper service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var refreshStoreSrv refreshstore.Service
+
+	if err := refreshstore.FromContextAs(
+		ctx,
+		&refreshStoreSrv); err != nil {
+		log.Printf("refresh store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	requestBodyBuf := &bytes.Buffer{}
+
+	if _, err := goLibSrv.Copy(requestBodyBuf, request.Body); err != nil {
+		log.Printf("io copy error: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var refreshRequestBody RefreshRequestBody
+
+	if requestBodyBuf.Len() > 0 {
+		if unmarshalErr := goLibSrv.Unmarshal(requestBodyBuf.Bytes(), &refreshRequestBody); unmarshalErr != nil {
+			log.Printf("failed to unmarshal: %v", unmarshalErr)
+			common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "")
+
+			return
+		}
+	}
+
+	if err := tokenHelperSrv.Revoke(ctx, strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")); err != nil {
+		log.Printf("failed to revoke token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	if refreshRequestBody.RefreshToken != "" {
+		if err := revokeRefreshToken(refreshStoreSrv, refreshRequestBody.RefreshToken); err != nil {
+			log.Printf("failed to revoke refresh token: %v", err)
+			common.WriteInternalError(respWriter)
+
+			return
+		}
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
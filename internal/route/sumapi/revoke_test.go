@@ -0,0 +1,147 @@
+package sumapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+)
+
+func postRevoke(t *testing.T, ctx context.Context, serverURL string, form url.Values) int {
+	t.Helper()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", serverURL+"/sumapi/v1/auth/revoke", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	defer response.Body.Close()
+
+	return response.StatusCode
+}
+
+func postLogout(t *testing.T, ctx context.Context, serverURL, token, body string) int {
+	t.Helper()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", serverURL+"/sumapi/v1/auth/logout", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		t.Fatalf("Could not make the request: %v", err)
+	}
+
+	defer response.Body.Close()
+
+	return response.StatusCode
+}
+
+func Test_handleRevoke(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+	server := newAuthServer(t, refreshstore.New())
+
+	_, login := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "test", "password": "test"}`)
+
+	// only clients can revoke tokens
+	for _, clientID := range []string{"", "unknown"} {
+		if statusCode := postRevoke(t, ctx, server.URL, url.Values{"client_id": {clientID}, "token": {login.Token}}); statusCode != http.StatusUnauthorized {
+			t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusUnauthorized)
+		}
+	}
+
+	if statusCode := postRevoke(t, ctx, server.URL, url.Values{"client_id": {"cli"}}); statusCode != http.StatusBadRequest {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusBadRequest)
+	}
+
+	// unknown tokens are not an error
+	if statusCode := postRevoke(t, ctx, server.URL, url.Values{"client_id": {"cli"}, "token": {"not-a-token"}}); statusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusOK)
+	}
+
+	tokenCtx := golib.WithGoLib(ctx, golib.New())
+
+	cliToken, err := newTokenHelper(t).GenToken(tokenCtx, "test", tokenhelper.WithAuthorizedParty("cli"))
+	if err != nil {
+		t.Fatalf("Could not generate the token: %v", err)
+	}
+
+	gatewayToken, err := newTokenHelper(t).GenToken(tokenCtx, "test", tokenhelper.WithAuthorizedParty("gateway"))
+	if err != nil {
+		t.Fatalf("Could not generate the token: %v", err)
+	}
+
+	// the tokens of other clients and of the login are left alone
+	for _, token := range []string{gatewayToken, login.Token, login.RefreshToken} {
+		if statusCode := postRevoke(t, ctx, server.URL, url.Values{"client_id": {"cli"}, "token": {token}}); statusCode != http.StatusOK {
+			t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusOK)
+		}
+	}
+
+	for _, token := range []string{gatewayToken, login.Token} {
+		if statusCode := postLogout(t, ctx, server.URL, token, ""); statusCode != http.StatusNoContent {
+			t.Fatalf("Response status code: %v does not match expected status code for a token of another client: %v", statusCode, http.StatusNoContent)
+		}
+	}
+
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/auth/refresh", `{"refresh_token": "`+login.RefreshToken+`"}`); statusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code for a refresh token of the login: %v", statusCode, http.StatusOK)
+	}
+
+	if statusCode := postRevoke(t, ctx, server.URL, url.Values{"client_id": {"cli"}, "token": {cliToken}}); statusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusOK)
+	}
+
+	if statusCode := postLogout(t, ctx, server.URL, cliToken, ""); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code for a revoked token: %v", statusCode, http.StatusUnauthorized)
+	}
+}
+
+func Test_handleLogout(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+	server := newAuthServer(t, refreshstore.New())
+
+	_, login := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "test", "password": "test"}`)
+
+	if statusCode := postLogout(t, ctx, server.URL, login.Token, `{"refresh_token": "`+login.RefreshToken+`"}`); statusCode != http.StatusNoContent {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusNoContent)
+	}
+
+	if statusCode := postLogout(t, ctx, server.URL, login.Token, ""); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code for a revoked token: %v", statusCode, http.StatusUnauthorized)
+	}
+
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/auth/refresh", `{"refresh_token": "`+login.RefreshToken+`"}`); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code for a revoked refresh token: %v", statusCode, http.StatusUnauthorized)
+	}
+
+	_, otherLogin := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "test", "password": "test"}`)
+
+	if statusCode := postLogout(t, ctx, server.URL, otherLogin.Token, `{"refresh_token": `); statusCode != http.StatusBadRequest {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,158 @@
+package sumapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	scopeSumWrite       = "sum:write"
+	scopeDocumentsRead  = "documents:read"
+	scopeDocumentsWrite = "documents:write"
+	scopeAdmin          = "admin"
+
+	// RFC 8176 authentication method references
+	amrPassword = "pwd"
+	amrOTP      = "otp"
+	amrMFA      = "mfa"
+	// amrCertificate is the proof of possession of the key of a client certificate
+	amrCertificate = "swk"
+)
+
+// mfaScopes are the scopes only tokens of a login with a second factor get.
+var mfaScopes = map[string]bool{scopeAdmin: true}
+
+const claimsCtxKey = "0c5e2d8a-47f3-4b61-9a0e-6f1d3c2b8e47"
+
+func withClaims(ctx context.Context, claims *tokenhelper.Claims) context.Context {
+	return context.WithValue(ctx, claimsCtxKey, claims)
+}
+
+func claimsFromContext(ctx context.Context) *tokenhelper.Claims {
+	claims, _ := ctx.Value(claimsCtxKey).(*tokenhelper.Claims)
+
+	return claims
+}
+
+// RequireScope only lets through requests whose token has scope, others get 403
+// INSUFFICIENT_SCOPE with the RFC 6750 error in the WWW-Authenticate header.
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(respWriter http.ResponseWriter, request *http.Request) {
+			claims := claimsFromContext(request.Context())
+			if claims != nil && claims.HasScope(scope) {
+				next.ServeHTTP(respWriter, request)
+
+				return
+			}
+
+			log.Printf("subject: %q does not have scope: %q", subjectFromContext(request.Context()), scope)
+			respWriter.Header().Add("WWW-Authenticate", fmt.Sprintf(
+				`Bearer error="insufficient_scope", error_description="the token needs the %s scope", scope=%q`, scope, scope))
+			common.WriteError(respWriter, http.StatusForbidden, "INSUFFICIENT_SCOPE", "token needs the "+scope+" scope")
+		})
+	}
+}
+
+// rolesOf returns the stored roles of user, or the default roles when it has none. The admin role
+// is only ever stored, it is never granted by the name of a user.
+func rolesOf(user userstore.User) []string {
+	if len(user.Roles) == 0 {
+		return viper.GetStringSlice(constant.AuthzDefaultRoles)
+	}
+
+	return user.Roles
+}
+
+// scopesOf returns the sorted scopes the authz.roles config grants to roles.
+func scopesOf(roles []string) []string {
+	roleScopes := viper.GetStringMapStringSlice(constant.AuthzRoles)
+
+	granted := map[string]bool{}
+	for _, role := range roles {
+		for _, scope := range roleScopes[role] {
+			granted[scope] = true
+		}
+	}
+
+	scopes := make([]string, 0, len(granted))
+	for scope := range granted {
+		scopes = append(scopes, scope)
+	}
+
+	sort.Strings(scopes)
+
+	return scopes
+}
+
+// roleNames returns the roles configured in authz.roles.
+func roleNames() []string {
+	roleScopes := viper.GetStringMapStringSlice(constant.AuthzRoles)
+
+	roles := make([]string, 0, len(roleScopes))
+	for role := range roleScopes {
+		roles = append(roles, role)
+	}
+
+	return roles
+}
+
+// scopesForAMR drops the scopes in mfaScopes from scopes unless amr has a one time code.
+func scopesForAMR(scopes, amr []string) []string {
+	for _, method := range amr {
+		if method == amrOTP {
+			return scopes
+		}
+	}
+
+	allowed := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !mfaScopes[scope] {
+			allowed = append(allowed, scope)
+		}
+	}
+
+	return allowed
+}
+
+// withheldScopes returns the scopes of user that a login with the methods in amr does not get as
+// they need a second factor.
+func withheldScopes(user userstore.User, amr []string) []string {
+	for _, method := range amr {
+		if method == amrOTP {
+			return nil
+		}
+	}
+
+	var withheld []string
+
+	for _, scope := range scopesOf(rolesOf(user)) {
+		if mfaScopes[scope] {
+			withheld = append(withheld, scope)
+		}
+	}
+
+	return withheld
+}
+
+// userTokenOptions are the roles, scope and amr claims of the tokens of user for a login with the
+// methods in amr.
+func userTokenOptions(user userstore.User, amr []string) []tokenhelper.Option {
+	roles := rolesOf(user)
+
+	return []tokenhelper.Option{
+		tokenhelper.WithRoles(roles...),
+		tokenhelper.WithScope(scopesForAMR(scopesOf(roles), amr)...),
+		tokenhelper.WithAMR(amr...),
+	}
+}
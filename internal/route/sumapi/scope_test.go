@@ -0,0 +1,134 @@
+package sumapi
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/userstore"
+)
+
+func Test_scopesOf(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	tests := []struct {
+		name  string
+		user  userstore.User
+		roles []string
+		scope []string
+	}{
+		{
+			name:  "scopesOf-defaultRoles",
+			user:  userstore.User{Username: "alice"},
+			roles: []string{"user"},
+			scope: []string{"documents:read", "documents:write", "sum:write"},
+		},
+		{
+			name:  "scopesOf-admin",
+			user:  userstore.User{Username: "alice", Roles: []string{"admin"}},
+			roles: []string{"admin"},
+			scope: []string{"admin"},
+		},
+		{
+			name:  "scopesOf-adminNameWithoutRole",
+			user:  userstore.User{Username: "admin"},
+			roles: []string{"user"},
+			scope: []string{"documents:read", "documents:write", "sum:write"},
+		},
+		{
+			name:  "scopesOf-unknownRole",
+			user:  userstore.User{Username: "alice", Roles: []string{"nobody"}},
+			roles: []string{"nobody"},
+			scope: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			roles := rolesOf(tt.user)
+			if !reflect.DeepEqual(roles, tt.roles) {
+				t.Fatalf("rolesOf() = %v, want %v", roles, tt.roles)
+			}
+
+			if scope := scopesOf(roles); !reflect.DeepEqual(scope, tt.scope) {
+				t.Fatalf("scopesOf() = %v, want %v", scope, tt.scope)
+			}
+		})
+	}
+}
+
+func Test_RequireScope(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	server := newAuthServer(t, refreshstore.New())
+
+	_, login := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "test", "password": "test"}`)
+
+	tests := []struct {
+		name               string
+		method             string
+		url                string
+		body               string
+		expectedStatusCode int
+		expectedChallenge  string
+	}{
+		{
+			name:               "requireScope-granted",
+			method:             "POST",
+			url:                "/sumapi/v1/sum",
+			body:               `{"a": 1}`,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "requireScope-insufficient",
+			method:             "GET",
+			url:                "/sumapi/v1/admin/schemas",
+			expectedStatusCode: 403,
+			expectedChallenge:  `Bearer error="insufficient_scope", error_description="the token needs the admin scope", scope="admin"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request, err := http.NewRequestWithContext(ctx, tt.method, server.URL+tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			request.Header.Set("Authorization", "Bearer "+login.Token)
+
+			response, err := (&http.Client{}).Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			if challenge := response.Header.Get("WWW-Authenticate"); challenge != tt.expectedChallenge {
+				t.Fatalf("WWW-Authenticate: %q, want %q", challenge, tt.expectedChallenge)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,23 +13,42 @@ import (
 	"time"
 
 	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
 	"go-wai-wong/internal/constant"
 	"go-wai-wong/internal/golib"
 	"go-wai-wong/internal/provider/jsonprovider"
+	"go-wai-wong/internal/provider/jsonschema"
+	"go-wai-wong/internal/refreshstore"
 	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
 
 	"github.com/go-chi/chi"
 	"github.com/spf13/viper"
 )
 
+const (
+	sumModeMerkle   = "merkle"
+	sumModePipeline = "pipeline"
+)
+
+// AuthResponse has the token of a login, or only the mfa_token and its expires_in when the user
+// still has to pass the second factor at /auth/mfa.
 type AuthResponse struct {
-	Token     string `json:"token"`
-	ExpiresIn uint32 `json:"expires_in"`
+	Token        string `json:"token"`
+	ExpiresIn    uint32 `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+	// ScopesRequiringMFA are the scopes of the user the token does not have as the login had no
+	// second factor, users without one have to enroll a TOTP secret to get them
+	ScopesRequiringMFA []string `json:"scopes_requiring_mfa,omitempty"`
 }
 
 type SumResponse struct {
-	SHA256 string `json:"sha256"`
-	Sum    int    `json:"sum"`
+	SHA256 string                    `json:"sha256"`
+	Sum    int                       `json:"sum"`
+	Merkle *jsonprovider.MerkleProof `json:"merkle,omitempty"`
 }
 
 type AuthRequestBody struct {
@@ -37,6 +57,12 @@ type AuthRequestBody struct {
 }
 
 func writeResponse(respWriter http.ResponseWriter, data interface{}) {
+	writeResponseStatus(respWriter, http.StatusOK, data)
+}
+
+// writeResponseStatus marshals data before the status is written, so a marshal error can still be
+// answered with a 500. Once the status is written a failed write can only be logged.
+func writeResponseStatus(respWriter http.ResponseWriter, status int, data interface{}) {
 	responseBytes, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("failed to marshal response: %v", err)
@@ -45,11 +71,10 @@ func writeResponse(respWriter http.ResponseWriter, data interface{}) {
 		return
 	}
 
+	respWriter.WriteHeader(status)
+
 	if _, err := respWriter.Write(responseBytes); err != nil {
 		log.Printf("failed to write response: %v", err)
-		common.WriteInternalError(respWriter)
-
-		return
 	}
 }
 
@@ -78,6 +103,50 @@ func handleAuth(respWriter http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	var refreshStoreSrv refreshstore.Service
+
+	if err := refreshstore.FromContextAs(
+		ctx,
+		&refreshStoreSrv); err != nil {
+		log.Printf("refresh store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var attemptStoreSrv attemptstore.Service
+
+	if err := attemptstore.FromContextAs(
+		ctx,
+		&attemptStoreSrv); err != nil {
+		log.Printf("attempt store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var challengeStoreSrv challengestore.Service
+
+	if err := challengestore.FromContextAs(
+		ctx,
+		&challengeStoreSrv); err != nil {
+		log.Printf("challenge store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
 	requestBodyBuf := &bytes.Buffer{}
 
 	_, err := goLibSrv.Copy(requestBodyBuf, request.Body)
@@ -105,7 +174,59 @@ func handleAuth(respWriter http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	token, err := tokenHelperSrv.GenToken(ctx, authRequestBody.Username)
+	if wait := loginWait(attemptStoreSrv, request, authRequestBody.Username); wait > 0 {
+		log.Printf("login of: %q has to wait: %v", authRequestBody.Username, wait)
+		writeTooManyAttempts(respWriter, wait)
+
+		return
+	}
+
+	user, err := userStoreSrv.Verify(authRequestBody.Username, authRequestBody.Password)
+	if err != nil {
+		log.Printf("failed to verify credentials: %v", err)
+		countFailedLogin(attemptStoreSrv, goLibSrv.Now(), request, authRequestBody.Username, err)
+		writeCredentialsError(respWriter, err)
+
+		return
+	}
+
+	// the failures of users with a second factor are only reset once it passed, otherwise the
+	// password would reset the count of the guessed codes
+	if user.TOTPEnabled {
+		writeMFAChallenge(respWriter, challengeStoreSrv, goLibSrv.Now(), user)
+
+		return
+	}
+
+	loginSucceeded(attemptStoreSrv, request, authRequestBody.Username)
+
+	writeAuthResponse(respWriter, request, tokenHelperSrv, refreshStoreSrv, user, []string{amrPassword})
+}
+
+// writeAuthResponse issues a token and a new refresh token family for a login of user with the
+// methods in amr. Over a connection with a client certificate both are bound to it.
+func writeAuthResponse(
+	respWriter http.ResponseWriter,
+	request *http.Request,
+	tokenHelperSrv tokenhelper.Service,
+	refreshStoreSrv refreshstore.Service,
+	user userstore.User,
+	amr []string,
+) {
+	ctx := request.Context()
+
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		ctx,
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	token, err := tokenHelperSrv.GenToken(ctx, user.Username, append(userTokenOptions(user, amr), certificateBinding(ctx)...)...)
 	if err != nil {
 		log.Printf("failed to generate token: %v", err)
 		common.WriteInternalError(respWriter)
@@ -113,14 +234,43 @@ func handleAuth(respWriter http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	refreshToken, err := issueRefreshToken(refreshStoreSrv, goLibSrv.Now(), user.Username, "", user.TokenVersion, amr, certificateThumbprint(ctx))
+	if err != nil {
+		log.Printf("failed to issue refresh token: %v", err)
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
 	response := &AuthResponse{
-		Token:     token,
-		ExpiresIn: uint32(viper.GetDuration(constant.TokenExpiresIn) / time.Second),
+		Token:              token,
+		ExpiresIn:          uint32(viper.GetDuration(constant.TokenExpiresIn) / time.Second),
+		RefreshToken:       refreshToken,
+		ScopesRequiringMFA: withheldScopes(user, amr),
 	}
 
 	writeResponse(respWriter, response)
 }
 
+func writeCredentialsError(respWriter http.ResponseWriter, err error) {
+	var invalidCredentialsErr common.InvalidCredentialsError
+	if errors.As(err, &invalidCredentialsErr) {
+		respWriter.Header().Add("WWW-Authenticate", "Bearer")
+		common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_CREDENTIALS", "username or password is incorrect")
+
+		return
+	}
+
+	var accountDisabledErr common.AccountDisabledError
+	if errors.As(err, &accountDisabledErr) {
+		common.WriteError(respWriter, http.StatusForbidden, "ACCOUNT_DISABLED", "account is disabled")
+
+		return
+	}
+
+	common.WriteInternalError(respWriter)
+}
+
 func handleSum(respWriter http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
 
@@ -156,6 +306,12 @@ func handleSum(respWriter http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	if request.URL.Query().Get("mode") == sumModePipeline {
+		handlePipelineSum(respWriter, request, goLibSrv, requestBodyBuf.Bytes())
+
+		return
+	}
+
 	var jsonRequestBody map[string]interface{}
 
 	if unmarshalErr := goLibSrv.Unmarshal(requestBodyBuf.Bytes(), &jsonRequestBody); unmarshalErr != nil {
@@ -165,6 +321,10 @@ func handleSum(respWriter http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	if !validateSumSchema(respWriter, request, jsonRequestBody) {
+		return
+	}
+
 	floatSlice := []float64{}
 	jsonProviderSrv.JSONMapToFloatSliceAs(jsonRequestBody, &floatSlice)
 
@@ -173,25 +333,111 @@ func handleSum(respWriter http.ResponseWriter, request *http.Request) {
 		sumResult += int(v)
 	}
 
-	sha256Hash := sha256.New()
-
-	if _, sha256WriteErr := sha256Hash.Write([]byte(strconv.Itoa(sumResult))); sha256WriteErr != nil {
-		log.Printf("failed to write bytes: %v", sha256WriteErr)
+	hash, err := sha256Hex(strconv.Itoa(sumResult))
+	if err != nil {
+		log.Printf("failed to hash sum: %v", err)
 		common.WriteInternalError(respWriter)
 
 		return
 	}
 
-	hash := fmt.Sprintf("%x", sha256Hash.Sum(nil))
-
 	response := &SumResponse{
 		SHA256: hash,
 		Sum:    sumResult,
 	}
 
+	if request.URL.Query().Get("mode") == sumModeMerkle {
+		var merkleProof jsonprovider.MerkleProof
+
+		if merkleErr := jsonProviderSrv.MerkleProofAs(jsonRequestBody, request.URL.Query().Get("pointer"), &merkleProof); merkleErr != nil {
+			log.Printf("failed to build merkle proof: %v", merkleErr)
+			writeJSONPointerError(respWriter, merkleErr)
+
+			return
+		}
+
+		response.Merkle = &merkleProof
+	}
+
 	writeResponse(respWriter, response)
 }
 
+func sha256Hex(value string) (string, error) {
+	sha256Hash := sha256.New()
+
+	if _, sha256WriteErr := sha256Hash.Write([]byte(value)); sha256WriteErr != nil {
+		return "", fmt.Errorf("failed to write bytes: %w", sha256WriteErr)
+	}
+
+	return fmt.Sprintf("%x", sha256Hash.Sum(nil)), nil
+}
+
+// validateSumSchema validates the document against the schema named by the schema query parameter,
+// falling back to the sum.schema config, it writes the error response and returns false on failure.
+func validateSumSchema(respWriter http.ResponseWriter, request *http.Request, document interface{}) bool {
+	schemaName := request.URL.Query().Get("schema")
+	if schemaName == "" {
+		schemaName = viper.GetString(constant.SumSchema)
+	}
+
+	if schemaName == "" {
+		return true
+	}
+
+	var jsonSchemaSrv jsonschema.Service
+
+	if err := jsonschema.FromContextAs(
+		request.Context(),
+		&jsonSchemaSrv); err != nil {
+		log.Printf("json schema service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return false
+	}
+
+	violations, err := jsonSchemaSrv.Validate(schemaName, document)
+	if err != nil {
+		log.Printf("failed to validate against schema: %v", err)
+		common.WriteError(respWriter, http.StatusBadRequest, "UNKNOWN_SCHEMA", err.Error())
+
+		return false
+	}
+
+	if len(violations) > 0 {
+		common.WriteValidationError(respWriter, "SCHEMA_VALIDATION_FAILED", "document does not match schema "+schemaName, violations)
+
+		return false
+	}
+
+	return true
+}
+
+func writeJSONPointerError(respWriter http.ResponseWriter, err error) {
+	var pointerErr common.JSONPointerError
+	if errors.As(err, &pointerErr) {
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_POINTER", pointerErr.Error())
+
+		return
+	}
+
+	common.WriteInternalError(respWriter)
+}
+
+// publicPaths are the paths validateToken lets through without a token.
+var publicPaths = map[string]bool{
+	"/sumapi/v1/auth":                       true,
+	"/sumapi/v1/auth/certificate":           true,
+	"/sumapi/v1/auth/mfa":                   true,
+	"/sumapi/v1/auth/refresh":               true,
+	"/sumapi/v1/auth/revoke":                true,
+	"/sumapi/v1/introspect":                 true,
+	"/sumapi/v1/oauth/token":                true,
+	"/sumapi/v1/oauth/authorize":            true,
+	"/sumapi/v1/oauth/device_authorization": true,
+	"/sumapi/v1/oauth/device":               true,
+	"/sumapi/v1/users":                      true,
+}
+
 func validateToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(respWriter http.ResponseWriter, request *http.Request) {
 		ctx := request.Context()
@@ -210,12 +456,23 @@ func validateToken(next http.Handler) http.Handler {
 		// check that we have a bearer token
 		auth := request.Header.Get("Authorization")
 
-		if request.URL.Path == "/sumapi/v1/auth" {
+		if publicPaths[request.URL.Path] {
 			next.ServeHTTP(respWriter, request)
 
 			return
 		}
 
+		if apiKey, ok := apiKeyOf(request); ok {
+			claims, ok := authenticateAPIKey(respWriter, request, apiKey)
+			if !ok {
+				return
+			}
+
+			next.ServeHTTP(respWriter, request.WithContext(withAPIKey(withClaims(withSubject(ctx, claims.Subject), claims), claims.Id)))
+
+			return
+		}
+
 		if !strings.HasPrefix(auth, "Bearer ") {
 			respWriter.Header().Add("WWW-Authenticate", "Bearer")
 			common.WriteError(respWriter, http.StatusUnauthorized, "UNAUTHORIZED", "")
@@ -224,25 +481,69 @@ func validateToken(next http.Handler) http.Handler {
 		}
 
 		token := strings.TrimPrefix(auth, "Bearer ")
-		_, err := tokenHelperSrv.VerifyToken(ctx, token)
+		claims, err := tokenHelperSrv.VerifyToken(ctx, token)
 		if err != nil {
 			log.Printf("failed to verify token: %v", err)
+			respWriter.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
 			common.WriteError(respWriter, http.StatusUnauthorized, "INVALID_TOKEN", "auth token invalid")
 
 			return
 		}
 
-		next.ServeHTTP(respWriter, request)
+		next.ServeHTTP(respWriter, request.WithContext(withClaims(withSubject(ctx, claims.Subject), claims)))
 	})
 }
 
 func InstallRoutes(r chi.Router) {
+	r.Get("/.well-known/jwks.json", handleJWKS)
+	r.Get("/.well-known/openid-configuration", handleOpenIDConfiguration)
+	r.With(recordClientCertificate, validateToken, RequireScope(scopeOpenID)).Get("/userinfo", handleUserInfo)
 	r.Route("/sumapi/v1", func(router chi.Router) {
 		router.NotFound(func(w http.ResponseWriter, r *http.Request) {
 			common.WriteError(w, http.StatusNotFound, "NOT_FOUND", "not found")
 		})
+		router.Use(recordClientCertificate)
 		router.Use(validateToken)
 		router.Post("/auth", handleAuth)
-		router.Post("/sum", handleSum)
+		router.Post("/auth/certificate", handleCertificateAuth)
+		router.Post("/auth/mfa", handleMFA)
+		router.Post("/auth/refresh", handleRefresh)
+		router.Post("/auth/revoke", handleRevoke)
+		router.With(RequireBearer).Post("/auth/logout", handleLogout)
+		router.Post("/introspect", handleIntrospect)
+		router.Post("/oauth/token", handleToken)
+		router.Get("/oauth/authorize", handleAuthorize)
+		router.Post("/oauth/authorize", handleAuthorizeLogin)
+		router.Post("/oauth/device_authorization", handleDeviceAuthorization)
+		router.Get("/oauth/device", handleDevice)
+		router.Post("/oauth/device", handleDeviceLogin)
+		router.Post("/users", handleRegister)
+		router.With(RequireBearer).Put("/users/me/password", handleChangePassword)
+		router.With(RequireBearer).Post("/users/me/mfa/totp", handleEnrollTOTP)
+		router.With(RequireBearer).Post("/users/me/mfa/totp/confirm", handleConfirmTOTP)
+		router.Route("/apikeys", func(router chi.Router) {
+			router.Use(RequireBearer)
+			router.Get("/", handleListAPIKeys)
+			router.Post("/", handleCreateAPIKey)
+			router.Delete("/{id}", handleRevokeAPIKey)
+		})
+		router.With(RequireScope(scopeSumWrite)).Post("/sum", handleSum)
+		router.With(RequireScope(scopeSumWrite)).Post("/diff", handleDiff)
+		router.With(RequireScope(scopeSumWrite)).Post("/patch", handlePatch)
+		router.With(RequireScope(scopeDocumentsRead)).Get("/documents/{id}", handleGetDocument)
+		router.With(RequireScope(scopeDocumentsWrite)).Put("/documents/{id}", handlePutDocument)
+		router.With(RequireScope(scopeDocumentsWrite)).Delete("/documents/{id}", handleDeleteDocument)
+		router.Route("/admin", func(router chi.Router) {
+			router.Use(RequireScope(scopeAdmin))
+			router.Get("/schemas", handleListSchemas)
+			router.Put("/schemas/{name}", handlePutSchema)
+			router.Delete("/schemas/{name}", handleDeleteSchema)
+			router.Get("/users", handleListUsers)
+			router.Post("/users", handleCreateUser)
+			router.Put("/users/{username}/password", handleSetPassword)
+			router.Put("/users/{username}/disabled", handleSetDisabled)
+			router.Put("/users/{username}/roles", handleSetRoles)
+			router.Put("/users/{username}/profile", handleSetProfile)
+		})
 	})
 }
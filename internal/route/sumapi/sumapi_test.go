@@ -11,11 +11,17 @@ import (
 	"testing"
 	"time"
 
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
 	"go-wai-wong/internal/config"
 	"go-wai-wong/internal/constant"
 	"go-wai-wong/internal/golib"
 	"go-wai-wong/internal/provider/jsonprovider"
+	"go-wai-wong/internal/provider/jsonschema"
+	"go-wai-wong/internal/refreshstore"
 	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
 
 	"github.com/go-chi/chi"
 	"github.com/golang-jwt/jwt"
@@ -36,7 +42,7 @@ func Test_ValidateToken(t *testing.T) {
 
 	client := &http.Client{}
 
-	tokenHelperSrv := tokenhelper.New()
+	tokenHelperSrv := newTokenHelper(t)
 	goLibSrv := golib.New()
 
 	router.Use(golib.Inject(goLibSrv))
@@ -86,7 +92,7 @@ func Test_MissingBearerToken(t *testing.T) {
 
 	client := &http.Client{}
 
-	tokenHelperSrv := tokenhelper.New()
+	tokenHelperSrv := newTokenHelper(t)
 
 	router.Use(tokenhelper.Inject(tokenHelperSrv))
 	router.Use(validateToken)
@@ -128,7 +134,7 @@ func Test_BadSecret(t *testing.T) {
 
 	client := &http.Client{}
 
-	tokenHelperSrv := tokenhelper.New()
+	tokenHelperSrv := newTokenHelper(t)
 
 	router.Use(tokenhelper.Inject(tokenHelperSrv))
 	router.Use(validateToken)
@@ -187,6 +193,7 @@ func Test_handleAuth(t *testing.T) {
 		args               args
 		tokenClientMock    func(t *testing.T) *tokenhelper.TokenClientImplMock
 		goLibMock          func(t *testing.T) *golib.GoLibImplMock
+		userStoreMock      func(t *testing.T) *userstore.UserStoreClientImplMock
 		expectedStatusCode int
 	}{
 		{
@@ -258,7 +265,7 @@ func Test_handleAuth(t *testing.T) {
 				t.Helper()
 
 				return &tokenhelper.TokenClientImplMock{
-					GenTokenFn: func(ctx context.Context, username string) (string, error) {
+					GenTokenFn: func(ctx context.Context, username string, opts ...tokenhelper.Option) (string, error) {
 						return "", fmt.Errorf("token error")
 					},
 				}
@@ -288,6 +295,53 @@ func Test_handleAuth(t *testing.T) {
 				return &golib.GoLibImplMock{}
 			},
 		},
+		{
+			name: "handAuthTest-wrongPassword",
+			args: args{
+				method: "POST",
+				url:    "/sumapi/v1/auth",
+				body:   `{"username": "test", "password": "wrong"}`,
+			},
+			expectedStatusCode: 401,
+			tokenClientMock: func(t *testing.T) *tokenhelper.TokenClientImplMock {
+				t.Helper()
+
+				return &tokenhelper.TokenClientImplMock{}
+			},
+			goLibMock: func(t *testing.T) *golib.GoLibImplMock {
+				t.Helper()
+
+				return &golib.GoLibImplMock{}
+			},
+		},
+		{
+			name: "handAuthTest-accountDisabled",
+			args: args{
+				method: "POST",
+				url:    "/sumapi/v1/auth",
+				body:   `{"username": "test", "password": "test"}`,
+			},
+			expectedStatusCode: 403,
+			tokenClientMock: func(t *testing.T) *tokenhelper.TokenClientImplMock {
+				t.Helper()
+
+				return &tokenhelper.TokenClientImplMock{}
+			},
+			goLibMock: func(t *testing.T) *golib.GoLibImplMock {
+				t.Helper()
+
+				return &golib.GoLibImplMock{}
+			},
+			userStoreMock: func(t *testing.T) *userstore.UserStoreClientImplMock {
+				t.Helper()
+
+				return &userstore.UserStoreClientImplMock{
+					VerifyFn: func(username, password string) (userstore.User, error) {
+						return userstore.User{}, common.AccountDisabledError(username)
+					},
+				}
+			},
+		},
 		{
 			name: "handAuthTest-failedIOCopy",
 			args: args{
@@ -348,6 +402,16 @@ func Test_handleAuth(t *testing.T) {
 
 			router.Use(golib.Inject(tt.goLibMock(t)))
 			router.Use(tokenhelper.Inject(tt.tokenClientMock(t)))
+			router.Use(refreshstore.Inject(refreshstore.New()))
+
+			if tt.userStoreMock != nil {
+				router.Use(userstore.Inject(tt.userStoreMock(t)))
+			} else {
+				router.Use(userstore.Inject(testUserStore(t)))
+			}
+
+			router.Use(attemptstore.Inject(attemptstore.New()))
+			router.Use(challengestore.Inject(challengestore.New()))
 
 			InstallRoutes(router)
 
@@ -372,6 +436,37 @@ func Test_handleAuth(t *testing.T) {
 	}
 }
 
+// newTokenHelper returns the token helper of the test config, the test fails when its keys do
+// not load.
+func newTokenHelper(t *testing.T) tokenhelper.Service {
+	t.Helper()
+
+	tokenHelperSrv, err := tokenhelper.New()
+	if err != nil {
+		t.Fatalf("Could not load the token keys: %v", err)
+	}
+
+	return tokenHelperSrv
+}
+
+// testUserStore accepts the password "test" for any username.
+func testUserStore(t *testing.T) *userstore.UserStoreClientImplMock {
+	t.Helper()
+
+	return &userstore.UserStoreClientImplMock{
+		GetFn: func(username string) (userstore.User, error) {
+			return userstore.User{Username: username}, nil
+		},
+		VerifyFn: func(username, password string) (userstore.User, error) {
+			if password != "test" {
+				return userstore.User{}, common.InvalidCredentialsError(username)
+			}
+
+			return userstore.User{Username: username}, nil
+		},
+	}
+}
+
 func Test_handleSum(t *testing.T) {
 	t.Parallel()
 
@@ -560,3 +655,217 @@ func Test_handleSum(t *testing.T) {
 		})
 	}
 }
+
+func Test_handleSumMerkle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	client := &http.Client{}
+
+	tests := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedRootHash   bool
+	}{
+		{
+			name:               "handleSumMerkle-successfulProof",
+			query:              "?mode=merkle&pointer=/data1",
+			expectedStatusCode: 200,
+			expectedRootHash:   true,
+		},
+		{
+			name:               "handleSumMerkle-noMode",
+			query:              "?pointer=/data1",
+			expectedStatusCode: 200,
+			expectedRootHash:   false,
+		},
+		{
+			name:               "handleSumMerkle-scalarPointer",
+			query:              "?mode=merkle&pointer=/data2/a",
+			expectedStatusCode: 400,
+			expectedRootHash:   false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(jsonprovider.Inject(&jsonprovider.JSONProviderClientImplMock{}))
+
+			router.Route("/sumapi/v1", func(router chi.Router) {
+				router.Post("/sum", handleSum)
+			})
+
+			reader := strings.NewReader(`{"data1": [1,2,3,4], "data2": {"a":6,"b":4}}`)
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/sum"+tt.query, reader)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			var sumResponse SumResponse
+
+			if err := json.NewDecoder(response.Body).Decode(&sumResponse); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if (sumResponse.Merkle != nil) != tt.expectedRootHash {
+				t.Fatalf("response merkle proof: %v, expected proof: %v", sumResponse.Merkle, tt.expectedRootHash)
+			}
+
+			if tt.expectedRootHash && !jsonprovider.VerifyMerkleProof(*sumResponse.Merkle) {
+				t.Fatalf("response merkle proof does not verify: %v", sumResponse.Merkle)
+			}
+		})
+	}
+}
+
+func Test_handleSumSchema(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	client := &http.Client{}
+
+	jsonSchemaSrv := jsonschema.New()
+
+	if err := jsonSchemaSrv.Register("numbers", map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "number"}},
+	}); err != nil {
+		t.Fatalf("Could not register schema: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		body               string
+		expectedStatusCode int
+		expectedViolations int
+	}{
+		{
+			name:               "handleSumSchema-valid",
+			query:              "?schema=numbers",
+			body:               `{"data1": [1,2,3,4]}`,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "handleSumSchema-violations",
+			query:              "?schema=numbers",
+			body:               `{"data1": [1,"2",3], "data2": {"a": 1}}`,
+			expectedStatusCode: 422,
+			expectedViolations: 2,
+		},
+		{
+			name:               "handleSumSchema-unknownSchema",
+			query:              "?schema=missing",
+			body:               `{"data1": [1,2,3,4]}`,
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(jsonprovider.Inject(&jsonprovider.JSONProviderClientImplMock{}))
+			router.Use(jsonschema.Inject(jsonSchemaSrv))
+
+			router.Route("/sumapi/v1", func(router chi.Router) {
+				router.Post("/sum", handleSum)
+			})
+
+			request, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/sumapi/v1/sum"+tt.query, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			var errorResponse struct {
+				Violations []jsonschema.Violation `json:"violations"`
+			}
+
+			if err := json.NewDecoder(response.Body).Decode(&errorResponse); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if len(errorResponse.Violations) != tt.expectedViolations {
+				t.Fatalf("response violations: %v, expected %v violations", errorResponse.Violations, tt.expectedViolations)
+			}
+		})
+	}
+}
+
+func Test_writeResponseStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name               string
+		data               interface{}
+		expectedStatusCode int
+	}{
+		{
+			name:               "writeResponseStatus-created",
+			data:               map[string]string{"id": "1"},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "writeResponseStatus-marshalError",
+			data:               make(chan int),
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+
+			writeResponseStatus(recorder, http.StatusCreated, tt.data)
+
+			if recorder.Code != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", recorder.Code, tt.expectedStatusCode)
+			}
+		})
+	}
+}
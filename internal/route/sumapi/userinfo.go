@@ -0,0 +1,99 @@
+package sumapi
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+)
+
+// UserInfoResponse is the OpenID Connect userinfo response with the profile of the user.
+type UserInfoResponse struct {
+	Subject string   `json:"sub"`
+	Name    string   `json:"name,omitempty"`
+	Email   string   `json:"email,omitempty"`
+	Tenant  string   `json:"tenant,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+// handleUserInfo returns the current profile of the subject of the bearer token, tokens of clients
+// have no profile and get a 404. It is mounted behind RequireScope for the openid scope.
+func handleUserInfo(respWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		ctx,
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	user, err := userStoreSrv.Get(subjectFromContext(ctx))
+	if err != nil {
+		log.Printf("failed to get user info: %v", err)
+		writeUserStoreError(respWriter, err)
+
+		return
+	}
+
+	if user.Disabled {
+		writeCredentialsError(respWriter, common.AccountDisabledError(user.Username))
+
+		return
+	}
+
+	respWriter.Header().Set("Cache-Control", "no-store")
+
+	writeResponse(respWriter, &UserInfoResponse{
+		Subject: user.Username,
+		Name:    user.Name,
+		Email:   user.Email,
+		Tenant:  user.Tenant,
+		Roles:   rolesOf(user),
+	})
+}
+
+// handleSetProfile sets the name, email and tenant of a user, the email must be a bare address.
+func handleSetProfile(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var profile userstore.Profile
+
+	if !readUserBody(respWriter, request, &profile) {
+		return
+	}
+
+	if profile.Email != "" {
+		if address, err := mail.ParseAddress(profile.Email); err != nil || address.Address != profile.Email {
+			common.WriteError(respWriter, http.StatusBadRequest, "INVALID_EMAIL", "email is not a valid address")
+
+			return
+		}
+	}
+
+	if err := userStoreSrv.SetProfile(chi.URLParam(request, "username"), profile); err != nil {
+		log.Printf("failed to set profile: %v", err)
+		writeUserStoreError(respWriter, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package sumapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+)
+
+func Test_handleUserInfo(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		t.Fatalf("Could not create the user store: %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "alice password"); err != nil {
+		t.Fatalf("Could not create the user: %v", err)
+	}
+
+	if err := userStoreSrv.SetProfile("alice", userstore.Profile{Name: "Alice", Email: "alice@example.com", Tenant: "acme"}); err != nil {
+		t.Fatalf("Could not set the profile: %v", err)
+	}
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t).WithClaimsBuilder(tokenhelper.UserProfileClaims)))
+	router.Use(refreshstore.Inject(refreshstore.New()))
+	router.Use(userstore.Inject(userStoreSrv))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(challengestore.Inject(challengestore.New()))
+
+	InstallRoutes(router)
+
+	_, login := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "alice", "password": "alice password"}`)
+
+	claims := &tokenhelper.Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(login.Token, claims); err != nil {
+		t.Fatalf("Could not parse the token: %v", err)
+	}
+
+	if claims.Name != "Alice" || claims.Email != "alice@example.com" || claims.Tenant != "acme" {
+		t.Fatalf("token claims: %+v, want the profile of alice", claims)
+	}
+
+	openIDToken, err := newTokenHelper(t).GenToken(golib.WithGoLib(ctx, golib.New()), "alice", tokenhelper.WithScope(scopeOpenID))
+	if err != nil {
+		t.Fatalf("Could not generate the token: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		token              string
+		expectedStatusCode int
+	}{
+		{
+			name:               "handleUserInfo-profile",
+			token:              openIDToken,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "handleUserInfo-noOpenIDScope",
+			token:              login.Token,
+			expectedStatusCode: 403,
+		},
+		{
+			name:               "handleUserInfo-noToken",
+			expectedStatusCode: 401,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/userinfo", http.NoBody)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			response, err := (&http.Client{}).Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+
+			if response.StatusCode != http.StatusOK {
+				return
+			}
+
+			var userInfo UserInfoResponse
+
+			if err := json.NewDecoder(response.Body).Decode(&userInfo); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if userInfo.Subject != "alice" || userInfo.Email != "alice@example.com" || userInfo.Tenant != "acme" {
+				t.Fatalf("userinfo: %+v, want the profile of alice", userInfo)
+			}
+		})
+	}
+}
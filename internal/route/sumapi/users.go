@@ -0,0 +1,346 @@
+package sumapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	usernameMinLength = 3
+	usernameMaxLength = 64
+)
+
+// usernamePattern allows letters, digits, dots, underscores and dashes, starting with a letter or
+// digit.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// reservedUsernames cannot be registered, in any case, as they pass for the service or its operators.
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"root":          true,
+	"system":        true,
+	"sumapi":        true,
+	"me":            true,
+}
+
+type UserRequestBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type PasswordRequestBody struct {
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequestBody struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type DisabledRequestBody struct {
+	Disabled bool `json:"disabled"`
+}
+
+type RolesRequestBody struct {
+	Roles []string `json:"roles"`
+}
+
+type UserListResponse struct {
+	Users []userstore.User `json:"users"`
+}
+
+// readUserBody unmarshals the request body into out, it writes the error response and returns
+// false on failure.
+func readUserBody(respWriter http.ResponseWriter, request *http.Request, out interface{}) bool {
+	var goLibSrv golib.Service
+
+	if err := golib.FromContextAs(
+		request.Context(),
+		&goLibSrv); err != nil {
+		log.Printf("golib service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return false
+	}
+
+	return readJSONBody(respWriter, request, goLibSrv, out)
+}
+
+func writeUserStoreError(respWriter http.ResponseWriter, err error) {
+	var userExistsErr common.UserExistsError
+	if errors.As(err, &userExistsErr) {
+		common.WriteError(respWriter, http.StatusConflict, "USER_EXISTS", userExistsErr.Error())
+
+		return
+	}
+
+	var userNotFoundErr common.UserNotFoundError
+	if errors.As(err, &userNotFoundErr) {
+		common.WriteError(respWriter, http.StatusNotFound, "NOT_FOUND", "user not found")
+
+		return
+	}
+
+	var invalidUsernameErr common.InvalidUsernameError
+	if errors.As(err, &invalidUsernameErr) {
+		common.WriteError(respWriter, http.StatusBadRequest, "INVALID_USERNAME", invalidUsernameErr.Error())
+
+		return
+	}
+
+	var passwordPolicyErr common.PasswordPolicyError
+	if errors.As(err, &passwordPolicyErr) {
+		common.WriteError(respWriter, http.StatusBadRequest, "WEAK_PASSWORD", passwordPolicyErr.Error())
+
+		return
+	}
+
+	writeCredentialsError(respWriter, err)
+}
+
+// validateUsername checks a username picked at self registration. Besides its length and
+// characters it must not be reserved or the id of an OAuth client, whose client credentials tokens
+// have the client id as their subject.
+func validateUsername(clientStoreSrv clientstore.Service, username string) error {
+	if len(username) < usernameMinLength || len(username) > usernameMaxLength {
+		return common.InvalidUsernameError(fmt.Sprintf("username must have %v to %v characters", usernameMinLength, usernameMaxLength))
+	}
+
+	if !usernamePattern.MatchString(username) {
+		return common.InvalidUsernameError("username may only have letters, digits, dots, underscores and dashes")
+	}
+
+	if reservedUsernames[strings.ToLower(username)] {
+		return common.InvalidUsernameError("username is reserved")
+	}
+
+	if _, err := clientStoreSrv.Get(username); err == nil {
+		return common.InvalidUsernameError("username is reserved")
+	}
+
+	return nil
+}
+
+// handleRegister lets anyone register an account, the username has to pass validateUsername and
+// the password the password policy.
+func handleRegister(respWriter http.ResponseWriter, request *http.Request) {
+	var clientStoreSrv clientstore.Service
+
+	if err := clientstore.FromContextAs(
+		request.Context(),
+		&clientStoreSrv); err != nil {
+		log.Printf("client store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	createUser(respWriter, request, func(username string) error {
+		return validateUsername(clientStoreSrv, username)
+	})
+}
+
+// handleChangePassword changes the password of the token subject, which bumps its token version so
+// all its outstanding tokens and refresh tokens stop working.
+func handleChangePassword(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var changePasswordRequestBody ChangePasswordRequestBody
+
+	if !readUserBody(respWriter, request, &changePasswordRequestBody) {
+		return
+	}
+
+	if changePasswordRequestBody.OldPassword == "" || changePasswordRequestBody.NewPassword == "" {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "old_password and new_password are required")
+
+		return
+	}
+
+	subject := subjectFromContext(request.Context())
+
+	if err := userStoreSrv.ChangePassword(subject, changePasswordRequestBody.OldPassword, changePasswordRequestBody.NewPassword); err != nil {
+		log.Printf("failed to change password of: %q: %v", subject, err)
+		writeUserStoreError(respWriter, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateUser lets admins create an account with any username.
+func handleCreateUser(respWriter http.ResponseWriter, request *http.Request) {
+	createUser(respWriter, request, nil)
+}
+
+// createUser creates the user of the request body, validate checks the username when it is set.
+func createUser(respWriter http.ResponseWriter, request *http.Request, validate func(username string) error) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var userRequestBody UserRequestBody
+
+	if !readUserBody(respWriter, request, &userRequestBody) {
+		return
+	}
+
+	if userRequestBody.Username == "" || userRequestBody.Password == "" {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "username and password are required")
+
+		return
+	}
+
+	if validate != nil {
+		if err := validate(userRequestBody.Username); err != nil {
+			log.Printf("refused username: %q: %v", userRequestBody.Username, err)
+			writeUserStoreError(respWriter, err)
+
+			return
+		}
+	}
+
+	user, err := userStoreSrv.Create(userRequestBody.Username, userRequestBody.Password)
+	if err != nil {
+		log.Printf("failed to create user: %v", err)
+		writeUserStoreError(respWriter, err)
+
+		return
+	}
+
+	writeResponseStatus(respWriter, http.StatusCreated, user)
+}
+
+func handleSetPassword(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var passwordRequestBody PasswordRequestBody
+
+	if !readUserBody(respWriter, request, &passwordRequestBody) {
+		return
+	}
+
+	if passwordRequestBody.Password == "" {
+		common.WriteError(respWriter, http.StatusBadRequest, "BAD REQUEST", "password is required")
+
+		return
+	}
+
+	if err := userStoreSrv.SetPassword(chi.URLParam(request, "username"), passwordRequestBody.Password); err != nil {
+		log.Printf("failed to set password: %v", err)
+		writeUserStoreError(respWriter, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func handleSetDisabled(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var disabledRequestBody DisabledRequestBody
+
+	if !readUserBody(respWriter, request, &disabledRequestBody) {
+		return
+	}
+
+	if err := userStoreSrv.SetDisabled(chi.URLParam(request, "username"), disabledRequestBody.Disabled); err != nil {
+		log.Printf("failed to set disabled: %v", err)
+		writeUserStoreError(respWriter, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func handleSetRoles(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	var rolesRequestBody RolesRequestBody
+
+	if !readUserBody(respWriter, request, &rolesRequestBody) {
+		return
+	}
+
+	if err := userStoreSrv.SetRoles(chi.URLParam(request, "username"), rolesRequestBody.Roles); err != nil {
+		log.Printf("failed to set roles: %v", err)
+		writeUserStoreError(respWriter, err)
+
+		return
+	}
+
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+func handleListUsers(respWriter http.ResponseWriter, request *http.Request) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(
+		request.Context(),
+		&userStoreSrv); err != nil {
+		log.Printf("user store service type assert error")
+		common.WriteInternalError(respWriter)
+
+		return
+	}
+
+	writeResponse(respWriter, &UserListResponse{Users: userStoreSrv.List()})
+}
@@ -0,0 +1,351 @@
+package sumapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_adminUsers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config.LoadConfig()
+
+	client := &http.Client{}
+
+	tests := []struct {
+		name               string
+		scope              string
+		method             string
+		url                string
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			name:               "adminUsers-notAdmin",
+			scope:              "sum:write",
+			method:             "POST",
+			url:                "/sumapi/v1/admin/users",
+			body:               `{"username": "bob", "password": "secret password"}`,
+			expectedStatusCode: 403,
+		},
+		{
+			name:               "adminUsers-create",
+			scope:              "admin",
+			method:             "POST",
+			url:                "/sumapi/v1/admin/users",
+			body:               `{"username": "bob", "password": "secret password"}`,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "adminUsers-createExisting",
+			scope:              "admin",
+			method:             "POST",
+			url:                "/sumapi/v1/admin/users",
+			body:               `{"username": "alice", "password": "secret password"}`,
+			expectedStatusCode: 409,
+		},
+		{
+			name:               "adminUsers-createNoPassword",
+			scope:              "admin",
+			method:             "POST",
+			url:                "/sumapi/v1/admin/users",
+			body:               `{"username": "bob"}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "adminUsers-createWeakPassword",
+			scope:              "admin",
+			method:             "POST",
+			url:                "/sumapi/v1/admin/users",
+			body:               `{"username": "bob", "password": "short"}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "adminUsers-resetPassword",
+			scope:              "admin",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/users/alice/password",
+			body:               `{"password": "changed password"}`,
+			expectedStatusCode: 204,
+		},
+		{
+			name:               "adminUsers-resetPasswordMissing",
+			scope:              "admin",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/users/bob/password",
+			body:               `{"password": "changed password"}`,
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "adminUsers-disable",
+			scope:              "admin",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/users/alice/disabled",
+			body:               `{"disabled": true}`,
+			expectedStatusCode: 204,
+		},
+		{
+			name:               "adminUsers-setProfile",
+			scope:              "admin",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/users/alice/profile",
+			body:               `{"name": "Alice", "email": "alice@example.com", "tenant": "acme"}`,
+			expectedStatusCode: 204,
+		},
+		{
+			name:               "adminUsers-setProfileInvalidEmail",
+			scope:              "admin",
+			method:             "PUT",
+			url:                "/sumapi/v1/admin/users/alice/profile",
+			body:               `{"name": "Alice", "email": "Alice <alice@example.com>"}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "adminUsers-list",
+			scope:              "admin",
+			method:             "GET",
+			url:                "/sumapi/v1/admin/users",
+			expectedStatusCode: 200,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			userStoreSrv, err := userstore.New()
+			if err != nil {
+				t.Fatalf("Could not create the user store: %v", err)
+			}
+
+			if _, err := userStoreSrv.Create("alice", "secret password"); err != nil {
+				t.Fatalf("Could not create the user: %v", err)
+			}
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(userstore.Inject(userStoreSrv))
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), &tokenhelper.Claims{Scope: tt.scope})))
+				})
+			})
+
+			router.Route("/sumapi/v1/admin", func(router chi.Router) {
+				router.Use(RequireScope(scopeAdmin))
+				router.Get("/users", handleListUsers)
+				router.Post("/users", handleCreateUser)
+				router.Put("/users/{username}/password", handleSetPassword)
+				router.Put("/users/{username}/disabled", handleSetDisabled)
+				router.Put("/users/{username}/profile", handleSetProfile)
+			})
+
+			request, err := http.NewRequestWithContext(ctx, tt.method, server.URL+tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("Could not make the request: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", response.StatusCode, tt.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func Test_register(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config.LoadConfig()
+
+	tests := []struct {
+		name               string
+		username           string
+		expectedStatusCode int
+	}{
+		{
+			name:               "register-valid",
+			username:           "bob.smith-2",
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "register-existing",
+			username:           "alice",
+			expectedStatusCode: 409,
+		},
+		{
+			name:               "register-tooShort",
+			username:           "bo",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "register-tooLong",
+			username:           strings.Repeat("b", usernameMaxLength+1),
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "register-invalidCharacters",
+			username:           "bob smith",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "register-reserved",
+			username:           "Admin",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "register-clientID",
+			username:           "reports",
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			userStoreSrv, err := userstore.New()
+			if err != nil {
+				t.Fatalf("Could not create the user store: %v", err)
+			}
+
+			if _, err := userStoreSrv.Create("alice", "secret password"); err != nil {
+				t.Fatalf("Could not create the user: %v", err)
+			}
+
+			router := chi.NewRouter()
+			server := httptest.NewServer(router)
+
+			t.Cleanup(func() { server.Close() })
+
+			router.Use(golib.Inject(&golib.GoLibImplMock{}))
+			router.Use(userstore.Inject(userStoreSrv))
+			router.Use(clientstore.Inject(&clientstore.ClientStoreClientImplMock{
+				GetFn: func(id string) (clientstore.Client, error) {
+					if id != "reports" {
+						return clientstore.Client{}, common.InvalidClientError(id)
+					}
+
+					return clientstore.Client{ID: id}, nil
+				},
+			}))
+			router.Post("/sumapi/v1/users", handleRegister)
+
+			body := `{"username": "` + tt.username + `", "password": "secret password"}`
+
+			if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/users", body); statusCode != tt.expectedStatusCode {
+				t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, tt.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func Test_changePassword(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := context.Background()
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		t.Fatalf("Could not create the user store: %v", err)
+	}
+
+	router := chi.NewRouter()
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() { server.Close() })
+
+	router.Use(golib.Inject(golib.New()))
+	router.Use(tokenhelper.Inject(newTokenHelper(t)))
+	router.Use(refreshstore.Inject(refreshstore.New()))
+	router.Use(userstore.Inject(userStoreSrv))
+	router.Use(attemptstore.Inject(attemptstore.New()))
+	router.Use(challengestore.Inject(challengestore.New()))
+	router.Use(clientstore.Inject(&clientstore.ClientStoreClientImplMock{}))
+
+	InstallRoutes(router)
+
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/users", `{"username": "alice", "password": "short"}`); statusCode != http.StatusBadRequest {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusBadRequest)
+	}
+
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/users", `{"username": "alice", "password": "old password"}`); statusCode != http.StatusCreated {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusCreated)
+	}
+
+	_, login := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "alice", "password": "old password"}`)
+
+	changePassword := func(token, body string) int {
+		t.Helper()
+
+		request, err := http.NewRequestWithContext(ctx, "PUT", server.URL+"/sumapi/v1/users/me/password", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		request.Header.Set("Authorization", "Bearer "+token)
+
+		response, err := (&http.Client{}).Do(request)
+		if err != nil {
+			t.Fatalf("Could not make the request: %v", err)
+		}
+
+		defer response.Body.Close()
+
+		return response.StatusCode
+	}
+
+	if statusCode := changePassword(login.Token, `{"old_password": "wrong password", "new_password": "new password"}`); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusUnauthorized)
+	}
+
+	if statusCode := changePassword(login.Token, `{"old_password": "old password", "new_password": "new password"}`); statusCode != http.StatusNoContent {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusNoContent)
+	}
+
+	// the token and refresh token from before the change no longer work
+	if statusCode := changePassword(login.Token, `{"old_password": "new password", "new_password": "newer password"}`); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusUnauthorized)
+	}
+
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/auth/refresh", `{"refresh_token": "`+login.RefreshToken+`"}`); statusCode != http.StatusUnauthorized {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusUnauthorized)
+	}
+
+	if statusCode, _ := postAuth(t, ctx, server.URL+"/sumapi/v1/auth", `{"username": "alice", "password": "new password"}`); statusCode != http.StatusOK {
+		t.Fatalf("Response status code: %v does not match expected status code: %v", statusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,74 @@
+package tokenhelper
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+
+	"go-wai-wong/common"
+)
+
+const (
+	clientCertificateCtxKey   = "4c8e2a71-d3b5-4f06-9e1a-7b52c0f8d694"
+	skipCertificateBindingKey = "e1f7b3c9-0a24-4d8e-b6c5-93d2a8f41e07"
+)
+
+// Confirmation is the RFC 7800 cnf claim, X5TS256 binds the token to a client certificate as in
+// RFC 8705.
+type Confirmation struct {
+	X5TS256 string `json:"x5t#S256,omitempty"`
+}
+
+// WithClientCertificate records the verified client certificate of the connection a token is
+// presented over, nil when the connection has none.
+func WithClientCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, clientCertificateCtxKey, cert)
+}
+
+// ClientCertificateFromContext returns the client certificate of the connection, nil without one.
+func ClientCertificateFromContext(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(clientCertificateCtxKey).(*x509.Certificate)
+
+	return cert
+}
+
+// WithoutCertificateBinding lets VerifyToken accept bound tokens over any connection, for
+// introspection and token exchange where the caller is not the holder of the token.
+func WithoutCertificateBinding(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipCertificateBindingKey, true)
+}
+
+// CertificateThumbprint is the x5t#S256 of cert, the base64url SHA-256 of its DER encoding.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// WithCertificateBinding binds the token to cert, it is then only accepted over a connection with
+// the same client certificate.
+func WithCertificateBinding(cert *x509.Certificate) Option {
+	return func(claims *Claims) {
+		claims.Confirmation = &Confirmation{X5TS256: CertificateThumbprint(cert)}
+	}
+}
+
+// checkCertificateBinding rejects a bound token unless the client certificate in ctx is the one
+// it is bound to.
+func checkCertificateBinding(ctx context.Context, claims *Claims) error {
+	if claims.Confirmation == nil || claims.Confirmation.X5TS256 == "" {
+		return nil
+	}
+
+	if skip, _ := ctx.Value(skipCertificateBindingKey).(bool); skip {
+		return nil
+	}
+
+	cert := ClientCertificateFromContext(ctx)
+	if cert == nil || CertificateThumbprint(cert) != claims.Confirmation.X5TS256 {
+		return common.CertificateMismatchError(claims.Id)
+	}
+
+	return nil
+}
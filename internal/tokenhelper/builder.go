@@ -0,0 +1,46 @@
+package tokenhelper
+
+import (
+	"context"
+	"errors"
+
+	"go-wai-wong/common"
+)
+
+// ClaimsBuilder adds custom claims to the token GenToken issues for subject. Builders run before
+// the options, so an option still overrides a claim set by a builder.
+type ClaimsBuilder func(ctx context.Context, subject string, claims *Claims) error
+
+// WithClaimsBuilder returns a copy of the service with builder added after the existing builders.
+func (c tokenHelperImpl) WithClaimsBuilder(builder ClaimsBuilder) Service {
+	builders := make([]ClaimsBuilder, 0, len(c.claimsBuilders)+1)
+	builders = append(builders, c.claimsBuilders...)
+	c.claimsBuilders = append(builders, builder)
+
+	return c
+}
+
+// UserProfileClaims adds the name, email and tenant of the user from the injected user store.
+// Subjects that are not users, such as clients, get no profile claims.
+func UserProfileClaims(ctx context.Context, subject string, claims *Claims) error {
+	userStoreSrv, err := userStoreFromContext(ctx)
+	if err != nil || userStoreSrv == nil {
+		return err
+	}
+
+	user, err := userStoreSrv.Get(subject)
+	if err != nil {
+		var userNotFoundErr common.UserNotFoundError
+		if errors.As(err, &userNotFoundErr) {
+			return nil
+		}
+
+		return err
+	}
+
+	claims.Name = user.Name
+	claims.Email = user.Email
+	claims.Tenant = user.Tenant
+
+	return nil
+}
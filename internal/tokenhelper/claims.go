@@ -0,0 +1,58 @@
+package tokenhelper
+
+import (
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+
+	"github.com/spf13/viper"
+)
+
+// validateClaims checks the registered claims at now. exp, iat and jti are required, nbf is
+// checked when present for tokens issued before it was added, and the time claims get clockSkew
+// of leeway for servers whose clocks drift apart.
+func (c tokenHelperImpl) validateClaims(claims *Claims, now time.Time) error {
+	nowUnix := now.Unix()
+	skew := int64(c.clockSkew / time.Second)
+
+	switch {
+	case claims.ExpiresAt == 0:
+		return common.ClaimError{Claim: "exp", Reason: "missing"}
+	case nowUnix > claims.ExpiresAt+skew:
+		return common.ClaimError{Claim: "exp", Reason: "token is expired"}
+	case claims.IssuedAt == 0:
+		return common.ClaimError{Claim: "iat", Reason: "missing"}
+	case claims.IssuedAt > nowUnix+skew:
+		return common.ClaimError{Claim: "iat", Reason: "token is issued in the future"}
+	case claims.NotBefore > nowUnix+skew:
+		return common.ClaimError{Claim: "nbf", Reason: "token is not valid yet"}
+	case claims.Id == "":
+		return common.ClaimError{Claim: "jti", Reason: "missing"}
+	}
+
+	if !c.acceptsAudience(claims.Audience) {
+		return common.AudienceError(claims.Audience)
+	}
+
+	if !claims.VerifyIssuer(Issuer(), true) {
+		return common.IssuerError(claims.Issuer)
+	}
+
+	return nil
+}
+
+// acceptsAudience reports whether audience is token.audience or one of the accepted audiences.
+func (c tokenHelperImpl) acceptsAudience(audience string) bool {
+	if audience == viper.GetString(constant.TokenAudience) {
+		return true
+	}
+
+	for _, accepted := range c.audiences {
+		if audience == accepted {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,235 @@
+package tokenhelper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/golib"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// EncryptionDirect encrypts with the shared token.encryptionkey
+	EncryptionDirect = "dir"
+	// EncryptionRSAOAEP256 encrypts a random content key for the RSA key in token.encryptionpublickeyfile
+	EncryptionRSAOAEP256 = "RSA-OAEP-256"
+
+	contentEncryptionA256GCM = "A256GCM"
+	contentKeyBytes          = 32
+	gcmIVBytes               = 12
+	gcmTagBytes              = 16
+)
+
+// loadEncryptionKeys decodes the direct key or reads the RSA key files of the encryption
+// algorithm, so a key that cannot encrypt stops the server from starting. Every token is
+// decrypted before it is verified, so RSA-OAEP-256 always needs the private key, the public key
+// defaults to the public half of it.
+func (c tokenHelperImpl) loadEncryptionKeys(goLibSrv golib.Service) (tokenHelperImpl, error) {
+	switch c.encryption {
+	case "":
+		return c, nil
+	case EncryptionDirect:
+		key, err := goLibSrv.StdEncodingDecodeString(c.encryptionKey)
+		if err != nil {
+			return tokenHelperImpl{}, fmt.Errorf("failed to decode encryption key: %w", err)
+		}
+
+		if len(key) != contentKeyBytes {
+			return tokenHelperImpl{}, fmt.Errorf("encryption key must be %v bytes, got: %v", contentKeyBytes, len(key))
+		}
+
+		c.directKey = key
+
+		return c, nil
+	case EncryptionRSAOAEP256:
+		pemBytes, err := goLibSrv.ReadFile(c.encryptionPrivateKeyFile)
+		if err != nil {
+			return tokenHelperImpl{}, fmt.Errorf("failed to read encryption private key: %w", err)
+		}
+
+		if c.encryptionPrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err != nil {
+			return tokenHelperImpl{}, fmt.Errorf("failed to parse encryption private key: %w", err)
+		}
+
+		c.encryptionPublicKey = &c.encryptionPrivateKey.PublicKey
+
+		if c.encryptionPublicKeyFile == "" {
+			return c, nil
+		}
+
+		if pemBytes, err = goLibSrv.ReadFile(c.encryptionPublicKeyFile); err != nil {
+			return tokenHelperImpl{}, fmt.Errorf("failed to read encryption public key: %w", err)
+		}
+
+		if c.encryptionPublicKey, err = jwt.ParseRSAPublicKeyFromPEM(pemBytes); err != nil {
+			return tokenHelperImpl{}, fmt.Errorf("failed to parse encryption public key: %w", err)
+		}
+
+		return c, nil
+	}
+
+	return tokenHelperImpl{}, fmt.Errorf("unsupported encryption algorithm: %v", c.encryption)
+}
+
+// jweHeader is the protected header of a compact JWE, cty JWT marks the payload as a nested JWT.
+type jweHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	ContentType string `json:"cty"`
+}
+
+// encrypt wraps a signed token in a compact RFC 7516 JWE, so the claims are only readable with the
+// decryption key.
+func (c tokenHelperImpl) encrypt(goLibSrv golib.Service, signedString string) (string, error) {
+	contentKey, encryptedKey, err := c.contentKey()
+	if err != nil {
+		return "", err
+	}
+
+	headerJSON, err := goLibSrv.Marshal(jweHeader{Algorithm: c.encryption, Encryption: contentEncryptionA256GCM, ContentType: "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwe header: %w", err)
+	}
+
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcmIVBytes)
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	// the protected header is the additional authenticated data so it cannot be swapped
+	sealed := gcm.Seal(nil, iv, []byte(signedString), []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcmTagBytes], sealed[len(sealed)-gcmTagBytes:]
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// decrypt returns the signed token inside a compact JWE. Only the configured algorithm is
+// accepted, plain signed tokens are rejected when encryption is on.
+func (c tokenHelperImpl) decrypt(goLibSrv golib.Service, tokenStr string) (string, error) {
+	parts := strings.Split(tokenStr, ".")
+	if len(parts) != 5 {
+		return "", common.DecryptionError("token is not a compact JWE")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", common.DecryptionError("invalid header encoding")
+	}
+
+	var header jweHeader
+	if err := goLibSrv.Unmarshal(headerJSON, &header); err != nil {
+		return "", common.DecryptionError("invalid header")
+	}
+
+	if header.Algorithm != c.encryption || header.Encryption != contentEncryptionA256GCM {
+		return "", common.DecryptionError(fmt.Sprintf("unexpected alg: %q enc: %q", header.Algorithm, header.Encryption))
+	}
+
+	decoded := make([][]byte, 4)
+
+	for i, part := range parts[1:] {
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return "", common.DecryptionError("invalid part encoding")
+		}
+	}
+
+	encryptedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+
+	contentKey, err := c.decryptContentKey(encryptedKey)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return "", err
+	}
+
+	if len(iv) != gcmIVBytes || len(tag) != gcmTagBytes {
+		return "", common.DecryptionError("invalid iv or tag length")
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", common.DecryptionError("authentication failed")
+	}
+
+	return string(plaintext), nil
+}
+
+// contentKey returns the key to encrypt the content with and the encrypted key for the token,
+// direct encryption uses the shared key and leaves the encrypted key empty.
+func (c tokenHelperImpl) contentKey() ([]byte, []byte, error) {
+	switch c.encryption {
+	case EncryptionDirect:
+		return c.directKey, nil, nil
+	case EncryptionRSAOAEP256:
+		contentKey := make([]byte, contentKeyBytes)
+		if _, err := rand.Read(contentKey); err != nil {
+			return nil, nil, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+
+		encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, c.encryptionPublicKey, contentKey, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt content key: %w", err)
+		}
+
+		return contentKey, encryptedKey, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported encryption algorithm: %v", c.encryption)
+}
+
+func (c tokenHelperImpl) decryptContentKey(encryptedKey []byte) ([]byte, error) {
+	switch c.encryption {
+	case EncryptionDirect:
+		if len(encryptedKey) != 0 {
+			return nil, common.DecryptionError("direct encryption has no encrypted key")
+		}
+
+		return c.directKey, nil
+	case EncryptionRSAOAEP256:
+		contentKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, c.encryptionPrivateKey, encryptedKey, nil)
+		if err != nil {
+			return nil, common.DecryptionError("failed to decrypt content key")
+		}
+
+		return contentKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported encryption algorithm: %v", c.encryption)
+}
+
+func newGCM(contentKey []byte) (cipher.AEAD, error) {
+	if len(contentKey) != contentKeyBytes {
+		return nil, common.DecryptionError("invalid content key length")
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
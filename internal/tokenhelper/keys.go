@@ -0,0 +1,212 @@
+package tokenhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/keystore"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+)
+
+// signer is what GenToken signs with, kid is not set for the HS256 secret.
+type signer struct {
+	method jwt.SigningMethod
+	key    interface{}
+	kid    string
+}
+
+func (c tokenHelperImpl) algorithmOrDefault() string {
+	if c.algorithm == "" {
+		return keystore.AlgorithmHS256
+	}
+
+	return c.algorithm
+}
+
+// keyStoreFromContext returns the key store, or nil when none is injected and the configured key
+// files are used instead.
+func keyStoreFromContext(ctx context.Context) (keystore.Service, error) {
+	var keyStoreSrv keystore.Service
+
+	if err := keystore.FromContextAs(ctx, &keyStoreSrv); err != nil {
+		var missingErr common.CtxValueKeyMissingError
+		if errors.As(err, &missingErr) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("key store from context as err: %w", err)
+	}
+
+	return keyStoreSrv, nil
+}
+
+// loadKeys reads and parses the PEM key files of an asymmetric algorithm, so a missing or broken
+// key stops the server from starting instead of failing the first token. The private key is only
+// needed to issue tokens, the public key is always needed to verify them.
+func (c tokenHelperImpl) loadKeys(goLibSrv golib.Service) (tokenHelperImpl, error) {
+	if _, err := keystore.SigningMethod(c.algorithmOrDefault()); err != nil {
+		return tokenHelperImpl{}, err
+	}
+
+	if c.algorithmOrDefault() == keystore.AlgorithmHS256 {
+		return c, nil
+	}
+
+	if c.privateKeyFile != "" {
+		pemBytes, err := goLibSrv.ReadFile(c.privateKeyFile)
+		if err != nil {
+			return tokenHelperImpl{}, fmt.Errorf("failed to read private key: %w", err)
+		}
+
+		if c.privateKey, err = keystore.ParsePrivateKeyPEM(c.algorithm, pemBytes); err != nil {
+			return tokenHelperImpl{}, err
+		}
+	}
+
+	pemBytes, err := goLibSrv.ReadFile(c.publicKeyFile)
+	if err != nil {
+		return tokenHelperImpl{}, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	if c.publicKey, err = keystore.ParsePublicKeyPEM(c.algorithm, pemBytes); err != nil {
+		return tokenHelperImpl{}, err
+	}
+
+	jwk, err := keystore.PublicJWK(keystore.Key{Algorithm: c.algorithm, PublicKey: c.publicKey})
+	if err != nil {
+		return tokenHelperImpl{}, err
+	}
+
+	// the thumbprint only changes with the key, so verifiers can cache the published key by kid
+	if c.kid, err = keystore.Thumbprint(jwk); err != nil {
+		return tokenHelperImpl{}, err
+	}
+
+	return c, nil
+}
+
+// JWKS returns the public key of token.publickeyfile under the kid the tokens are signed with.
+func (c tokenHelperImpl) JWKS() (keystore.JWKSet, error) {
+	if c.publicKey == nil {
+		return keystore.JWKSet{Keys: []keystore.JWK{}}, nil
+	}
+
+	jwk, err := keystore.PublicJWK(keystore.Key{ID: c.kid, Algorithm: c.algorithm, PublicKey: c.publicKey})
+	if err != nil {
+		return keystore.JWKSet{}, err
+	}
+
+	return keystore.JWKSet{Keys: []keystore.JWK{jwk}}, nil
+}
+
+// signer returns the active key store key, or the secret or loaded private key for the configured
+// algorithm.
+func (c tokenHelperImpl) signer(goLibSrv golib.Service, keyStoreSrv keystore.Service) (signer, error) {
+	if keyStoreSrv != nil {
+		key, err := keyStoreSrv.SigningKey()
+		if err != nil {
+			return signer{}, err
+		}
+
+		method, err := keystore.SigningMethod(key.Algorithm)
+		if err != nil {
+			return signer{}, err
+		}
+
+		return signer{method: method, key: key.PrivateKey, kid: key.ID}, nil
+	}
+
+	method, err := keystore.SigningMethod(c.algorithmOrDefault())
+	if err != nil {
+		return signer{}, err
+	}
+
+	if c.algorithmOrDefault() == keystore.AlgorithmHS256 {
+		secret, err := c.secret(goLibSrv)
+
+		return signer{method: method, key: secret}, err
+	}
+
+	if c.privateKey == nil {
+		return signer{}, fmt.Errorf("no private key to sign %v tokens with", c.algorithm)
+	}
+
+	return signer{method: method, key: c.privateKey, kid: c.kid}, nil
+}
+
+// verificationKey returns the key VerifyToken checks signatures with, only the public key is
+// needed for asymmetric algorithms.
+func (c tokenHelperImpl) verificationKey(goLibSrv golib.Service) (interface{}, error) {
+	if c.algorithmOrDefault() == keystore.AlgorithmHS256 {
+		return c.secret(goLibSrv)
+	}
+
+	if c.publicKey == nil {
+		return nil, fmt.Errorf("no public key to verify %v tokens with", c.algorithm)
+	}
+
+	return c.publicKey, nil
+}
+
+func (c tokenHelperImpl) secret(goLibSrv golib.Service) ([]byte, error) {
+	secret, err := goLibSrv.StdEncodingDecodeString(viper.GetString(constant.TokenSecret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// keyFunc only hands out the verification key to tokens signed with the expected algorithm,
+// otherwise a token could pick a weaker algorithm than the one we sign with. With a key store the
+// key is picked by the kid header.
+func (c tokenHelperImpl) keyFunc(goLibSrv golib.Service, keyStoreSrv keystore.Service) jwt.Keyfunc {
+	return func(tok *jwt.Token) (interface{}, error) {
+		if keyStoreSrv != nil {
+			kid, _ := tok.Header["kid"].(string)
+
+			key, err := keyStoreSrv.VerificationKey(kid)
+			if err != nil {
+				return nil, err
+			}
+
+			if tok.Method.Alg() != key.Algorithm {
+				return nil, common.AlgorithmError{Expected: key.Algorithm, Found: tok.Method.Alg()}
+			}
+
+			return key.PublicKey, nil
+		}
+
+		if tok.Method.Alg() != c.algorithmOrDefault() {
+			return nil, common.AlgorithmError{Expected: c.algorithmOrDefault(), Found: tok.Method.Alg()}
+		}
+
+		return c.verificationKey(goLibSrv)
+	}
+}
+
+// keyError returns the key selection error from a jwt validation error, if that is what failed.
+func keyError(err error) error {
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil
+	}
+
+	var algorithmErr common.AlgorithmError
+	if errors.As(validationErr.Inner, &algorithmErr) {
+		return algorithmErr
+	}
+
+	var keyNotFoundErr common.KeyNotFoundError
+	if errors.As(validationErr.Inner, &keyNotFoundErr) {
+		return keyNotFoundErr
+	}
+
+	return nil
+}
@@ -2,29 +2,79 @@ package tokenhelper
 
 import (
 	"context"
+
+	"go-wai-wong/internal/keystore"
 )
 
 type TokenClientImplMock struct {
-	GenTokenFn    func(ctx context.Context, username string) (string, error)
-	VerifyTokenFn func(ctx context.Context, tokenStr string) (string, error)
+	GenTokenFn          func(ctx context.Context, username string, opts ...Option) (string, error)
+	VerifyTokenFn       func(ctx context.Context, tokenStr string) (*Claims, error)
+	RevokeFn            func(ctx context.Context, tokenStr string) error
+	WithClaimsBuilderFn func(builder ClaimsBuilder) Service
+	JWKSFn              func() (keystore.JWKSet, error)
 }
 
-func (c *TokenClientImplMock) GenToken(ctx context.Context, username string) (string, error) {
+func (c *TokenClientImplMock) GenToken(ctx context.Context, username string, opts ...Option) (string, error) {
 	if c != nil && c.GenTokenFn != nil {
-		return c.GenTokenFn(ctx, username)
+		return c.GenTokenFn(ctx, username, opts...)
 	}
 
-	tokenHelperSrv := New()
+	tokenHelperSrv, err := New()
+	if err != nil {
+		return "", err
+	}
 
-	return tokenHelperSrv.GenToken(ctx, username)
+	return tokenHelperSrv.GenToken(ctx, username, opts...)
 }
 
-func (c *TokenClientImplMock) VerifyToken(ctx context.Context, tokenStr string) (string, error) {
+func (c *TokenClientImplMock) VerifyToken(ctx context.Context, tokenStr string) (*Claims, error) {
 	if c != nil && c.VerifyTokenFn != nil {
 		return c.VerifyTokenFn(ctx, tokenStr)
 	}
 
-	tokenHelperSrv := New()
+	tokenHelperSrv, err := New()
+	if err != nil {
+		return nil, err
+	}
 
 	return tokenHelperSrv.VerifyToken(ctx, tokenStr)
 }
+
+func (c *TokenClientImplMock) Revoke(ctx context.Context, tokenStr string) error {
+	if c != nil && c.RevokeFn != nil {
+		return c.RevokeFn(ctx, tokenStr)
+	}
+
+	tokenHelperSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return tokenHelperSrv.Revoke(ctx, tokenStr)
+}
+
+func (c *TokenClientImplMock) WithClaimsBuilder(builder ClaimsBuilder) Service {
+	if c != nil && c.WithClaimsBuilderFn != nil {
+		return c.WithClaimsBuilderFn(builder)
+	}
+
+	tokenHelperSrv, err := New()
+	if err != nil {
+		return c
+	}
+
+	return tokenHelperSrv.WithClaimsBuilder(builder)
+}
+
+func (c *TokenClientImplMock) JWKS() (keystore.JWKSet, error) {
+	if c != nil && c.JWKSFn != nil {
+		return c.JWKSFn()
+	}
+
+	tokenHelperSrv, err := New()
+	if err != nil {
+		return keystore.JWKSet{}, err
+	}
+
+	return tokenHelperSrv.JWKS()
+}
@@ -0,0 +1,107 @@
+package tokenhelper
+
+import (
+	"strings"
+	"time"
+)
+
+// Option sets optional claims when GenToken issues a token.
+type Option func(claims *Claims)
+
+// WithScope sets the space separated scope claim.
+func WithScope(scopes ...string) Option {
+	return func(claims *Claims) {
+		claims.Scope = strings.Join(scopes, " ")
+	}
+}
+
+// WithRoles sets the roles claim.
+func WithRoles(roles ...string) Option {
+	return func(claims *Claims) {
+		claims.Roles = roles
+	}
+}
+
+// WithAudience replaces the token.audience config as the aud claim.
+func WithAudience(audience string) Option {
+	return func(claims *Claims) {
+		claims.Audience = audience
+	}
+}
+
+// WithAuthorizedParty sets the azp claim to the client the token is issued to.
+func WithAuthorizedParty(clientID string) Option {
+	return func(claims *Claims) {
+		claims.AuthorizedParty = clientID
+	}
+}
+
+// WithNonce sets the nonce claim of an ID token to the nonce of the authorization request.
+func WithNonce(nonce string) Option {
+	return func(claims *Claims) {
+		claims.Nonce = nonce
+	}
+}
+
+// WithAuthTime sets the auth_time claim of an ID token to when the user logged in.
+func WithAuthTime(authTime time.Time) Option {
+	return func(claims *Claims) {
+		claims.AuthTime = authTime.Unix()
+	}
+}
+
+// WithActor sets the act claim of a token issued to actor on behalf of the subject.
+func WithActor(actor *Actor) Option {
+	return func(claims *Claims) {
+		claims.Actor = actor
+	}
+}
+
+// WithExpiresAt replaces the token.expiresin config as the exp claim.
+func WithExpiresAt(expiresAt time.Time) Option {
+	return func(claims *Claims) {
+		claims.ExpiresAt = expiresAt.Unix()
+	}
+}
+
+// WithAMR sets the amr claim to the methods the user logged in with.
+func WithAMR(methods ...string) Option {
+	return func(claims *Claims) {
+		claims.AMR = methods
+	}
+}
+
+// WithoutEncryption leaves the token signed but unencrypted, for tokens such as ID tokens that are
+// read by clients without the encryption key.
+func WithoutEncryption() Option {
+	return func(claims *Claims) {
+		claims.unencrypted = true
+	}
+}
+
+// HasAMR reports whether the user logged in with method.
+func (c *Claims) HasAMR(method string) bool {
+	for _, used := range c.AMR {
+		if used == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scopes splits the scope claim.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScope reports whether the scope claim includes scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, granted := range c.Scopes() {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
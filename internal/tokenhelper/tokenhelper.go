@@ -2,80 +2,345 @@ package tokenhelper
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"go-wai-wong/common"
 	"go-wai-wong/internal/constant"
 	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/keystore"
+	"go-wai-wong/internal/revocationstore"
+	"go-wai-wong/internal/userstore"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/spf13/viper"
 )
 
 type Service interface {
-	GenToken(ctx context.Context, username string) (string, error)
-	VerifyToken(ctx context.Context, tokenStr string) (string, error)
+	GenToken(ctx context.Context, username string, opts ...Option) (string, error)
+	VerifyToken(ctx context.Context, tokenStr string) (*Claims, error)
+	Revoke(ctx context.Context, tokenStr string) error
+	// WithClaimsBuilder returns a copy of the service that runs builder for every token it issues
+	WithClaimsBuilder(builder ClaimsBuilder) Service
+	// JWKS returns the public key of the key files, there is none to publish for HS256
+	JWKS() (keystore.JWKSet, error)
 }
 
-type tokenHelperImpl struct{}
+// Claims are the claims of our tokens.
+type Claims struct {
+	jwt.StandardClaims
+	Scope string   `json:"scope,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	// AuthorizedParty is the client the token was issued to
+	AuthorizedParty string `json:"azp,omitempty"`
+	// Nonce and AuthTime are only set on ID tokens
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	// TokenVersion is the token version of the subject when the token was issued
+	TokenVersion int `json:"tv,omitempty"`
+	// Actor is the party acting on behalf of the subject of an exchanged token
+	Actor *Actor `json:"act,omitempty"`
+	// Name, Email and Tenant are the profile claims of users
+	Name   string `json:"name,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	// AMR are the RFC 8176 methods the user logged in with, such as pwd and otp
+	AMR []string `json:"amr,omitempty"`
+	// Confirmation binds the token to the client certificate it was issued for
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// unencrypted leaves the signed token unencrypted when encryption is configured
+	unencrypted bool
+}
+
+// Actor is the RFC 8693 act claim, Actor nests the earlier actors when a delegated token is
+// exchanged again.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// tokenHelperImpl signs with HS256 and the shared token.secret unless algorithm names one of the
+// asymmetric algorithms, in which case the keys loaded from the PEM key files are used instead. An
+// injected key store takes precedence over both. With encryption set the signed tokens are
+// encrypted as well. Tokens for token.audience and any of audiences are accepted, with clockSkew
+// of leeway on the time claims.
+type tokenHelperImpl struct {
+	algorithm      string
+	privateKeyFile string
+	publicKeyFile  string
+	privateKey     crypto.Signer
+	publicKey      crypto.PublicKey
+	kid            string
+	audiences      []string
+	clockSkew      time.Duration
+	claimsBuilders []ClaimsBuilder
+
+	encryption               string
+	encryptionKey            string
+	encryptionPublicKeyFile  string
+	encryptionPrivateKeyFile string
+	directKey                []byte
+	encryptionPublicKey      *rsa.PublicKey
+	encryptionPrivateKey     *rsa.PrivateKey
+}
 
 // verify interface compliance
 var _ Service = (*tokenHelperImpl)(nil)
 
-func New() tokenHelperImpl {
-	return tokenHelperImpl{}
+// New reads the token settings and loads the key files they name, the signing keys come from the
+// key store instead when token.keydirectory is set.
+func New() (tokenHelperImpl, error) {
+	tokenHelperSrv := tokenHelperImpl{
+		algorithm:      viper.GetString(constant.TokenAlgorithm),
+		privateKeyFile: viper.GetString(constant.TokenPrivateKey),
+		publicKeyFile:  viper.GetString(constant.TokenPublicKey),
+		audiences:      viper.GetStringSlice(constant.TokenAudiences),
+		clockSkew:      viper.GetDuration(constant.TokenClockSkew),
+
+		encryption:               viper.GetString(constant.TokenEncryption),
+		encryptionKey:            viper.GetString(constant.TokenEncryptionKey),
+		encryptionPublicKeyFile:  viper.GetString(constant.TokenEncryptionPublicKey),
+		encryptionPrivateKeyFile: viper.GetString(constant.TokenEncryptionPrivateKey),
+	}
+
+	goLibSrv := golib.New()
+
+	if viper.GetString(constant.TokenKeyDirectory) == "" {
+		var err error
+
+		if tokenHelperSrv, err = tokenHelperSrv.loadKeys(goLibSrv); err != nil {
+			return tokenHelperImpl{}, err
+		}
+	}
+
+	return tokenHelperSrv.loadEncryptionKeys(goLibSrv)
 }
 
-func (c tokenHelperImpl) GenToken(ctx context.Context, username string) (string, error) {
+// GenToken issues a token for username, opts add the optional claims such as the scope.
+func (c tokenHelperImpl) GenToken(ctx context.Context, username string, opts ...Option) (string, error) {
 	var goLibSrv golib.Service
 
 	if err := golib.FromContextAs(ctx, &goLibSrv); err != nil {
 		return "", fmt.Errorf("golib from context as err: %w", err)
 	}
 
-	claims := goLibSrv.StandardClaims(
-		username,
-		time.Now().Add(viper.GetDuration(constant.TokenExpiresIn)).Unix(),
-		viper.GetString(constant.TokenAudience),
-	)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	now := goLibSrv.Now()
+
+	claims := Claims{
+		StandardClaims: goLibSrv.StandardClaims(
+			username,
+			now.Add(viper.GetDuration(constant.TokenExpiresIn)).Unix(),
+			viper.GetString(constant.TokenAudience),
+		),
+	}
+	claims.IssuedAt = now.Unix()
+	claims.NotBefore = now.Unix()
+	claims.Issuer = Issuer()
 
-	secret, err := goLibSrv.StdEncodingDecodeString(viper.GetString(constant.TokenSecret))
+	jti, err := newJTI()
 	if err != nil {
-		return "", fmt.Errorf("failed to decode secret: %w", err)
+		return "", err
+	}
+
+	claims.Id = jti
+
+	for _, builder := range c.claimsBuilders {
+		if err := builder(ctx, username, &claims); err != nil {
+			return "", fmt.Errorf("claims builder error: %w", err)
+		}
+	}
+
+	for _, opt := range opts {
+		opt(&claims)
 	}
 
-	signedString, err := token.SignedString(secret)
+	userStoreSrv, err := userStoreFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if userStoreSrv != nil {
+		claims.TokenVersion = userStoreSrv.TokenVersion(username)
+	}
+
+	keyStoreSrv, err := keyStoreFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	tokenSigner, err := c.signer(goLibSrv, keyStoreSrv)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(tokenSigner.method, claims)
+	if tokenSigner.kid != "" {
+		token.Header["kid"] = tokenSigner.kid
+	}
+
+	signedString, err := token.SignedString(tokenSigner.key)
 	if err != nil {
 		return "", fmt.Errorf("token signed string error: %w", err)
 	}
 
+	if c.encryption != "" && !claims.unencrypted {
+		return c.encrypt(goLibSrv, signedString)
+	}
+
 	return signedString, nil
 }
 
-func (c tokenHelperImpl) VerifyToken(ctx context.Context, tokenStr string) (string, error) {
+// VerifyToken returns the claims of a valid token that has not been revoked, and whose token version
+// is still the current one of its subject when a user store is injected. A token bound to a client
+// certificate is only valid over a connection with that certificate.
+func (c tokenHelperImpl) VerifyToken(ctx context.Context, tokenStr string) (*Claims, error) {
+	claims, err := c.verifyClaims(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCertificateBinding(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	revocationStoreSrv, err := revocationStoreFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if revocationStoreSrv != nil && claims.Id != "" {
+		revoked, err := revocationStoreSrv.Revoked(claims.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check revocation: %w", err)
+		}
+
+		if revoked {
+			return nil, common.TokenRevokedError(claims.Id)
+		}
+	}
+
+	userStoreSrv, err := userStoreFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if userStoreSrv != nil && claims.TokenVersion != userStoreSrv.TokenVersion(claims.Subject) {
+		return nil, common.TokenRevokedError(claims.Id)
+	}
+
+	return claims, nil
+}
+
+// Revoke records the jti of a valid token in the revocation store until the token expires.
+func (c tokenHelperImpl) Revoke(ctx context.Context, tokenStr string) error {
+	claims, err := c.verifyClaims(ctx, tokenStr)
+	if err != nil {
+		return err
+	}
+
+	var revocationStoreSrv revocationstore.Service
+
+	if err := revocationstore.FromContextAs(ctx, &revocationStoreSrv); err != nil {
+		return fmt.Errorf("revocation store from context as err: %w", err)
+	}
+
+	if claims.Id == "" {
+		return fmt.Errorf("token has no jti to revoke")
+	}
+
+	// the token is still accepted for the clock skew after it expires
+	return revocationStoreSrv.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0).Add(c.clockSkew))
+}
+
+// verifyClaims decrypts an encrypted token, then checks the signature and the registered claims.
+func (c tokenHelperImpl) verifyClaims(ctx context.Context, tokenStr string) (*Claims, error) {
 	var golibSrv golib.Service
 
 	if err := golib.FromContextAs(ctx, &golibSrv); err != nil {
-		return "", fmt.Errorf("get token err: %w", err)
+		return nil, fmt.Errorf("get token err: %w", err)
 	}
 
-	claims := jwt.StandardClaims{}
-	if _, err := golibSrv.ParseWithClaims(tokenStr, &claims, func(tok *jwt.Token) (interface{}, error) {
-		secret, err := golibSrv.StdEncodingDecodeString(viper.GetString(constant.TokenSecret))
-		if err != nil {
-			return "", fmt.Errorf("failed to decode secret: %w", err)
+	keyStoreSrv, err := keyStoreFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.encryption != "" {
+		if tokenStr, err = c.decrypt(golibSrv, tokenStr); err != nil {
+			return nil, err
+		}
+	}
+
+	claims := &Claims{}
+	if _, err := golibSrv.ParseWithClaims(tokenStr, claims, c.keyFunc(golibSrv, keyStoreSrv)); err != nil {
+		if keyErr := keyError(err); keyErr != nil {
+			return nil, keyErr
+		}
+
+		return nil, fmt.Errorf("jwt parse with claims error: %w", err)
+	}
+
+	if err := c.validateClaims(claims, golibSrv.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// revocationStoreFromContext returns the revocation store, or nil when none is injected and no
+// token is treated as revoked.
+func revocationStoreFromContext(ctx context.Context) (revocationstore.Service, error) {
+	var revocationStoreSrv revocationstore.Service
+
+	if err := revocationstore.FromContextAs(ctx, &revocationStoreSrv); err != nil {
+		var missingErr common.CtxValueKeyMissingError
+		if errors.As(err, &missingErr) {
+			return nil, nil
 		}
 
-		return secret, nil
-	}); err != nil {
-		return "", fmt.Errorf("jwt parse with claims error: %w", err)
+		return nil, fmt.Errorf("revocation store from context as err: %w", err)
 	}
 
-	if !claims.VerifyAudience(viper.GetString(constant.TokenAudience), true) {
-		return "", common.AudienceError(claims.Audience)
+	return revocationStoreSrv, nil
+}
+
+// userStoreFromContext returns the user store, or nil when none is injected and token versions are
+// not checked.
+func userStoreFromContext(ctx context.Context) (userstore.Service, error) {
+	var userStoreSrv userstore.Service
+
+	if err := userstore.FromContextAs(ctx, &userStoreSrv); err != nil {
+		var missingErr common.CtxValueKeyMissingError
+		if errors.As(err, &missingErr) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("user store from context as err: %w", err)
+	}
+
+	return userStoreSrv, nil
+}
+
+// Issuer is the iss of the tokens, token.issuer without a trailing slash. The discovery document
+// and the endpoint URLs built from it use the same value so the issuer always matches.
+func Issuer() string {
+	return strings.TrimSuffix(viper.GetString(constant.TokenIssuer), "/")
+}
+
+// newJTI returns a random token id.
+func newJTI() (string, error) {
+	jtiBytes := make([]byte, 16)
+
+	if _, err := rand.Read(jtiBytes); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
 	}
 
-	return claims.Subject, nil
+	return hex.EncodeToString(jtiBytes), nil
 }
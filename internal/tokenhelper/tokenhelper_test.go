@@ -2,13 +2,30 @@ package tokenhelper
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
 	"time"
 
+	"go-wai-wong/common"
 	"go-wai-wong/internal/config"
 	"go-wai-wong/internal/constant"
 	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/keystore"
+	"go-wai-wong/internal/revocationstore"
+	"go-wai-wong/internal/userstore"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/spf13/viper"
@@ -81,6 +98,14 @@ func Test_GenToken(t *testing.T) {
 	}
 }
 
+func subjectOf(claims *Claims) string {
+	if claims == nil {
+		return ""
+	}
+
+	return claims.Subject
+}
+
 func Test_VerifyToken(t *testing.T) {
 	t.Parallel()
 
@@ -204,6 +229,42 @@ func Test_VerifyToken(t *testing.T) {
 			wantErr: true,
 			args:    args{username: "testUsername"},
 		},
+		{
+			name: "verifyToken-badIssuerErr",
+			c:    tokenHelperImpl{},
+			goLibMockForVerifyToken: func(t *testing.T) *golib.GoLibImplMock {
+				t.Helper()
+
+				return &golib.GoLibImplMock{}
+			},
+			goLibMockForGenToken: func(t *testing.T) *golib.GoLibImplMock {
+				t.Helper()
+
+				return &golib.GoLibImplMock{}
+			},
+			tokenHelperMock: func(t *testing.T) *TokenClientImplMock {
+				t.Helper()
+
+				return &TokenClientImplMock{
+					GenTokenFn: func(ctx context.Context, username string, opts ...Option) (string, error) {
+						secret, err := golib.New().StdEncodingDecodeString(viper.GetString(constant.TokenSecret))
+						if err != nil {
+							return "", err
+						}
+
+						return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+							Subject:   username,
+							ExpiresAt: time.Now().Add(viper.GetDuration(constant.TokenExpiresIn)).Unix(),
+							Audience:  viper.GetString(constant.TokenAudience),
+							Issuer:    "https://bad.issuer",
+						}).SignedString(secret)
+					},
+				}
+			},
+			want:    "",
+			wantErr: true,
+			args:    args{username: "testUsername"},
+		},
 		{
 			name: "verifyToken-expiredTokenErr",
 			c:    tokenHelperImpl{},
@@ -256,8 +317,8 @@ func Test_VerifyToken(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if got != tt.want {
-				t.Fatalf("tokenHelperImpl.VerifyToken() = %v, want %v", got, tt.want)
+			if subjectOf(got) != tt.want {
+				t.Fatalf("tokenHelperImpl.VerifyToken() = %v, want %v", subjectOf(got), tt.want)
 			}
 		})
 	}
@@ -269,7 +330,11 @@ func BenchmarkGenToken(b *testing.B) {
 	b.ResetTimer()
 
 	goLibSrv := golib.New()
-	tokenHelperSrv := New()
+
+	tokenHelperSrv, err := New()
+	if err != nil {
+		b.Fatalf("failed to load keys: %v", err)
+	}
 
 	ctx = golib.WithGoLib(ctx, goLibSrv)
 
@@ -277,3 +342,1056 @@ func BenchmarkGenToken(b *testing.B) {
 		_, _ = tokenHelperSrv.GenToken(ctx, "test")
 	}
 }
+
+func generatePEMKeys(t *testing.T, privateKey crypto.Signer) map[string][]byte {
+	t.Helper()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	return map[string][]byte{
+		"private.pem": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		"public.pem":  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+	}
+}
+
+func Test_AsymmetricToken(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ec key: %v", err)
+	}
+
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ec key: %v", err)
+	}
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ec key: %v", err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		genC        tokenHelperImpl
+		genKeys     map[string][]byte
+		verifyC     tokenHelperImpl
+		verifyKeys  map[string][]byte
+		want        string
+		wantLoadErr bool
+		wantGenErr  bool
+		wantErr     bool
+		wantAlgErr  bool
+	}{
+		{
+			name:       "asymmetricToken-rs256",
+			genC:       tokenHelperImpl{algorithm: keystore.AlgorithmRS256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:    generatePEMKeys(t, rsaKey),
+			verifyC:    tokenHelperImpl{algorithm: keystore.AlgorithmRS256, publicKeyFile: "public.pem"},
+			verifyKeys: generatePEMKeys(t, rsaKey),
+			want:       "testUsername",
+		},
+		{
+			name:       "asymmetricToken-es256",
+			genC:       tokenHelperImpl{algorithm: keystore.AlgorithmES256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:    generatePEMKeys(t, ecKey),
+			verifyC:    tokenHelperImpl{algorithm: keystore.AlgorithmES256, publicKeyFile: "public.pem"},
+			verifyKeys: generatePEMKeys(t, ecKey),
+			want:       "testUsername",
+		},
+		{
+			name:       "asymmetricToken-eddsa",
+			genC:       tokenHelperImpl{algorithm: keystore.AlgorithmEdDSA, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:    generatePEMKeys(t, edKey),
+			verifyC:    tokenHelperImpl{algorithm: keystore.AlgorithmEdDSA, publicKeyFile: "public.pem"},
+			verifyKeys: generatePEMKeys(t, edKey),
+			want:       "testUsername",
+		},
+		{
+			name:       "asymmetricToken-verifyOnlyNeedsPublicKey",
+			genC:       tokenHelperImpl{algorithm: keystore.AlgorithmEdDSA, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:    generatePEMKeys(t, edKey),
+			verifyC:    tokenHelperImpl{algorithm: keystore.AlgorithmEdDSA, publicKeyFile: "public.pem"},
+			verifyKeys: map[string][]byte{"public.pem": generatePEMKeys(t, edKey)["public.pem"]},
+			want:       "testUsername",
+		},
+		{
+			name:       "asymmetricToken-algMismatchErr",
+			genC:       tokenHelperImpl{algorithm: keystore.AlgorithmRS256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:    generatePEMKeys(t, rsaKey),
+			verifyC:    tokenHelperImpl{algorithm: keystore.AlgorithmES256, publicKeyFile: "public.pem"},
+			verifyKeys: generatePEMKeys(t, ecKey),
+			wantErr:    true,
+			wantAlgErr: true,
+		},
+		{
+			name:       "asymmetricToken-hs256TokenRejectedErr",
+			genC:       tokenHelperImpl{},
+			verifyC:    tokenHelperImpl{algorithm: keystore.AlgorithmRS256, publicKeyFile: "public.pem"},
+			verifyKeys: generatePEMKeys(t, rsaKey),
+			wantErr:    true,
+			wantAlgErr: true,
+		},
+		{
+			name:       "asymmetricToken-wrongPublicKeyErr",
+			genC:       tokenHelperImpl{algorithm: keystore.AlgorithmES256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:    generatePEMKeys(t, ecKey),
+			verifyC:    tokenHelperImpl{algorithm: keystore.AlgorithmES256, publicKeyFile: "public.pem"},
+			verifyKeys: generatePEMKeys(t, otherECKey),
+			wantErr:    true,
+		},
+		{
+			name:        "asymmetricToken-p384CurveErr",
+			genC:        tokenHelperImpl{algorithm: keystore.AlgorithmES256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:     generatePEMKeys(t, p384Key),
+			wantLoadErr: true,
+		},
+		{
+			name:        "asymmetricToken-missingPrivateKeyErr",
+			genC:        tokenHelperImpl{algorithm: keystore.AlgorithmRS256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:     map[string][]byte{"public.pem": generatePEMKeys(t, rsaKey)["public.pem"]},
+			wantLoadErr: true,
+		},
+		{
+			name:        "asymmetricToken-missingPublicKeyErr",
+			genC:        tokenHelperImpl{algorithm: keystore.AlgorithmRS256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"},
+			genKeys:     map[string][]byte{"private.pem": generatePEMKeys(t, rsaKey)["private.pem"]},
+			wantLoadErr: true,
+		},
+		{
+			name:        "asymmetricToken-unknownAlgorithmErr",
+			genC:        tokenHelperImpl{algorithm: "none"},
+			genKeys:     map[string][]byte{},
+			wantLoadErr: true,
+		},
+		{
+			name:       "asymmetricToken-noPrivateKeyErr",
+			genC:       tokenHelperImpl{algorithm: keystore.AlgorithmRS256, publicKeyFile: "public.pem"},
+			genKeys:    generatePEMKeys(t, rsaKey),
+			wantGenErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			readFileMock := func(keys map[string][]byte) *golib.GoLibImplMock {
+				return &golib.GoLibImplMock{
+					ReadFileFn: func(name string) ([]byte, error) {
+						if key, ok := keys[name]; ok {
+							return key, nil
+						}
+
+						return nil, fmt.Errorf("test error: %v not found", name)
+					},
+				}
+			}
+
+			genC, err := tt.genC.loadKeys(readFileMock(tt.genKeys))
+			if (err != nil) != tt.wantLoadErr {
+				t.Fatalf("tokenHelperImpl.loadKeys() error = %v, wantLoadErr %v", err, tt.wantLoadErr)
+			}
+
+			if tt.wantLoadErr {
+				return
+			}
+
+			verifyC, err := tt.verifyC.loadKeys(readFileMock(tt.verifyKeys))
+			if err != nil {
+				t.Fatalf("tokenHelperImpl.loadKeys() error = %v", err)
+			}
+
+			ctx := golib.WithGoLib(context.Background(), golib.New())
+
+			tok, err := genC.GenToken(ctx, "testUsername")
+			if (err != nil) != tt.wantGenErr {
+				t.Fatalf("tokenHelperImpl.GenToken() error = %v, wantGenErr %v", err, tt.wantGenErr)
+			}
+
+			if tt.wantGenErr {
+				return
+			}
+
+			got, err := verifyC.VerifyToken(ctx, tok)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var algorithmErr common.AlgorithmError
+			if errors.As(err, &algorithmErr) != tt.wantAlgErr {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantAlgErr %v", err, tt.wantAlgErr)
+			}
+
+			if subjectOf(got) != tt.want {
+				t.Fatalf("tokenHelperImpl.VerifyToken() = %v, want %v", subjectOf(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_KeyFileJWKS(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ec key: %v", err)
+	}
+
+	keys := generatePEMKeys(t, ecKey)
+	goLibMock := &golib.GoLibImplMock{
+		ReadFileFn: func(name string) ([]byte, error) {
+			return keys[name], nil
+		},
+	}
+
+	c, err := tokenHelperImpl{algorithm: keystore.AlgorithmES256, privateKeyFile: "private.pem", publicKeyFile: "public.pem"}.loadKeys(goLibMock)
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.loadKeys() error = %v", err)
+	}
+
+	jwks, err := c.JWKS()
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.JWKS() error = %v", err)
+	}
+
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid == "" || jwks.Keys[0].Alg != keystore.AlgorithmES256 {
+		t.Fatalf("tokenHelperImpl.JWKS() = %+v, want the public key with a kid", jwks)
+	}
+
+	// the kid is derived from the key, a restart publishes the same kid
+	reloaded, err := tokenHelperImpl{algorithm: keystore.AlgorithmES256, publicKeyFile: "public.pem"}.loadKeys(goLibMock)
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.loadKeys() error = %v", err)
+	}
+
+	if reloaded.kid != jwks.Keys[0].Kid {
+		t.Fatalf("reloaded kid = %v, want %v", reloaded.kid, jwks.Keys[0].Kid)
+	}
+
+	tok, err := c.GenToken(golib.WithGoLib(context.Background(), golib.New()), "testUsername")
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+	}
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(tok, &jwt.StandardClaims{})
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+
+	if parsed.Header["kid"] != jwks.Keys[0].Kid {
+		t.Fatalf("token kid = %v, want %v", parsed.Header["kid"], jwks.Keys[0].Kid)
+	}
+
+	hs256JWKS, err := tokenHelperImpl{}.JWKS()
+	if err != nil || len(hs256JWKS.Keys) != 0 {
+		t.Fatalf("tokenHelperImpl.JWKS() = %+v, %v, want no keys for HS256", hs256JWKS, err)
+	}
+}
+
+func Test_KeyStoreToken(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	activeKey, err := keystore.GenerateKey(keystore.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	retiredKey, err := keystore.GenerateKey(keystore.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	keys := map[string]keystore.Key{
+		"active":  {ID: "active", Algorithm: keystore.AlgorithmEdDSA, PrivateKey: activeKey, PublicKey: activeKey.Public()},
+		"retired": {ID: "retired", Algorithm: keystore.AlgorithmEdDSA, PrivateKey: retiredKey, PublicKey: retiredKey.Public()},
+	}
+
+	tests := []struct {
+		name           string
+		signingKid     string
+		verifiableKids []string
+		want           string
+		wantErr        bool
+		wantKidErr     bool
+	}{
+		{
+			name:           "keyStoreToken-activeKey",
+			signingKid:     "active",
+			verifiableKids: []string{"active", "retired"},
+			want:           "testUsername",
+		},
+		{
+			name:           "keyStoreToken-retiredKeyInsideOverlap",
+			signingKid:     "retired",
+			verifiableKids: []string{"active", "retired"},
+			want:           "testUsername",
+		},
+		{
+			name:           "keyStoreToken-retiredKeyPastOverlapErr",
+			signingKid:     "retired",
+			verifiableKids: []string{"active"},
+			wantErr:        true,
+			wantKidErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			keyStoreMock := &keystore.KeyStoreClientImplMock{
+				SigningKeyFn: func() (keystore.Key, error) {
+					return keys[tt.signingKid], nil
+				},
+				VerificationKeyFn: func(kid string) (keystore.Key, error) {
+					for _, verifiableKid := range tt.verifiableKids {
+						if kid == verifiableKid {
+							return keys[kid], nil
+						}
+					}
+
+					return keystore.Key{}, common.KeyNotFoundError(kid)
+				},
+			}
+
+			ctx := golib.WithGoLib(context.Background(), &golib.GoLibImplMock{})
+			ctx = keystore.WithKeyStore(ctx, keyStoreMock)
+
+			tok, err := tokenHelperImpl{}.GenToken(ctx, "testUsername")
+			if err != nil {
+				t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+			}
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(tok, &jwt.StandardClaims{})
+			if err != nil || parsed.Header["kid"] != tt.signingKid {
+				t.Fatalf("token kid header = %v, %v, want %v", parsed.Header["kid"], err, tt.signingKid)
+			}
+
+			got, err := tokenHelperImpl{}.VerifyToken(ctx, tok)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var keyNotFoundErr common.KeyNotFoundError
+			if errors.As(err, &keyNotFoundErr) != tt.wantKidErr {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantKidErr %v", err, tt.wantKidErr)
+			}
+
+			if subjectOf(got) != tt.want {
+				t.Fatalf("tokenHelperImpl.VerifyToken() = %v, want %v", subjectOf(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_RevokeToken(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := golib.WithGoLib(context.Background(), &golib.GoLibImplMock{})
+	ctx = revocationstore.WithRevocationStore(ctx, revocationstore.New())
+
+	tokenHelperSrv := tokenHelperImpl{}
+
+	tok, err := tokenHelperSrv.GenToken(ctx, "testUsername")
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+	}
+
+	claims := jwt.StandardClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tok, &claims); err != nil || claims.Id == "" {
+		t.Fatalf("token jti = %q, %v, want a jti", claims.Id, err)
+	}
+
+	if _, err := tokenHelperSrv.VerifyToken(ctx, tok); err != nil {
+		t.Fatalf("tokenHelperImpl.VerifyToken() error = %v", err)
+	}
+
+	if err := tokenHelperSrv.Revoke(ctx, tok); err != nil {
+		t.Fatalf("tokenHelperImpl.Revoke() error = %v", err)
+	}
+
+	var tokenRevokedErr common.TokenRevokedError
+	if _, err := tokenHelperSrv.VerifyToken(ctx, tok); !errors.As(err, &tokenRevokedErr) {
+		t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, want TokenRevokedError", err)
+	}
+
+	if err := tokenHelperSrv.Revoke(ctx, "not-a-token"); err == nil {
+		t.Fatalf("tokenHelperImpl.Revoke() error = nil, want error for an invalid token")
+	}
+}
+
+func Test_TokenVersion(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	tokenVersion := 0
+
+	ctx := golib.WithGoLib(context.Background(), &golib.GoLibImplMock{})
+	ctx = userstore.WithUserStore(ctx, &userstore.UserStoreClientImplMock{
+		TokenVersionFn: func(username string) int {
+			return tokenVersion
+		},
+	})
+
+	tokenHelperSrv := tokenHelperImpl{}
+
+	tokenVersion = 2
+
+	tok, err := tokenHelperSrv.GenToken(ctx, "testUsername")
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+	}
+
+	claims, err := tokenHelperSrv.VerifyToken(ctx, tok)
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.VerifyToken() error = %v", err)
+	}
+
+	if claims.TokenVersion != 2 {
+		t.Fatalf("token tv = %v, want 2", claims.TokenVersion)
+	}
+
+	// the password changed
+	tokenVersion = 3
+
+	var tokenRevokedErr common.TokenRevokedError
+	if _, err := tokenHelperSrv.VerifyToken(ctx, tok); !errors.As(err, &tokenRevokedErr) {
+		t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, want TokenRevokedError", err)
+	}
+}
+
+func Test_TokenOptions(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := golib.WithGoLib(context.Background(), &golib.GoLibImplMock{})
+
+	tokenHelperSrv := tokenHelperImpl{}
+
+	tok, err := tokenHelperSrv.GenToken(ctx, "testUsername", WithRoles("user"), WithScope("sum:write", "documents:read"))
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+	}
+
+	claims, err := tokenHelperSrv.VerifyToken(ctx, tok)
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.VerifyToken() error = %v", err)
+	}
+
+	if claims.Scope != "sum:write documents:read" || len(claims.Roles) != 1 || claims.Roles[0] != "user" {
+		t.Fatalf("token scope = %q roles = %v, want the scope and roles options", claims.Scope, claims.Roles)
+	}
+
+	if !claims.HasScope("documents:read") || claims.HasScope("admin") {
+		t.Fatalf("Claims.HasScope() does not match the scope claim: %q", claims.Scope)
+	}
+
+	expiresAt := time.Now().Add(time.Minute)
+
+	tok, err = tokenHelperSrv.GenToken(
+		ctx,
+		"testUsername",
+		WithActor(&Actor{Subject: "gateway", Actor: &Actor{Subject: "batch"}}),
+		WithExpiresAt(expiresAt),
+	)
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+	}
+
+	claims, err = tokenHelperSrv.VerifyToken(ctx, tok)
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.VerifyToken() error = %v", err)
+	}
+
+	if claims.Actor == nil || claims.Actor.Subject != "gateway" || claims.Actor.Actor == nil || claims.Actor.Actor.Subject != "batch" {
+		t.Fatalf("token act = %+v, want gateway acting for batch", claims.Actor)
+	}
+
+	if claims.ExpiresAt != expiresAt.Unix() {
+		t.Fatalf("token exp = %v, want %v", claims.ExpiresAt, expiresAt.Unix())
+	}
+}
+
+func Test_EncryptedToken(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+
+	directKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", contentKeyBytes)))
+	otherDirectKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", contentKeyBytes)))
+
+	encryptionKeys := func(privateKey *rsa.PrivateKey) map[string][]byte {
+		keys := generatePEMKeys(t, privateKey)
+
+		return map[string][]byte{"enc-public.pem": keys["public.pem"], "enc-private.pem": keys["private.pem"]}
+	}
+
+	rsaEncryption := tokenHelperImpl{
+		encryption:               EncryptionRSAOAEP256,
+		encryptionPublicKeyFile:  "enc-public.pem",
+		encryptionPrivateKeyFile: "enc-private.pem",
+	}
+
+	tests := []struct {
+		name           string
+		genC           tokenHelperImpl
+		genKeys        map[string][]byte
+		verifyC        tokenHelperImpl
+		verifyKeys     map[string][]byte
+		opts           []Option
+		want           string
+		wantLoadErr    bool
+		wantSigned     bool
+		wantErr        bool
+		wantDecryptErr bool
+	}{
+		{
+			name:    "encryptedToken-direct",
+			genC:    tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: directKey},
+			verifyC: tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: directKey},
+			want:    "testUsername",
+		},
+		{
+			name:       "encryptedToken-rsaOAEP256",
+			genC:       rsaEncryption,
+			genKeys:    encryptionKeys(rsaKey),
+			verifyC:    rsaEncryption,
+			verifyKeys: encryptionKeys(rsaKey),
+			want:       "testUsername",
+		},
+		{
+			name:           "encryptedToken-wrongDirectKeyErr",
+			genC:           tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: directKey},
+			verifyC:        tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: otherDirectKey},
+			wantErr:        true,
+			wantDecryptErr: true,
+		},
+		{
+			name:           "encryptedToken-wrongPrivateKeyErr",
+			genC:           rsaEncryption,
+			genKeys:        encryptionKeys(rsaKey),
+			verifyC:        rsaEncryption,
+			verifyKeys:     encryptionKeys(otherRSAKey),
+			wantErr:        true,
+			wantDecryptErr: true,
+		},
+		{
+			name:           "encryptedToken-plainTokenRejectedErr",
+			genC:           tokenHelperImpl{},
+			verifyC:        tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: directKey},
+			wantErr:        true,
+			wantDecryptErr: true,
+		},
+		{
+			name:           "encryptedToken-algMismatchErr",
+			genC:           rsaEncryption,
+			genKeys:        encryptionKeys(rsaKey),
+			verifyC:        tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: directKey},
+			wantErr:        true,
+			wantDecryptErr: true,
+		},
+		{
+			name:       "encryptedToken-publicKeyOfPrivateKey",
+			genC:       tokenHelperImpl{encryption: EncryptionRSAOAEP256, encryptionPrivateKeyFile: "enc-private.pem"},
+			genKeys:    encryptionKeys(rsaKey),
+			verifyC:    rsaEncryption,
+			verifyKeys: encryptionKeys(rsaKey),
+			want:       "testUsername",
+		},
+		{
+			name:           "encryptedToken-withoutEncryptionErr",
+			genC:           tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: directKey},
+			verifyC:        tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: directKey},
+			opts:           []Option{WithoutEncryption()},
+			wantSigned:     true,
+			wantErr:        true,
+			wantDecryptErr: true,
+		},
+		{
+			name:        "encryptedToken-shortDirectKeyErr",
+			genC:        tokenHelperImpl{encryption: EncryptionDirect, encryptionKey: base64.StdEncoding.EncodeToString([]byte("short"))},
+			wantLoadErr: true,
+		},
+		{
+			name:        "encryptedToken-missingPrivateKeyErr",
+			genC:        rsaEncryption,
+			genKeys:     map[string][]byte{"enc-public.pem": encryptionKeys(rsaKey)["enc-public.pem"]},
+			wantLoadErr: true,
+		},
+		{
+			name:        "encryptedToken-brokenPublicKeyErr",
+			genC:        rsaEncryption,
+			genKeys:     map[string][]byte{"enc-public.pem": []byte("broken"), "enc-private.pem": encryptionKeys(rsaKey)["enc-private.pem"]},
+			wantLoadErr: true,
+		},
+		{
+			name:        "encryptedToken-unknownAlgorithmErr",
+			genC:        tokenHelperImpl{encryption: "A256KW"},
+			wantLoadErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			readFileMock := func(keys map[string][]byte) *golib.GoLibImplMock {
+				return &golib.GoLibImplMock{
+					ReadFileFn: func(name string) ([]byte, error) {
+						if key, ok := keys[name]; ok {
+							return key, nil
+						}
+
+						return nil, fmt.Errorf("test error: %v not found", name)
+					},
+				}
+			}
+
+			genC, err := tt.genC.loadEncryptionKeys(readFileMock(tt.genKeys))
+			if (err != nil) != tt.wantLoadErr {
+				t.Fatalf("tokenHelperImpl.loadEncryptionKeys() error = %v, wantLoadErr %v", err, tt.wantLoadErr)
+			}
+
+			if tt.wantLoadErr {
+				return
+			}
+
+			verifyC, err := tt.verifyC.loadEncryptionKeys(readFileMock(tt.verifyKeys))
+			if err != nil {
+				t.Fatalf("tokenHelperImpl.loadEncryptionKeys() error = %v", err)
+			}
+
+			ctx := golib.WithGoLib(context.Background(), golib.New())
+
+			tok, err := genC.GenToken(ctx, "testUsername", tt.opts...)
+			if err != nil {
+				t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+			}
+
+			// the claims must not be readable without the key
+			if tt.genC.encryption != "" && !tt.wantSigned && strings.Count(tok, ".") != 4 {
+				t.Fatalf("tokenHelperImpl.GenToken() = %v, want a compact JWE", tok)
+			}
+
+			if tt.wantSigned && strings.Count(tok, ".") != 2 {
+				t.Fatalf("tokenHelperImpl.GenToken() = %v, want a signed token", tok)
+			}
+
+			got, err := verifyC.VerifyToken(ctx, tok)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var decryptionErr common.DecryptionError
+			if errors.As(err, &decryptionErr) != tt.wantDecryptErr {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantDecryptErr %v", err, tt.wantDecryptErr)
+			}
+
+			if subjectOf(got) != tt.want {
+				t.Fatalf("tokenHelperImpl.VerifyToken() = %v, want %v", subjectOf(got), tt.want)
+			}
+		})
+	}
+}
+
+// Test_Issuer does not run in parallel as it sets the issuer in the global config.
+func Test_Issuer(t *testing.T) {
+	config.LoadConfig()
+
+	issuer := viper.GetString(constant.TokenIssuer)
+
+	t.Cleanup(func() { viper.Set(constant.TokenIssuer, issuer) })
+
+	viper.Set(constant.TokenIssuer, "https://auth.example.com/")
+
+	ctx := golib.WithGoLib(context.Background(), golib.New())
+
+	tokenHelperSrv, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	token, err := tokenHelperSrv.GenToken(ctx, "testUsername")
+	if err != nil {
+		t.Fatalf("GenToken() error = %v", err)
+	}
+
+	claims, err := tokenHelperSrv.VerifyToken(ctx, token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v", err)
+	}
+
+	if claims.Issuer != "https://auth.example.com" || Issuer() != claims.Issuer {
+		t.Fatalf("token iss: %q Issuer(): %q, want both without the trailing slash", claims.Issuer, Issuer())
+	}
+}
+
+func Test_RegisteredClaims(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	expiresIn := viper.GetDuration(constant.TokenExpiresIn)
+	start := time.Now()
+
+	clockAt := func(offset time.Duration) *golib.GoLibImplMock {
+		return &golib.GoLibImplMock{
+			NowFn: func() time.Time {
+				return start.Add(offset)
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		c            tokenHelperImpl
+		opts         []Option
+		genOffset    time.Duration
+		verifyOffset time.Duration
+		withoutJTI   bool
+		want         string
+		wantClaim    string
+		wantAudErr   bool
+	}{
+		{
+			name: "registeredClaims-valid",
+			c:    tokenHelperImpl{clockSkew: 30 * time.Second},
+			want: "testUsername",
+		},
+		{
+			name:         "registeredClaims-expiredWithinSkew",
+			c:            tokenHelperImpl{clockSkew: 30 * time.Second},
+			verifyOffset: expiresIn + 20*time.Second,
+			want:         "testUsername",
+		},
+		{
+			name:         "registeredClaims-expiredPastSkewErr",
+			c:            tokenHelperImpl{clockSkew: 30 * time.Second},
+			verifyOffset: expiresIn + 40*time.Second,
+			wantClaim:    "exp",
+		},
+		{
+			name:      "registeredClaims-issuerClockAheadWithinSkew",
+			c:         tokenHelperImpl{clockSkew: 30 * time.Second},
+			genOffset: 20 * time.Second,
+			want:      "testUsername",
+		},
+		{
+			name:      "registeredClaims-issuedInFutureErr",
+			c:         tokenHelperImpl{clockSkew: 30 * time.Second},
+			genOffset: 2 * time.Minute,
+			wantClaim: "iat",
+		},
+		{
+			name:      "registeredClaims-notBeforeErr",
+			c:         tokenHelperImpl{clockSkew: 30 * time.Second},
+			genOffset: 2 * time.Minute,
+			// an iat in the past keeps the iat check from failing first
+			opts:      []Option{func(claims *Claims) { claims.IssuedAt = start.Unix() }},
+			wantClaim: "nbf",
+		},
+		{
+			name:       "registeredClaims-missingJTIErr",
+			c:          tokenHelperImpl{clockSkew: 30 * time.Second},
+			withoutJTI: true,
+			wantClaim:  "jti",
+		},
+		{
+			name: "registeredClaims-acceptedAudience",
+			c:    tokenHelperImpl{audiences: []string{"billing"}},
+			opts: []Option{WithAudience("billing")},
+			want: "testUsername",
+		},
+		{
+			name:       "registeredClaims-unknownAudienceErr",
+			c:          tokenHelperImpl{audiences: []string{"billing"}},
+			opts:       []Option{WithAudience("payroll")},
+			wantAudErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tt.opts
+			if tt.withoutJTI {
+				opts = append(opts, func(claims *Claims) { claims.Id = "" })
+			}
+
+			tok, err := tt.c.GenToken(golib.WithGoLib(context.Background(), clockAt(tt.genOffset)), "testUsername", opts...)
+			if err != nil {
+				t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+			}
+
+			got, err := tt.c.VerifyToken(golib.WithGoLib(context.Background(), clockAt(tt.verifyOffset)), tok)
+
+			var claimErr common.ClaimError
+			if errors.As(err, &claimErr) != (tt.wantClaim != "") || claimErr.Claim != tt.wantClaim {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, want invalid claim: %q", err, tt.wantClaim)
+			}
+
+			var audienceErr common.AudienceError
+			if errors.As(err, &audienceErr) != tt.wantAudErr {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, wantAudErr %v", err, tt.wantAudErr)
+			}
+
+			if subjectOf(got) != tt.want {
+				t.Fatalf("tokenHelperImpl.VerifyToken() = %v, want %v", subjectOf(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_ClaimsBuilder(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := golib.WithGoLib(context.Background(), &golib.GoLibImplMock{})
+	ctx = userstore.WithUserStore(ctx, &userstore.UserStoreClientImplMock{
+		GetFn: func(username string) (userstore.User, error) {
+			if username != "alice" {
+				return userstore.User{}, common.UserNotFoundError(username)
+			}
+
+			return userstore.User{Username: "alice", Name: "Alice", Email: "alice@example.com", Tenant: "acme"}, nil
+		},
+		TokenVersionFn: func(username string) int {
+			return 0
+		},
+	})
+
+	tests := []struct {
+		name       string
+		c          Service
+		username   string
+		opts       []Option
+		wantTenant string
+		wantName   string
+		wantErr    bool
+	}{
+		{
+			name:       "claimsBuilder-userProfile",
+			c:          tokenHelperImpl{}.WithClaimsBuilder(UserProfileClaims),
+			username:   "alice",
+			wantTenant: "acme",
+			wantName:   "Alice",
+		},
+		{
+			name:     "claimsBuilder-notAUser",
+			c:        tokenHelperImpl{}.WithClaimsBuilder(UserProfileClaims),
+			username: "batch",
+		},
+		{
+			name:       "claimsBuilder-optionOverrides",
+			c:          tokenHelperImpl{}.WithClaimsBuilder(UserProfileClaims),
+			username:   "alice",
+			opts:       []Option{func(claims *Claims) { claims.Tenant = "other" }},
+			wantTenant: "other",
+			wantName:   "Alice",
+		},
+		{
+			name: "claimsBuilder-builderErr",
+			c: tokenHelperImpl{}.WithClaimsBuilder(func(ctx context.Context, subject string, claims *Claims) error {
+				return fmt.Errorf("test error")
+			}),
+			username: "alice",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tok, err := tt.c.GenToken(ctx, tt.username, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tokenHelperImpl.GenToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			claims, err := tt.c.VerifyToken(ctx, tok)
+			if err != nil {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v", err)
+			}
+
+			if claims.Tenant != tt.wantTenant || claims.Name != tt.wantName {
+				t.Fatalf("token tenant = %q name = %q, want %q and %q", claims.Tenant, claims.Name, tt.wantTenant, tt.wantName)
+			}
+		})
+	}
+}
+
+// newTestCertificate returns a self-signed client certificate for commonName.
+func newTestCertificate(t *testing.T, commonName string) *x509.Certificate {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate the key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("Could not create the certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse the certificate: %v", err)
+	}
+
+	return cert
+}
+
+func Test_CertificateBinding(t *testing.T) {
+	t.Parallel()
+
+	config.LoadConfig()
+
+	ctx := golib.WithGoLib(context.Background(), &golib.GoLibImplMock{})
+
+	aliceCert := newTestCertificate(t, "alice")
+	otherCert := newTestCertificate(t, "alice")
+
+	tokenHelperSrv := tokenHelperImpl{}
+
+	boundToken, err := tokenHelperSrv.GenToken(ctx, "alice", WithCertificateBinding(aliceCert))
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+	}
+
+	unboundToken, err := tokenHelperSrv.GenToken(ctx, "alice")
+	if err != nil {
+		t.Fatalf("tokenHelperImpl.GenToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "certificateBinding-sameCertificate",
+			ctx:   WithClientCertificate(ctx, aliceCert),
+			token: boundToken,
+		},
+		{
+			name:    "certificateBinding-otherCertificate",
+			ctx:     WithClientCertificate(ctx, otherCert),
+			token:   boundToken,
+			wantErr: true,
+		},
+		{
+			name:    "certificateBinding-noCertificate",
+			ctx:     WithClientCertificate(ctx, nil),
+			token:   boundToken,
+			wantErr: true,
+		},
+		{
+			name:    "certificateBinding-noConnection",
+			ctx:     ctx,
+			token:   boundToken,
+			wantErr: true,
+		},
+		{
+			name:  "certificateBinding-withoutBinding",
+			ctx:   WithoutCertificateBinding(ctx),
+			token: boundToken,
+		},
+		{
+			name:  "certificateBinding-unboundToken",
+			ctx:   WithClientCertificate(ctx, otherCert),
+			token: unboundToken,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims, err := tokenHelperSrv.VerifyToken(tt.ctx, tt.token)
+
+			if tt.wantErr {
+				var certificateMismatchErr common.CertificateMismatchError
+				if !errors.As(err, &certificateMismatchErr) {
+					t.Fatalf("tokenHelperImpl.VerifyToken() error = %v, want CertificateMismatchError", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("tokenHelperImpl.VerifyToken() error = %v", err)
+			}
+
+			if tt.token == boundToken && (claims.Confirmation == nil || claims.Confirmation.X5TS256 != CertificateThumbprint(aliceCert)) {
+				t.Fatalf("token cnf = %+v, want the thumbprint of the certificate", claims.Confirmation)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package userstore
+
+type UserStoreClientImplMock struct {
+	GetFn             func(username string) (User, error)
+	VerifyFn          func(username, password string) (User, error)
+	CreateFn          func(username, password string) (User, error)
+	SetPasswordFn     func(username, password string) error
+	SetDisabledFn     func(username string, disabled bool) error
+	ListFn            func() []User
+	ChangePasswordFn  func(username, oldPassword, newPassword string) error
+	TokenVersionFn    func(username string) int
+	SetRolesFn        func(username string, roles []string) error
+	SetProfileFn      func(username string, profile Profile) error
+	EnrollTOTPFn      func(username string) (string, error)
+	ConfirmTOTPFn     func(username, code string) ([]string, error)
+	VerifyTOTPFn      func(username, code string) error
+	UseRecoveryCodeFn func(username, code string) error
+}
+
+func (c *UserStoreClientImplMock) Get(username string) (User, error) {
+	if c != nil && c.GetFn != nil {
+		return c.GetFn(username)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return User{}, err
+	}
+
+	return userStoreSrv.Get(username)
+}
+
+func (c *UserStoreClientImplMock) Verify(username, password string) (User, error) {
+	if c != nil && c.VerifyFn != nil {
+		return c.VerifyFn(username, password)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return User{}, err
+	}
+
+	return userStoreSrv.Verify(username, password)
+}
+
+func (c *UserStoreClientImplMock) Create(username, password string) (User, error) {
+	if c != nil && c.CreateFn != nil {
+		return c.CreateFn(username, password)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return User{}, err
+	}
+
+	return userStoreSrv.Create(username, password)
+}
+
+func (c *UserStoreClientImplMock) SetPassword(username, password string) error {
+	if c != nil && c.SetPasswordFn != nil {
+		return c.SetPasswordFn(username, password)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return userStoreSrv.SetPassword(username, password)
+}
+
+func (c *UserStoreClientImplMock) ChangePassword(username, oldPassword, newPassword string) error {
+	if c != nil && c.ChangePasswordFn != nil {
+		return c.ChangePasswordFn(username, oldPassword, newPassword)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return userStoreSrv.ChangePassword(username, oldPassword, newPassword)
+}
+
+func (c *UserStoreClientImplMock) TokenVersion(username string) int {
+	if c != nil && c.TokenVersionFn != nil {
+		return c.TokenVersionFn(username)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return 0
+	}
+
+	return userStoreSrv.TokenVersion(username)
+}
+
+func (c *UserStoreClientImplMock) SetDisabled(username string, disabled bool) error {
+	if c != nil && c.SetDisabledFn != nil {
+		return c.SetDisabledFn(username, disabled)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return userStoreSrv.SetDisabled(username, disabled)
+}
+
+func (c *UserStoreClientImplMock) SetRoles(username string, roles []string) error {
+	if c != nil && c.SetRolesFn != nil {
+		return c.SetRolesFn(username, roles)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return userStoreSrv.SetRoles(username, roles)
+}
+
+func (c *UserStoreClientImplMock) List() []User {
+	if c != nil && c.ListFn != nil {
+		return c.ListFn()
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return nil
+	}
+
+	return userStoreSrv.List()
+}
+
+func (c *UserStoreClientImplMock) SetProfile(username string, profile Profile) error {
+	if c != nil && c.SetProfileFn != nil {
+		return c.SetProfileFn(username, profile)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return userStoreSrv.SetProfile(username, profile)
+}
+
+func (c *UserStoreClientImplMock) EnrollTOTP(username string) (string, error) {
+	if c != nil && c.EnrollTOTPFn != nil {
+		return c.EnrollTOTPFn(username)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return "", err
+	}
+
+	return userStoreSrv.EnrollTOTP(username)
+}
+
+func (c *UserStoreClientImplMock) ConfirmTOTP(username, code string) ([]string, error) {
+	if c != nil && c.ConfirmTOTPFn != nil {
+		return c.ConfirmTOTPFn(username, code)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return nil, err
+	}
+
+	return userStoreSrv.ConfirmTOTP(username, code)
+}
+
+func (c *UserStoreClientImplMock) VerifyTOTP(username, code string) error {
+	if c != nil && c.VerifyTOTPFn != nil {
+		return c.VerifyTOTPFn(username, code)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return userStoreSrv.VerifyTOTP(username, code)
+}
+
+func (c *UserStoreClientImplMock) UseRecoveryCode(username, code string) error {
+	if c != nil && c.UseRecoveryCodeFn != nil {
+		return c.UseRecoveryCodeFn(username, code)
+	}
+
+	userStoreSrv, err := New()
+	if err != nil {
+		return err
+	}
+
+	return userStoreSrv.UseRecoveryCode(username, code)
+}
@@ -0,0 +1,103 @@
+package userstore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+
+	"github.com/spf13/viper"
+)
+
+// PasswordPolicy is checked whenever a password is set. Classes is the number of character
+// classes (lower case, upper case, digits and symbols) a password needs at least one of each from.
+type PasswordPolicy struct {
+	MinLength int
+	Classes   int
+	Breached  map[string]bool
+}
+
+func newPasswordPolicy() (PasswordPolicy, error) {
+	policy := PasswordPolicy{
+		MinLength: viper.GetInt(constant.UsersPasswordMinLength),
+		Classes:   viper.GetInt(constant.UsersPasswordClasses),
+	}
+
+	breachedFile := viper.GetString(constant.UsersBreachedPasswordsFile)
+	if breachedFile == "" {
+		return policy, nil
+	}
+
+	breached, err := readBreachedPasswords(breachedFile)
+	if err != nil {
+		return policy, err
+	}
+
+	policy.Breached = breached
+
+	return policy, nil
+}
+
+// readBreachedPasswords reads a file with one breached password per line.
+func readBreachedPasswords(file string) (map[string]bool, error) {
+	breachedFile, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords file: %w", err)
+	}
+	defer breachedFile.Close()
+
+	breached := map[string]bool{}
+
+	scanner := bufio.NewScanner(breachedFile)
+	for scanner.Scan() {
+		if password := strings.TrimRight(scanner.Text(), "\r"); password != "" {
+			breached[password] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached passwords file: %w", err)
+	}
+
+	return breached, nil
+}
+
+// Check returns a PasswordPolicyError naming the first rule password breaks.
+func (p PasswordPolicy) Check(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return common.PasswordPolicyError(fmt.Sprintf("password must be at least %d characters", p.MinLength))
+	}
+
+	if classes := characterClasses(password); classes < p.Classes {
+		return common.PasswordPolicyError(fmt.Sprintf("password must mix at least %d of lower case, upper case, digits and symbols", p.Classes))
+	}
+
+	if p.Breached[password] {
+		return common.PasswordPolicyError("password is in a list of breached passwords")
+	}
+
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,127 @@
+package userstore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits      = 6
+	totpPeriod      = 30 * time.Second
+	totpSecretBytes = 20
+	// totpSkewSteps is how many steps before and after the current one are accepted, for clock
+	// drift between the server and the authenticator
+	totpSkewSteps = 1
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random base32 secret as authenticator apps expect it.
+func newTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return secretEncoding.EncodeToString(secret), nil
+}
+
+// totpCode is the RFC 4226 HOTP code of secret for the time step, with HMAC-SHA1 since that is
+// the only algorithm authenticator apps reliably support.
+func totpCode(secret []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, truncated%1000000)
+}
+
+// matchTOTP returns the time step code is valid for at now. Steps up to lastStep were already used
+// and are rejected so an observed code cannot be replayed.
+func matchTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / int64(totpPeriod/time.Second)
+
+	for step := current - totpSkewSteps; step <= current+totpSkewSteps; step++ {
+		if step <= lastStep {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// TOTPURI is the otpauth:// key URI of secret, authenticator apps read it from a QR code.
+func TOTPURI(issuer, username, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod / time.Second))},
+	}
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + username,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// newRecoveryCodes returns one time recovery codes and their hashes, only the hashes are stored.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		codeBytes := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(codeBytes); err != nil {
+			return nil, nil, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+
+		code := strings.ToLower(secretEncoding.EncodeToString(codeBytes))
+		code = code[:len(code)/2] + "-" + code[len(code)/2:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code with SHA-256, the codes are random with 80 bits of
+// entropy so unlike passwords they do not need a slow hash. Case and dashes do not matter.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,483 @@
+package userstore
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-wai-wong/common"
+	"go-wai-wong/internal/constant"
+
+	"github.com/spf13/viper"
+)
+
+// User is a stored account, only the password hash is kept.
+type User struct {
+	Username     string `json:"username" mapstructure:"username"`
+	PasswordHash string `json:"-" mapstructure:"password_hash"`
+	Disabled     bool   `json:"disabled" mapstructure:"disabled"`
+	// Roles decide the scopes of the tokens of the user, users without roles get the default roles
+	Roles []string `json:"roles,omitempty" mapstructure:"roles"`
+	// Name, Email and Tenant are the profile of the user, tokens carry them as claims
+	Name   string `json:"name,omitempty" mapstructure:"name"`
+	Email  string `json:"email,omitempty" mapstructure:"email"`
+	Tenant string `json:"tenant,omitempty" mapstructure:"tenant"`
+	// TokenVersion goes up with every password change, tokens issued with an older version are
+	// rejected
+	TokenVersion int `json:"-" mapstructure:"token_version"`
+	// TOTPSecret is the base32 TOTP secret, pending until TOTPEnabled is set by a confirmed code.
+	// TOTPLastStep is the time step of the last accepted code so codes cannot be replayed.
+	TOTPSecret   string `json:"-" mapstructure:"totp_secret"`
+	TOTPEnabled  bool   `json:"totp_enabled" mapstructure:"totp_enabled"`
+	TOTPLastStep int64  `json:"-" mapstructure:"totp_last_step"`
+	// RecoveryCodeHashes are the hashes of the unused recovery codes
+	RecoveryCodeHashes []string `json:"-" mapstructure:"recovery_code_hashes"`
+}
+
+// Profile is the part of a user that is shown to clients.
+type Profile struct {
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Tenant string `json:"tenant"`
+}
+
+type Service interface {
+	Get(username string) (User, error)
+	Verify(username, password string) (User, error)
+	Create(username, password string) (User, error)
+	SetPassword(username, password string) error
+	ChangePassword(username, oldPassword, newPassword string) error
+	TokenVersion(username string) int
+	SetDisabled(username string, disabled bool) error
+	SetRoles(username string, roles []string) error
+	SetProfile(username string, profile Profile) error
+	List() []User
+	// EnrollTOTP stores a new pending TOTP secret for username and returns it
+	EnrollTOTP(username string) (string, error)
+	// ConfirmTOTP enables the pending secret once code matches it and returns new recovery codes
+	ConfirmTOTP(username, code string) ([]string, error)
+	VerifyTOTP(username, code string) error
+	// UseRecoveryCode accepts each recovery code once
+	UseRecoveryCode(username, code string) error
+}
+
+// userStoreImpl keeps users in memory, loaded from and saved back to the users.file YAML or JSON
+// file when one is configured.
+type userStoreImpl struct {
+	file          string
+	hashAlgorithm string
+	policy        PasswordPolicy
+	mu            *sync.RWMutex
+	users         map[string]User
+	// dummyHash is verified for unknown users so they take as long as known ones
+	dummyHash string
+	now       func() time.Time
+}
+
+// verify interface compliance
+var _ Service = (*userStoreImpl)(nil)
+
+// New loads the password policy and the users of users.file, an error means the store could not
+// check passwords or lost users and the server must not start with it.
+func New() (userStoreImpl, error) {
+	policy, err := newPasswordPolicy()
+	if err != nil {
+		return userStoreImpl{}, fmt.Errorf("failed to load password policy: %w", err)
+	}
+
+	userStore, err := newUserStore(viper.GetString(constant.UsersFile), viper.GetString(constant.UsersHashAlgorithm), policy)
+	if err != nil {
+		return userStoreImpl{}, fmt.Errorf("failed to load users: %w", err)
+	}
+
+	return userStore, nil
+}
+
+func newUserStore(file, hashAlgorithm string, policy PasswordPolicy) (userStoreImpl, error) {
+	userStore := userStoreImpl{
+		file:          file,
+		hashAlgorithm: hashAlgorithm,
+		policy:        policy,
+		mu:            &sync.RWMutex{},
+		users:         map[string]User{},
+		now:           time.Now,
+	}
+
+	dummyHash, err := HashPassword(hashAlgorithm, "dummy password")
+	if err != nil {
+		return userStore, err
+	}
+
+	userStore.dummyHash = dummyHash
+
+	if file == "" {
+		return userStore, nil
+	}
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return userStore, nil
+	}
+
+	usersConfig := viper.New()
+	usersConfig.SetConfigFile(file)
+
+	if err := usersConfig.ReadInConfig(); err != nil {
+		return userStore, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var users []User
+
+	if err := usersConfig.UnmarshalKey("users", &users); err != nil {
+		return userStore, fmt.Errorf("failed to unmarshal users: %w", err)
+	}
+
+	for _, user := range users {
+		userStore.users[user.Username] = user
+	}
+
+	return userStore, nil
+}
+
+func (c userStoreImpl) Get(username string) (User, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	user, ok := c.users[username]
+	if !ok {
+		return User{}, common.UserNotFoundError(username)
+	}
+
+	return user, nil
+}
+
+// Verify checks the password of username. Unknown users and wrong passwords both return
+// InvalidCredentialsError, disabled accounts only return AccountDisabledError for the right
+// password.
+func (c userStoreImpl) Verify(username, password string) (User, error) {
+	c.mu.RLock()
+	user, ok := c.users[username]
+	c.mu.RUnlock()
+
+	hash := user.PasswordHash
+	if !ok {
+		hash = c.dummyHash
+	}
+
+	matched, err := VerifyPassword(hash, password)
+	if err != nil {
+		return User{}, err
+	}
+
+	if !ok || !matched {
+		return User{}, common.InvalidCredentialsError(username)
+	}
+
+	if user.Disabled {
+		return User{}, common.AccountDisabledError(username)
+	}
+
+	return user, nil
+}
+
+func (c userStoreImpl) Create(username, password string) (User, error) {
+	if err := c.policy.Check(password); err != nil {
+		return User{}, err
+	}
+
+	hash, err := HashPassword(c.hashAlgorithm, password)
+	if err != nil {
+		return User{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.users[username]; ok {
+		return User{}, common.UserExistsError(username)
+	}
+
+	user := User{Username: username, PasswordHash: hash}
+	c.users[username] = user
+
+	if err := c.save(); err != nil {
+		delete(c.users, username)
+
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// SetPassword replaces the password of username and bumps its token version.
+func (c userStoreImpl) SetPassword(username, password string) error {
+	if err := c.policy.Check(password); err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(c.hashAlgorithm, password)
+	if err != nil {
+		return err
+	}
+
+	return c.update(username, func(user *User) {
+		user.PasswordHash = hash
+		user.TokenVersion++
+	})
+}
+
+// ChangePassword sets a new password for username after verifying the old one.
+func (c userStoreImpl) ChangePassword(username, oldPassword, newPassword string) error {
+	if _, err := c.Verify(username, oldPassword); err != nil {
+		return err
+	}
+
+	return c.SetPassword(username, newPassword)
+}
+
+// TokenVersion returns the token version of username, unknown users are at version 0.
+func (c userStoreImpl) TokenVersion(username string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.users[username].TokenVersion
+}
+
+// SetDisabled disables or re-enables username, disabling bumps its token version so its
+// outstanding tokens and refresh tokens stop working.
+func (c userStoreImpl) SetDisabled(username string, disabled bool) error {
+	return c.update(username, func(user *User) {
+		if disabled && !user.Disabled {
+			user.TokenVersion++
+		}
+
+		user.Disabled = disabled
+	})
+}
+
+func (c userStoreImpl) SetRoles(username string, roles []string) error {
+	return c.update(username, func(user *User) {
+		user.Roles = roles
+	})
+}
+
+func (c userStoreImpl) SetProfile(username string, profile Profile) error {
+	return c.update(username, func(user *User) {
+		user.Name = profile.Name
+		user.Email = profile.Email
+		user.Tenant = profile.Tenant
+	})
+}
+
+// EnrollTOTP replaces any pending secret, users that already confirmed one get MFAEnabledError so a
+// stolen token cannot swap out the second factor.
+func (c userStoreImpl) EnrollTOTP(username string) (string, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	var enabled bool
+
+	if err := c.update(username, func(user *User) {
+		if enabled = user.TOTPEnabled; !enabled {
+			user.TOTPSecret = secret
+		}
+	}); err != nil {
+		return "", err
+	}
+
+	if enabled {
+		return "", common.MFAEnabledError(username)
+	}
+
+	return secret, nil
+}
+
+func (c userStoreImpl) ConfirmTOTP(username, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var confirmErr error
+
+	if err := c.update(username, func(user *User) {
+		if user.TOTPEnabled {
+			confirmErr = common.MFAEnabledError(username)
+
+			return
+		}
+
+		if user.TOTPSecret == "" {
+			confirmErr = common.MFANotEnrolledError(username)
+
+			return
+		}
+
+		step, ok := matchTOTP(user.TOTPSecret, code, c.now(), user.TOTPLastStep)
+		if !ok {
+			confirmErr = common.InvalidMFACodeError(username)
+
+			return
+		}
+
+		user.TOTPEnabled = true
+		user.TOTPLastStep = step
+		user.RecoveryCodeHashes = hashes
+	}); err != nil {
+		return nil, err
+	}
+
+	if confirmErr != nil {
+		return nil, confirmErr
+	}
+
+	return codes, nil
+}
+
+// VerifyTOTP checks code against the confirmed secret of username, a code is only accepted once.
+func (c userStoreImpl) VerifyTOTP(username, code string) error {
+	var verifyErr error
+
+	if err := c.update(username, func(user *User) {
+		if !user.TOTPEnabled {
+			verifyErr = common.InvalidMFACodeError(username)
+
+			return
+		}
+
+		step, ok := matchTOTP(user.TOTPSecret, code, c.now(), user.TOTPLastStep)
+		if !ok {
+			verifyErr = common.InvalidMFACodeError(username)
+
+			return
+		}
+
+		user.TOTPLastStep = step
+	}); err != nil {
+		return err
+	}
+
+	return verifyErr
+}
+
+func (c userStoreImpl) UseRecoveryCode(username, code string) error {
+	codeHash := hashRecoveryCode(code)
+
+	var useErr error
+
+	if err := c.update(username, func(user *User) {
+		for i, hash := range user.RecoveryCodeHashes {
+			if subtle.ConstantTimeCompare([]byte(hash), []byte(codeHash)) == 1 {
+				user.RecoveryCodeHashes = append(append([]string{}, user.RecoveryCodeHashes[:i]...), user.RecoveryCodeHashes[i+1:]...)
+
+				return
+			}
+		}
+
+		useErr = common.InvalidMFACodeError(username)
+	}); err != nil {
+		return err
+	}
+
+	return useErr
+}
+
+// List returns the users sorted by username.
+func (c userStoreImpl) List() []User {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.sortedUsers()
+}
+
+func (c userStoreImpl) sortedUsers() []User {
+	users := make([]User, 0, len(c.users))
+	for _, user := range c.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	return users
+}
+
+func (c userStoreImpl) update(username string, updateFn func(user *User)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, ok := c.users[username]
+	if !ok {
+		return common.UserNotFoundError(username)
+	}
+
+	updated := previous
+	updateFn(&updated)
+	c.users[username] = updated
+
+	if err := c.save(); err != nil {
+		c.users[username] = previous
+
+		return err
+	}
+
+	return nil
+}
+
+// save writes the users to a temporary file next to the users file and renames it into place,
+// the caller holds the write lock.
+func (c userStoreImpl) save() error {
+	if c.file == "" {
+		return nil
+	}
+
+	users := make([]map[string]interface{}, 0, len(c.users))
+	for _, user := range c.sortedUsers() {
+		users = append(users, map[string]interface{}{
+			"username":      user.Username,
+			"password_hash": user.PasswordHash,
+			"disabled":      user.Disabled,
+			"token_version": user.TokenVersion,
+			"roles":         user.Roles,
+			"name":          user.Name,
+			"email":         user.Email,
+			"tenant":        user.Tenant,
+
+			"totp_secret":          user.TOTPSecret,
+			"totp_enabled":         user.TOTPEnabled,
+			"totp_last_step":       user.TOTPLastStep,
+			"recovery_code_hashes": user.RecoveryCodeHashes,
+		})
+	}
+
+	// the file has password hashes and TOTP secrets, it keeps the mode the operator gave it and a
+	// new one is only readable by the owner
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(c.file); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	usersConfig := viper.New()
+	usersConfig.SetConfigPermissions(mode)
+	usersConfig.Set("users", users)
+
+	// a temp file left over by a failed save would keep its own mode
+	tmpFile := filepath.Join(filepath.Dir(c.file), ".tmp-"+filepath.Base(c.file))
+	if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old temp users file: %w", err)
+	}
+
+	if err := usersConfig.WriteConfigAs(tmpFile); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile, c.file); err != nil {
+		return fmt.Errorf("failed to move users file into place: %w", err)
+	}
+
+	return nil
+}
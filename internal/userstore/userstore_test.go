@@ -0,0 +1,472 @@
+package userstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-wai-wong/common"
+)
+
+func Test_HashPassword(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		algorithm string
+		wantErr   bool
+	}{
+		{name: "hashPassword-bcrypt", algorithm: HashBcrypt},
+		{name: "hashPassword-argon2id", algorithm: HashArgon2id},
+		{name: "hashPassword-unknownAlgorithm", algorithm: "md5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			hash, err := HashPassword(tt.algorithm, "secret")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HashPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if matched, err := VerifyPassword(hash, "secret"); err != nil || !matched {
+				t.Fatalf("VerifyPassword() = %v, %v, want true", matched, err)
+			}
+
+			if matched, err := VerifyPassword(hash, "wrong"); err != nil || matched {
+				t.Fatalf("VerifyPassword() = %v, %v, want false", matched, err)
+			}
+		})
+	}
+}
+
+func Test_Verify(t *testing.T) {
+	t.Parallel()
+
+	userStoreSrv, err := newUserStore("", HashBcrypt, PasswordPolicy{})
+	if err != nil {
+		t.Fatalf("newUserStore() error = %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "secret"); err != nil {
+		t.Fatalf("userStoreImpl.Create() error = %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("bob", "secret"); err != nil {
+		t.Fatalf("userStoreImpl.Create() error = %v", err)
+	}
+
+	if err := userStoreSrv.SetDisabled("bob", true); err != nil {
+		t.Fatalf("userStoreImpl.SetDisabled() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+	}{
+		{name: "verify-validPassword", username: "alice", password: "secret"},
+		{name: "verify-wrongPassword", username: "alice", password: "wrong", wantErr: common.InvalidCredentialsError("")},
+		{name: "verify-unknownUser", username: "carol", password: "secret", wantErr: common.InvalidCredentialsError("")},
+		{name: "verify-disabled", username: "bob", password: "secret", wantErr: common.AccountDisabledError("")},
+		{name: "verify-disabledWrongPassword", username: "bob", password: "wrong", wantErr: common.InvalidCredentialsError("")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			user, err := userStoreSrv.Verify(tt.username, tt.password)
+
+			switch wantErr := tt.wantErr.(type) {
+			case nil:
+				if err != nil || user.Username != tt.username {
+					t.Fatalf("userStoreImpl.Verify() = %v, %v, want %v", user.Username, err, tt.username)
+				}
+			case common.InvalidCredentialsError:
+				if !errors.As(err, &wantErr) {
+					t.Fatalf("userStoreImpl.Verify() error = %v, want InvalidCredentialsError", err)
+				}
+			case common.AccountDisabledError:
+				if !errors.As(err, &wantErr) {
+					t.Fatalf("userStoreImpl.Verify() error = %v, want AccountDisabledError", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_Persistence(t *testing.T) {
+	t.Parallel()
+
+	for _, extension := range []string{"yaml", "json"} {
+		extension := extension
+
+		t.Run("persistence-"+extension, func(t *testing.T) {
+			t.Parallel()
+
+			file := filepath.Join(t.TempDir(), "users."+extension)
+
+			userStoreSrv, err := newUserStore(file, HashArgon2id, PasswordPolicy{})
+			if err != nil {
+				t.Fatalf("newUserStore() error = %v", err)
+			}
+
+			if _, err := userStoreSrv.Create("alice", "secret"); err != nil {
+				t.Fatalf("userStoreImpl.Create() error = %v", err)
+			}
+
+			if _, err := userStoreSrv.Create("alice", "other"); !errors.As(err, new(common.UserExistsError)) {
+				t.Fatalf("userStoreImpl.Create() error = %v, want UserExistsError", err)
+			}
+
+			if err := userStoreSrv.SetPassword("alice", "changed"); err != nil {
+				t.Fatalf("userStoreImpl.SetPassword() error = %v", err)
+			}
+
+			if err := userStoreSrv.SetPassword("carol", "changed"); !errors.As(err, new(common.UserNotFoundError)) {
+				t.Fatalf("userStoreImpl.SetPassword() error = %v, want UserNotFoundError", err)
+			}
+
+			if err := userStoreSrv.SetRoles("alice", []string{"admin"}); err != nil {
+				t.Fatalf("userStoreImpl.SetRoles() error = %v", err)
+			}
+
+			if err := userStoreSrv.SetProfile("alice", Profile{Name: "Alice", Email: "alice@example.com", Tenant: "acme"}); err != nil {
+				t.Fatalf("userStoreImpl.SetProfile() error = %v", err)
+			}
+
+			secret, err := userStoreSrv.EnrollTOTP("alice")
+			if err != nil {
+				t.Fatalf("userStoreImpl.EnrollTOTP() error = %v", err)
+			}
+
+			key, _ := secretEncoding.DecodeString(secret)
+
+			recoveryCodes, err := userStoreSrv.ConfirmTOTP("alice", totpCode(key, time.Now().Unix()/30))
+			if err != nil {
+				t.Fatalf("userStoreImpl.ConfirmTOTP() error = %v", err)
+			}
+
+			reloaded, err := newUserStore(file, HashArgon2id, PasswordPolicy{})
+			if err != nil {
+				t.Fatalf("newUserStore() error = %v", err)
+			}
+
+			if _, err := reloaded.Verify("alice", "changed"); err != nil {
+				t.Fatalf("userStoreImpl.Verify() error = %v after reload", err)
+			}
+
+			if users := reloaded.List(); len(users) != 1 || users[0].Username != "alice" {
+				t.Fatalf("userStoreImpl.List() = %v, want [alice]", users)
+			}
+
+			if user, err := reloaded.Get("alice"); err != nil || len(user.Roles) != 1 || user.Roles[0] != "admin" {
+				t.Fatalf("userStoreImpl.Get() = %v, %v, want the admin role", user, err)
+			}
+
+			if user, _ := reloaded.Get("alice"); user.Name != "Alice" || user.Email != "alice@example.com" || user.Tenant != "acme" {
+				t.Fatalf("userStoreImpl.Get() = %v, want the profile of alice", user)
+			}
+
+			if user, _ := reloaded.Get("alice"); !user.TOTPEnabled || user.TOTPSecret != secret || user.TOTPLastStep == 0 {
+				t.Fatalf("userStoreImpl.Get() = %v, want the confirmed TOTP secret", user)
+			}
+
+			if err := reloaded.UseRecoveryCode("alice", recoveryCodes[0]); err != nil {
+				t.Fatalf("userStoreImpl.UseRecoveryCode() error = %v after reload", err)
+			}
+		})
+	}
+}
+
+func Test_saveFileMode(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	newFile := filepath.Join(dir, "new.yaml")
+
+	existingFile := filepath.Join(dir, "existing.yaml")
+	if err := os.WriteFile(existingFile, []byte("users: []\n"), 0o640); err != nil {
+		t.Fatalf("Could not write the users file: %v", err)
+	}
+
+	// a temp file of a failed save does not hand its mode to the users file
+	if err := os.WriteFile(filepath.Join(dir, ".tmp-existing.yaml"), nil, 0o644); err != nil {
+		t.Fatalf("Could not write the temp file: %v", err)
+	}
+
+	for file, expectedMode := range map[string]os.FileMode{newFile: 0o600, existingFile: 0o640} {
+		userStoreSrv, err := newUserStore(file, HashBcrypt, PasswordPolicy{})
+		if err != nil {
+			t.Fatalf("newUserStore() error = %v", err)
+		}
+
+		if _, err := userStoreSrv.Create("alice", "secret"); err != nil {
+			t.Fatalf("userStoreImpl.Create() error = %v", err)
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Could not stat the users file: %v", err)
+		}
+
+		if info.Mode().Perm() != expectedMode {
+			t.Fatalf("users file: %v mode: %v, want %v", filepath.Base(file), info.Mode().Perm(), expectedMode)
+		}
+	}
+}
+
+func Test_newUserStoreErrors(t *testing.T) {
+	t.Parallel()
+
+	brokenFile := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(brokenFile, []byte("users: [\n"), 0o600); err != nil {
+		t.Fatalf("Could not write the users file: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		file          string
+		hashAlgorithm string
+	}{
+		{
+			name:          "newUserStore-unknownHashAlgorithm",
+			hashAlgorithm: "md5",
+		},
+		{
+			name:          "newUserStore-brokenUsersFile",
+			file:          brokenFile,
+			hashAlgorithm: HashBcrypt,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := newUserStore(tt.file, tt.hashAlgorithm, PasswordPolicy{}); err == nil {
+				t.Fatalf("newUserStore() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func Test_PasswordPolicy(t *testing.T) {
+	t.Parallel()
+
+	breachedFile := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breachedFile, []byte("password1\nPassw0rd!\n"), 0o600); err != nil {
+		t.Fatalf("Could not write the breached passwords file: %v", err)
+	}
+
+	breached, err := readBreachedPasswords(breachedFile)
+	if err != nil {
+		t.Fatalf("readBreachedPasswords() error = %v", err)
+	}
+
+	policy := PasswordPolicy{MinLength: 8, Classes: 3, Breached: breached}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "passwordPolicy-valid", password: "Correct horse 1"},
+		{name: "passwordPolicy-tooShort", password: "Ab1!", wantErr: true},
+		{name: "passwordPolicy-tooFewClasses", password: "correct horse", wantErr: true},
+		{name: "passwordPolicy-breached", password: "Passw0rd!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := policy.Check(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PasswordPolicy.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.As(err, new(common.PasswordPolicyError)) {
+				t.Fatalf("PasswordPolicy.Check() error = %v, want PasswordPolicyError", err)
+			}
+		})
+	}
+}
+
+func Test_ChangePassword(t *testing.T) {
+	t.Parallel()
+
+	userStoreSrv, err := newUserStore("", HashBcrypt, PasswordPolicy{MinLength: 8})
+	if err != nil {
+		t.Fatalf("newUserStore() error = %v", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "short"); !errors.As(err, new(common.PasswordPolicyError)) {
+		t.Fatalf("userStoreImpl.Create() error = %v, want PasswordPolicyError", err)
+	}
+
+	if _, err := userStoreSrv.Create("alice", "old password"); err != nil {
+		t.Fatalf("userStoreImpl.Create() error = %v", err)
+	}
+
+	if err := userStoreSrv.ChangePassword("alice", "wrong password", "new password"); !errors.As(err, new(common.InvalidCredentialsError)) {
+		t.Fatalf("userStoreImpl.ChangePassword() error = %v, want InvalidCredentialsError", err)
+	}
+
+	if version := userStoreSrv.TokenVersion("alice"); version != 0 {
+		t.Fatalf("userStoreImpl.TokenVersion() = %v, want 0", version)
+	}
+
+	if err := userStoreSrv.ChangePassword("alice", "old password", "new password"); err != nil {
+		t.Fatalf("userStoreImpl.ChangePassword() error = %v", err)
+	}
+
+	if version := userStoreSrv.TokenVersion("alice"); version != 1 {
+		t.Fatalf("userStoreImpl.TokenVersion() = %v, want 1", version)
+	}
+
+	if _, err := userStoreSrv.Verify("alice", "new password"); err != nil {
+		t.Fatalf("userStoreImpl.Verify() error = %v", err)
+	}
+
+	if err := userStoreSrv.SetDisabled("alice", true); err != nil {
+		t.Fatalf("userStoreImpl.SetDisabled() error = %v", err)
+	}
+
+	if version := userStoreSrv.TokenVersion("alice"); version != 2 {
+		t.Fatalf("userStoreImpl.TokenVersion() = %v, want 2 after disabling", version)
+	}
+}
+
+func Test_totpCode(t *testing.T) {
+	t.Parallel()
+
+	// RFC 6238 SHA-1 test vectors, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(secret, tt.unix/30); got != tt.want {
+			t.Fatalf("totpCode() at: %v = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func Test_TOTP(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	userStoreSrv, err := newUserStore("", HashBcrypt, PasswordPolicy{})
+	if err != nil {
+		t.Fatalf("newUserStore() error = %v", err)
+	}
+
+	userStoreSrv.now = func() time.Time { return now }
+
+	if _, err := userStoreSrv.Create("alice", "alice password"); err != nil {
+		t.Fatalf("userStoreImpl.Create() error = %v", err)
+	}
+
+	if _, err := userStoreSrv.ConfirmTOTP("alice", "000000"); !errors.As(err, new(common.MFANotEnrolledError)) {
+		t.Fatalf("userStoreImpl.ConfirmTOTP() error = %v, want MFANotEnrolledError", err)
+	}
+
+	secret, err := userStoreSrv.EnrollTOTP("alice")
+	if err != nil {
+		t.Fatalf("userStoreImpl.EnrollTOTP() error = %v", err)
+	}
+
+	key, err := secretEncoding.DecodeString(secret)
+	if err != nil || len(key) != totpSecretBytes {
+		t.Fatalf("EnrollTOTP() secret: %q is not %v base32 bytes: %v", secret, totpSecretBytes, err)
+	}
+
+	codeAt := func(at time.Time) string { return totpCode(key, at.Unix()/30) }
+
+	if err := userStoreSrv.VerifyTOTP("alice", codeAt(now)); !errors.As(err, new(common.InvalidMFACodeError)) {
+		t.Fatalf("userStoreImpl.VerifyTOTP() before confirming error = %v, want InvalidMFACodeError", err)
+	}
+
+	if _, err := userStoreSrv.ConfirmTOTP("alice", "000000"); !errors.As(err, new(common.InvalidMFACodeError)) {
+		t.Fatalf("userStoreImpl.ConfirmTOTP() error = %v, want InvalidMFACodeError", err)
+	}
+
+	recoveryCodes, err := userStoreSrv.ConfirmTOTP("alice", codeAt(now))
+	if err != nil || len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("userStoreImpl.ConfirmTOTP() = %v, %v, want %v recovery codes", recoveryCodes, err, recoveryCodeCount)
+	}
+
+	if _, err := userStoreSrv.EnrollTOTP("alice"); !errors.As(err, new(common.MFAEnabledError)) {
+		t.Fatalf("userStoreImpl.EnrollTOTP() error = %v, want MFAEnabledError", err)
+	}
+
+	user, _ := userStoreSrv.Get("alice")
+	for _, hash := range user.RecoveryCodeHashes {
+		for _, code := range recoveryCodes {
+			if hash == code {
+				t.Fatalf("recovery code: %q is stored in plain text", code)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		after   time.Duration
+		code    func() string
+		wantErr bool
+	}{
+		{name: "verifyTOTP-replayed", code: func() string { return codeAt(now) }, wantErr: true},
+		{name: "verifyTOTP-nextStep", after: 30 * time.Second, code: func() string { return codeAt(now) }},
+		{name: "verifyTOTP-driftedClock", after: 30 * time.Second, code: func() string { return codeAt(now.Add(30 * time.Second)) }},
+		{name: "verifyTOTP-olderStep", after: 30 * time.Second, code: func() string { return codeAt(now.Add(-60 * time.Second)) }, wantErr: true},
+		{name: "verifyTOTP-wrongCode", code: func() string { return "12345" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+
+		if err := userStoreSrv.VerifyTOTP("alice", tt.code()); (err != nil) != tt.wantErr {
+			t.Fatalf("%v: userStoreImpl.VerifyTOTP() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if err := userStoreSrv.UseRecoveryCode("alice", strings.ToUpper(recoveryCodes[3])); err != nil {
+		t.Fatalf("userStoreImpl.UseRecoveryCode() error = %v", err)
+	}
+
+	if err := userStoreSrv.UseRecoveryCode("alice", recoveryCodes[3]); !errors.As(err, new(common.InvalidMFACodeError)) {
+		t.Fatalf("userStoreImpl.UseRecoveryCode() reused error = %v, want InvalidMFACodeError", err)
+	}
+
+	if user, _ := userStoreSrv.Get("alice"); len(user.RecoveryCodeHashes) != recoveryCodeCount-1 {
+		t.Fatalf("user has %v recovery codes, want %v", len(user.RecoveryCodeHashes), recoveryCodeCount-1)
+	}
+}
@@ -1,16 +1,37 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/go-chi/chi"
+	"github.com/spf13/viper"
 
+	"go-wai-wong/internal/apikeystore"
+	"go-wai-wong/internal/attemptstore"
+	"go-wai-wong/internal/challengestore"
+	"go-wai-wong/internal/clientstore"
+	"go-wai-wong/internal/codestore"
 	"go-wai-wong/internal/config"
+	"go-wai-wong/internal/constant"
+	"go-wai-wong/internal/devicestore"
+	"go-wai-wong/internal/docstore"
 	"go-wai-wong/internal/golib"
+	"go-wai-wong/internal/keystore"
 	"go-wai-wong/internal/provider/jsonprovider"
+	"go-wai-wong/internal/provider/jsonschema"
+	"go-wai-wong/internal/provider/pipeline"
+	"go-wai-wong/internal/refreshstore"
+	"go-wai-wong/internal/revocationstore"
 	"go-wai-wong/internal/route"
 	"go-wai-wong/internal/tokenhelper"
+	"go-wai-wong/internal/userstore"
 )
 
 func defaultRouter() *chi.Mux {
@@ -19,23 +40,174 @@ func defaultRouter() *chi.Mux {
 	return r
 }
 
+// registerSumSchema registers the schema file from config under the sum.schema name
+func registerSumSchema(jsonSchemaSrv jsonschema.Service) {
+	schemaFile := viper.GetString(constant.SumSchemaFile)
+	if schemaFile == "" {
+		return
+	}
+
+	schemaBytes, err := os.ReadFile(schemaFile)
+	if err != nil {
+		log.Fatalf("Could not read schema file because: %v", err)
+	}
+
+	var schemaDocument interface{}
+
+	if err := json.Unmarshal(schemaBytes, &schemaDocument); err != nil {
+		log.Fatalf("Could not unmarshal schema file because: %v", err)
+	}
+
+	if err := jsonSchemaSrv.Register(viper.GetString(constant.SumSchema), schemaDocument); err != nil {
+		log.Fatalf("Could not register schema because: %v", err)
+	}
+}
+
+// startKeyStore loads the key directory, creating the first key when it is empty, and keeps it up
+// to date with the directory and the rotation schedule.
+func startKeyStore(r chi.Router) {
+	if viper.GetString(constant.TokenKeyDirectory) == "" {
+		return
+	}
+
+	if viper.GetString(constant.TokenAlgorithm) == keystore.AlgorithmHS256 {
+		log.Fatalf("Could not start key store because: %v needs an asymmetric token.algorithm", constant.TokenKeyDirectory)
+	}
+
+	keyStoreSrv := keystore.New()
+
+	if err := keyStoreSrv.Reload(); err != nil {
+		log.Fatalf("Could not load keys because: %v", err)
+	}
+
+	if _, err := keyStoreSrv.SigningKey(); err != nil {
+		if _, err := keyStoreSrv.Rotate(); err != nil {
+			log.Fatalf("Could not create the first key because: %v", err)
+		}
+	}
+
+	go func() {
+		if err := keyStoreSrv.Watch(context.Background()); err != nil {
+			log.Printf("Stopped watching keys because: %v", err)
+		}
+	}()
+
+	if rotation := viper.GetDuration(constant.TokenKeyRotation); rotation > 0 {
+		go keyStoreSrv.RotateEvery(context.Background(), rotation)
+	}
+
+	r.Use(keystore.Inject(keyStoreSrv))
+}
+
+// newTLSConfig verifies the client certificates a connection presents against the CA bundle in
+// tls.clientcafile, only connections with one are accepted when tls.requireclientcert is set.
+// Without a CA bundle no client certificates are asked for.
+func newTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	clientCAFile := viper.GetString(constant.TLSClientCAFile)
+	if clientCAFile == "" {
+		if viper.GetBool(constant.TLSRequireClientCert) {
+			return nil, fmt.Errorf("%v needs %v", constant.TLSRequireClientCert, constant.TLSClientCAFile)
+		}
+
+		return tlsConfig, nil
+	}
+
+	pemBytes, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client ca file: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no certificates in client ca file: %v", clientCAFile)
+	}
+
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	if viper.GetBool(constant.TLSRequireClientCert) {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// listenAndServe serves HTTPS with the tls.certfile and tls.keyfile when they are set, plain HTTP
+// otherwise.
+func listenAndServe(r http.Handler) error {
+	certFile := viper.GetString(constant.TLSCertFile)
+	if certFile == "" {
+		return http.ListenAndServe(":8080", r)
+	}
+
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Addr: ":8080", Handler: r, TLSConfig: tlsConfig}
+
+	return server.ListenAndServeTLS(certFile, viper.GetString(constant.TLSKeyFile))
+}
+
 func main() {
 	config.LoadConfig()
 
 	r := defaultRouter()
 
+	myGoLibsSrv := golib.New()
+
 	jsonProviderSrv := jsonprovider.New()
-	tokenHelperSrv := tokenhelper.New()
+	jsonSchemaSrv := jsonschema.New()
+	pipelineSrv := pipeline.New()
+	docStoreSrv := docstore.New()
+	// the stores read the time from the clock the handlers set their expiries with
+	refreshStoreSrv := refreshstore.New().WithClock(myGoLibsSrv.Now)
+	revocationStoreSrv := revocationstore.New().WithClock(myGoLibsSrv.Now)
+	codeStoreSrv := codestore.New().WithClock(myGoLibsSrv.Now)
+	deviceStoreSrv := devicestore.New().WithClock(myGoLibsSrv.Now)
+	attemptStoreSrv := attemptstore.New().WithClock(myGoLibsSrv.Now)
+	challengeStoreSrv := challengestore.New().WithClock(myGoLibsSrv.Now)
+	apiKeyStoreSrv := apikeystore.New().WithClock(myGoLibsSrv.Now)
 
-	myGoLibsSrv := golib.New()
+	tokenHelperSrv, err := tokenhelper.New()
+	if err != nil {
+		log.Fatalf("Could not load token keys because: %v", err)
+	}
+
+	clientStoreSrv, err := clientstore.New()
+	if err != nil {
+		log.Fatalf("Could not load clients because: %v", err)
+	}
+
+	userStoreSrv, err := userstore.New()
+	if err != nil {
+		log.Fatalf("Could not load users because: %v", err)
+	}
+
+	registerSumSchema(jsonSchemaSrv)
 
 	r.Use(golib.Inject(myGoLibsSrv))
-	r.Use(tokenhelper.Inject(tokenHelperSrv))
+	r.Use(tokenhelper.Inject(tokenHelperSrv.WithClaimsBuilder(tokenhelper.UserProfileClaims)))
 	r.Use(jsonprovider.Inject(jsonProviderSrv))
+	r.Use(jsonschema.Inject(jsonSchemaSrv))
+	r.Use(pipeline.Inject(pipelineSrv))
+	r.Use(docstore.Inject(docStoreSrv))
+	r.Use(refreshstore.Inject(refreshStoreSrv))
+	r.Use(revocationstore.Inject(revocationStoreSrv))
+	r.Use(clientstore.Inject(clientStoreSrv))
+	r.Use(userstore.Inject(userStoreSrv))
+	r.Use(codestore.Inject(codeStoreSrv))
+	r.Use(devicestore.Inject(deviceStoreSrv))
+	r.Use(attemptstore.Inject(attemptStoreSrv))
+	r.Use(challengestore.Inject(challengeStoreSrv))
+	r.Use(apikeystore.Inject(apiKeyStoreSrv))
+	startKeyStore(r)
 	route.Install(r)
 
-	err := http.ListenAndServe(":8080", r)
-	if err != nil {
+	if err := listenAndServe(r); err != nil {
 		log.Fatalf("Could not start server because: %v", err)
 	}
 }